@@ -0,0 +1,91 @@
+// Copyright © 2018 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// hostpathpv-mover copies quota paths between the move pods of
+// kubectl hostpathpv move.
+//
+//	hostpathpv-mover send --root=/fromdir --listen=:8873 --credential=/etc/hostpathpv-mover [--bwlimit=MB]
+//	hostpathpv-mover receive --server=IP:8873 --credential=/etc/hostpathpv-mover [--parallel=N] [--compress] REMOTE=LOCAL...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Rhealb/kubectl-plugins/hostpathpv/pkg/mover"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s send|receive [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "send":
+		err = runSend(os.Args[2:])
+	case "receive":
+		err = runReceive(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown mode %s, should be send or receive", os.Args[1])
+	}
+	if err != nil {
+		buf, _ := json.Marshal(mover.Event{Event: mover.EventError, Message: err.Error()})
+		fmt.Println(string(buf))
+		os.Exit(1)
+	}
+}
+
+func runSend(args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	root := flags.String("root", "/fromdir", "Dir the trees are under")
+	listen := flags.String("listen", ":8873", "Address to listen on")
+	credential := flags.String("credential", "/etc/hostpathpv-mover", "Dir of the move credential")
+	bwlimit := flags.Int64("bwlimit", 0, "Bandwidth cap in MB/s of all transfers, 0 is no limit")
+	flags.Parse(args)
+	config, err := mover.LoadTLSConfig(*credential, true)
+	if err != nil {
+		return err
+	}
+	s := &mover.Sender{Root: *root, TLS: config, BWLimit: *bwlimit * 1024 * 1024}
+	return s.ListenAndServe(*listen)
+}
+
+func runReceive(args []string) error {
+	flags := flag.NewFlagSet("receive", flag.ExitOnError)
+	server := flags.String("server", "", "Address of the sender")
+	credential := flags.String("credential", "/etc/hostpathpv-mover", "Dir of the move credential")
+	parallel := flags.Int("parallel", 0, "Max trees copied at the same time, 0 is all")
+	compress := flags.Bool("compress", false, "Compress the data in transfer")
+	flags.Parse(args)
+	if *server == "" || flags.NArg() == 0 {
+		return fmt.Errorf("--server and at least one REMOTE=LOCAL tree are required")
+	}
+	trees := make([]mover.Tree, 0, flags.NArg())
+	for _, arg := range flags.Args() {
+		tree, err := mover.ParseTree(arg)
+		if err != nil {
+			return err
+		}
+		trees = append(trees, tree)
+	}
+	config, err := mover.LoadTLSConfig(*credential, false)
+	if err != nil {
+		return err
+	}
+	r := &mover.Receiver{Server: *server, TLS: config, Parallel: *parallel, Compress: *compress, Out: os.Stdout}
+	return r.Run(trees)
+}
@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"bufio"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -96,26 +94,6 @@ func init() {
 		}
 	}()
 }
-func getFromReader(r io.Reader, laststrLen *int) <-chan string {
-	strChan := make(chan string, 0)
-	lineReader := bufio.NewReader(r)
-	go func() {
-		for {
-			line, _, err := lineReader.ReadLine()
-			if err != nil {
-				//strChan <- ""
-				//close(strChan)
-			} else {
-				if strings.Contains(string(line), "Has moved") {
-					tmp := string("[ ") + string(line) + string(" ]")
-					strChan <- tmp
-					*laststrLen = len(tmp)
-				}
-			}
-		}
-	}()
-	return strChan
-}
 func getDelayStyle1(sum int, interval time.Duration, stop <-chan struct{}) <-chan string {
 	strChan := make(chan string, 0)
 	go func() {
@@ -369,3 +347,46 @@ func getPVTypeStr(pv *v1.PersistentVolume) string {
 //	s.string = strings.Join(indentedLines, "\n")
 //	return s
 //}
+
+// diffLines returns a line diff of a and b, every line is prefixed by
+// "  " when kept, "- " when removed and "+ " when added.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	ret := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "- "+a[i])
+			i++
+		default:
+			ret = append(ret, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, "+ "+b[j])
+	}
+	return ret
+}
@@ -15,42 +15,71 @@
 package cmd
 
 import (
+	"fmt"
 	"io"
 	"os"
-	"path"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
-var cfgFile string
-var user string
-var password string
-
 // This represents the base command when called without any subcommands
 var RootCmd = newRootCmd(os.Stdin, os.Stdout, os.Stderr)
 
-func buildConfig(kubeconfig string) (*rest.Config, error) {
-	if kubeconfig != "" {
-		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+// ConfigFlags holds the standard kubectl connection flags (--kubeconfig, --context,
+// --namespace, --as, ...) and builds clients from them on demand.
+type ConfigFlags struct {
+	loadingRules *clientcmd.ClientConfigLoadingRules
+	overrides    *clientcmd.ConfigOverrides
+	clientConfig clientcmd.ClientConfig
+}
+
+func NewConfigFlags() *ConfigFlags {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	return &ConfigFlags{
+		loadingRules: loadingRules,
+		overrides:    overrides,
+		clientConfig: clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides),
 	}
-	return rest.InClusterConfig()
 }
 
-func getClientset() (*kubernetes.Clientset, error) {
-	config, errConfig := buildConfig(path.Join(homedir.HomeDir(), ".kube", "config"))
-	if errConfig != nil {
-		return nil, errConfig
+func (f *ConfigFlags) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.loadingRules.ExplicitPath, clientcmd.RecommendedConfigPathFlag, "", "Path to the kubeconfig file to use for CLI requests.")
+	clientcmd.BindOverrideFlags(f.overrides, flags, clientcmd.RecommendedConfigOverrideFlags(""))
+}
+
+// ToRawKubeConfigLoader returns the merged client config of kubeconfig files, KUBECONFIG and flags.
+func (f *ConfigFlags) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return f.clientConfig
+}
+
+func (f *ConfigFlags) ToRESTConfig() (*rest.Config, error) {
+	config, err := f.clientConfig.ClientConfig()
+	if err != nil {
+		if clientcmd.IsEmptyConfig(err) {
+			return nil, fmt.Errorf("no usable kubeconfig found (set --kubeconfig, KUBECONFIG or ~/.kube/config, or run in cluster): %v", err)
+		}
+		return nil, fmt.Errorf("load kubeconfig err:%v", err)
 	}
+	return config, nil
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
+func (f *ConfigFlags) ClientSet() (*kubernetes.Clientset, error) {
+	config, err := f.ToRESTConfig()
 	if err != nil {
 		return nil, err
 	}
-	return clientset, nil
+	return kubernetes.NewForConfig(config)
+}
+
+// Namespace returns the namespace given by --namespace or the current context.
+func (f *ConfigFlags) Namespace() (string, error) {
+	namespace, _, err := f.clientConfig.Namespace()
+	return namespace, err
 }
 
 func newRootCmd(in io.Reader, out, err io.Writer) *cobra.Command {
@@ -64,15 +93,23 @@ func newRootCmd(in io.Reader, out, err io.Writer) *cobra.Command {
             https://github.com/github.com/Rhealb/kubectl-plugins/hostpathpv/`,
 		Run: runHelp,
 	}
-	client, _ := getClientset()
-	cmds.AddCommand(NewCmdHostPathPVGet(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVDescribe(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVDelete(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVMove(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVDisable(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVAdd(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVUpgrade(client, out, err))
-	cmds.AddCommand(NewCmdHostPathPVScale(client, out, err))
+	f := NewConfigFlags()
+	f.AddFlags(cmds.PersistentFlags())
+	cmds.PersistentFlags().Bool(dryRunFlag, false, "Only run the checks and print the annotations diff and the pods and pvs which would be created or deleted, nothing is changed")
+	cmds.AddCommand(NewCmdHostPathPVGet(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVDescribe(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVDelete(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVMove(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVDrain(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVRebalance(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVDisable(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVAdd(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVUpgrade(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVScale(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVCheck(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVRepair(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVBackup(f, out, err))
+	cmds.AddCommand(NewCmdHostPathPVRestore(f, out, err))
 	return cmds
 }
 
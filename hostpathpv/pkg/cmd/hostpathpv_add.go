@@ -16,13 +16,11 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"path"
 
 	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
-	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
 	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
 
 	"github.com/spf13/cobra"
@@ -50,14 +48,14 @@ var (
 		`)
 )
 
-func NewCmdHostPathPVAdd(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVAdd(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "add (TYPE/NAME ...) [flags]",
 		Short:   T("Add pv quota path"),
 		Long:    add_long,
 		Example: add_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunAdd(client, out, errOut, cmd, args)
+			err := RunAdd(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunAdd err:%v\n", err)
 			}
@@ -68,7 +66,7 @@ func NewCmdHostPathPVAdd(client *kubernetes.Clientset, out io.Writer, errOut io.
 	return cmd
 }
 
-func RunAdd(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunAdd(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", add_valid_resources)
 		usageString := "Required resource not specified."
@@ -78,6 +76,7 @@ func RunAdd(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.C
 	resource := args[0]
 	nodeName := GetFlagString(cmd, "node")
 	hostPath := GetFlagString(cmd, "path")
+	dryRun := isDryRun(cmd)
 
 	if nodeName == "" {
 		fmt.Fprint(errOut, "You must specify the node. ")
@@ -87,13 +86,17 @@ func RunAdd(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.C
 		fmt.Fprint(errOut, "You must specify the hostPath. ")
 		return UsageErrorf(cmd, "Required hostpath")
 	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "pvs" || resource == "pv":
 		pvName := ""
 		if len(args) >= 2 {
 			pvName = args[1]
 		}
-		err := addPVs(clientset, pvName, nodeName, hostPath)
+		err := addPVs(clientset, pvName, nodeName, hostPath, dryRun)
 		if err != nil {
 			fmt.Fprintf(errOut, "add err: %v\n", err)
 		}
@@ -106,7 +109,7 @@ func RunAdd(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.C
 	return nil
 }
 
-func addPVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath string) error {
+func addPVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath string, dryRun bool) error {
 	pv, err := clientset.Core().PersistentVolumes().Get(pvName, metav1.GetOptions{})
 	if err != nil {
 		return err
@@ -115,27 +118,22 @@ func addPVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath string)
 		return fmt.Errorf("pv %s is not hostpath pv", pv.Name)
 	}
 
-	if pv.Annotations == nil {
-		pv.Annotations = make(map[string]string)
+	addMountPath := func(list xfshostpath.HostPathPVMountInfoList) (xfshostpath.HostPathPVMountInfoList, bool, error) {
+		newList, err := getAddInfo(list, nodeName, hostPath)
+		return newList, err == nil, err
 	}
-
-	mountInfo := pv.Annotations[xfs.PVVolumeHostPathMountNode]
-
-	mountList := xfshostpath.HostPathPVMountInfoList{}
-	errUmarshal := json.Unmarshal([]byte(mountInfo), &mountList)
-	if errUmarshal != nil {
-		return errUmarshal
-	}
-
-	mountList, errAdd := getAddInfo(mountList, nodeName, hostPath)
-	if errAdd != nil {
-		return errAdd
+	if dryRun {
+		newPV := pv.DeepCopy()
+		if _, err := mutateMountList(newPV, addMountPath); err != nil {
+			return err
+		}
+		plan := NewDryRunPlan()
+		plan.UpdatePV(pv, newPV)
+		plan.Print()
+		return nil
 	}
-	buf, _ := json.Marshal(mountList)
-	pv.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
-	errUpdate := updatePV(clientset, pv)
-	if errUpdate != nil {
-		return errUpdate
+	if _, err := mutatePVMountList(clientset, pv.Name, addMountPath); err != nil {
+		return err
 	}
 
 	fmt.Printf("%s:%s add ok\n", nodeName, hostPath)
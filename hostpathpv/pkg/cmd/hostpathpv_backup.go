@@ -0,0 +1,182 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	backup_long = templates.LongDesc(`
+		Backup the hostpath annotations of all pvs and nodes to a file.
+
+		The pv mount nodes, mount policy, capacity and scale state annotations and the
+		node disk info and disable list annotations are saved together with the
+		resourceVersion of every object, the file can be re-applied by restore.`)
+
+	backup_example = templates.Examples(`
+		# Backup all hostpath annotations to state.yaml.
+		kubectl hostpathpv backup -f state.yaml
+
+		# Backup all hostpath annotations to stdout.
+		kubectl hostpathpv backup -f -
+		`)
+)
+
+const HostPathBackupKind = "HostPathPVBackup"
+
+var (
+	backupPVAnnotations = []string{
+		xfs.PVVolumeHostPathMountNode,
+		xfs.PVHostPathMountPolicyAnn,
+		xfs.PVHostPathMountTimeoutAnn,
+		xfs.PVHostPathTimeoutDelPodAnn,
+		xfs.PVHostPathQuotaForOnePod,
+		xfs.PVHostPathCapacityAnn,
+		xfs.PVHostPathCapacityStateAnn,
+		xfs.PVHostPathScaleStateAnn,
+	}
+	backupNodeAnnotations = []string{
+		xfs.NodeDiskQuotaInfoAnn,
+		xfs.NodeDiskQuotaStatusAnn,
+		xfs.NodeDiskQuotaDisableListAnn,
+	}
+	// restoreNodeAnnotations are the node annotations restored by default, the
+	// disk quota info and status are rewritten by the csi plugin from the disks.
+	restoreNodeAnnotations = []string{
+		xfs.NodeDiskQuotaDisableListAnn,
+	}
+)
+
+// HostPathBackup is the content of a backup file.
+type HostPathBackup struct {
+	Kind  string             `json:"kind"`
+	Time  string             `json:"time"`
+	PVs   []AnnotationBackup `json:"pvs"`
+	Nodes []AnnotationBackup `json:"nodes"`
+}
+
+// AnnotationBackup is the hostpath annotations of one object, a tracked
+// annotation which is not in Annotations did not exist at backup time.
+type AnnotationBackup struct {
+	Name            string            `json:"name"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+func NewCmdHostPathPVBackup(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "backup -f FILENAME [flags]",
+		Short:   T("Backup hostpath annotations of all pvs and nodes"),
+		Long:    backup_long,
+		Example: backup_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunBackup(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunBackup err:%v\n", err)
+			}
+		},
+	}
+	cmd.Flags().StringP("filename", "f", "", "File to save the backup to, - means stdout")
+	return cmd
+}
+
+func RunBackup(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	filename := GetFlagString(cmd, "filename")
+	if filename == "" {
+		return UsageErrorf(cmd, "Required --filename")
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	backup, err := getHostPathBackup(clientset)
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	if filename == "-" {
+		_, err = out.Write(buf)
+		return err
+	}
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "backup %d pvs and %d nodes to %s ok\n", len(backup.PVs), len(backup.Nodes), filename)
+	return nil
+}
+
+func getHostPathBackup(clientset *kubernetes.Clientset) (*HostPathBackup, error) {
+	backup := &HostPathBackup{
+		Kind:  HostPathBackupKind,
+		Time:  time.Now().Format(time.RFC3339),
+		PVs:   make([]AnnotationBackup, 0),
+		Nodes: make([]AnnotationBackup, 0),
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pvs err:%v", err)
+	}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if algorithm.IsCommonHostPathPV(pv) == false {
+			continue
+		}
+		backup.PVs = append(backup.PVs, AnnotationBackup{
+			Name:            pv.Name,
+			ResourceVersion: pv.ResourceVersion,
+			Annotations:     pickAnnotations(pv.Annotations, backupPVAnnotations),
+		})
+	}
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes err:%v", err)
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		backup.Nodes = append(backup.Nodes, AnnotationBackup{
+			Name:            node.Name,
+			ResourceVersion: node.ResourceVersion,
+			Annotations:     pickAnnotations(node.Annotations, backupNodeAnnotations),
+		})
+	}
+	return backup, nil
+}
+
+func pickAnnotations(annotations map[string]string, keys []string) map[string]string {
+	ret := make(map[string]string)
+	for _, key := range keys {
+		if value, exist := annotations[key]; exist {
+			ret[key] = value
+		}
+	}
+	return ret
+}
@@ -0,0 +1,313 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+)
+
+var (
+	check_long = templates.LongDesc(`
+		Check hostpath pv and node quota annotations against the cluster.
+
+		Every pv mount record, node quota disk and pod is walked and each inconsistency
+		is reported with its severity. The command exits with code 1 when an anomaly at
+		or above --fail-on is found and with code 2 when the check itself fails, so it
+		can be run from a cron job.`)
+
+	check_example = templates.Examples(`
+		# Check all hostpath pvs and nodes.
+		kubectl hostpathpv check
+
+		# Check and only fail on errors.
+		kubectl hostpathpv check --fail-on=error
+
+		# Check and print the anomalies in json output format.
+		kubectl hostpathpv check -o json
+		`)
+)
+
+const (
+	SeverityWarning = "Warning"
+	SeverityError   = "Error"
+)
+
+const (
+	AnomalyMalformedMountInfo  = "MalformedMountInfo"
+	AnomalyMalformedCapacity   = "MalformedCapacity"
+	AnomalyMalformedDiskInfo   = "MalformedDiskInfo"
+	AnomalyMissingDiskInfo     = "MissingDiskInfo"
+	AnomalyUnknownNode         = "UnknownNode"
+	AnomalyUnknownDisk         = "UnknownDisk"
+	AnomalyDisabledDisk        = "DisabledDisk"
+	AnomalyStalePodInfo        = "StalePodInfo"
+	AnomalyDuplicatePath       = "DuplicatePath"
+	AnomalyDiskOverAllocated   = "DiskOverAllocated"
+	AnomalyUnknownDisabledDisk = "UnknownDisabledDisk"
+)
+
+const (
+	checkExitCodeFoundAnomalies = 1
+	checkExitCodeFail           = 2
+)
+
+// Anomaly is one inconsistency found by check.
+type Anomaly struct {
+	Kind       string `json:"kind"`
+	Severity   string `json:"severity"`
+	Type       string `json:"type"`
+	ObjectKind string `json:"objectKind"`
+	ObjectName string `json:"objectName"`
+	NodeName   string `json:"nodeName,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Message    string `json:"message"`
+}
+
+func NewCmdHostPathPVCheck(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "check [flags]",
+		Short:   T("Check hostpath pv and node quota annotations consistency"),
+		Long:    check_long,
+		Example: check_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			found, err := RunCheck(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunCheck err:%v\n", err)
+				os.Exit(checkExitCodeFail)
+			}
+			if found {
+				os.Exit(checkExitCodeFoundAnomalies)
+			}
+		},
+	}
+	cmd.Flags().String("fail-on", "warning", "Lowest severity which makes check exit non-zero, one of: warning|error")
+	AddOutputFlag(cmd, "json|yaml|jsonpath=...|custom-columns=...")
+	return cmd
+}
+
+// RunCheck reports whether an anomaly at or above --fail-on was found.
+func RunCheck(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) (bool, error) {
+	failOn := GetFlagString(cmd, "fail-on")
+	if failOn != "warning" && failOn != "error" {
+		return false, UsageErrorf(cmd, "--fail-on should be warning or error")
+	}
+	output := GetFlagString(cmd, "output")
+	printer, err := NewResultPrinter(output)
+	if err != nil {
+		return false, UsageErrorf(cmd, "%v", err)
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return false, err
+	}
+
+	anomalies, err := checkCluster(clientset)
+	if err != nil {
+		return false, err
+	}
+	if output == "" || output == "wide" {
+		printAnomalies(anomalies, out)
+	} else {
+		list := NewQuotaList()
+		for i := range anomalies {
+			list.Items = append(list.Items, &anomalies[i])
+		}
+		if err := printer.PrintResult(list, out); err != nil {
+			return false, err
+		}
+	}
+	for _, anomaly := range anomalies {
+		if failOn == "warning" || anomaly.Severity == SeverityError {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func printAnomalies(anomalies []Anomaly, out io.Writer) {
+	if len(anomalies) == 0 {
+		fmt.Fprintf(out, "No anomaly found\n")
+		return
+	}
+	displayer := NewDisplayer("  ", "", "Severity", "Type", "Object", "Node", "Path", "Message")
+	var errNum, warnNum int
+	for _, anomaly := range anomalies {
+		displayer.AddLine(anomaly.Severity, anomaly.Type, anomaly.ObjectKind+"/"+anomaly.ObjectName,
+			anomaly.NodeName, anomaly.Path, anomaly.Message)
+		if anomaly.Severity == SeverityError {
+			errNum++
+		} else {
+			warnNum++
+		}
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "Errors: %d, Warnings: %d\n", errNum, warnNum)
+}
+
+func checkCluster(clientset *kubernetes.Clientset) ([]Anomaly, error) {
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pvs err:%v", err)
+	}
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes err:%v", err)
+	}
+	pods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pods err:%v", err)
+	}
+	return checkAnnotations(pvs, nodes, pods), nil
+}
+
+// checkAnnotations classifies every inconsistency between the pv mount records,
+// the node quota disks and the pods.
+func checkAnnotations(pvs *v1.PersistentVolumeList, nodes *v1.NodeList, pods *v1.PodList) []Anomaly {
+	ret := make([]Anomaly, 0)
+	add := func(severity, t, objectKind, objectName, nodeName, p, format string, a ...interface{}) {
+		ret = append(ret, Anomaly{Kind: QuotaKindAnomaly, Severity: severity, Type: t, ObjectKind: objectKind,
+			ObjectName: objectName, NodeName: nodeName, Path: p, Message: fmt.Sprintf(format, a...)})
+	}
+
+	nodeInfos := make(map[string]NodeInfoItem)
+	// unknownDisks are the nodes whose quota disks are not known, whether it is
+	// reported yet. Their quota paths are not checked against the disks, a
+	// missing disk info is reported only if a pv records quota paths on the node.
+	unknownDisks := make(map[string]bool)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		quotaInfo := getNodeQuotaInfos(node, pvs)
+		nodeInfos[node.Name] = quotaInfo
+		if node.Annotations == nil || node.Annotations[xfs.NodeDiskQuotaInfoAnn] == "" {
+			unknownDisks[node.Name] = false
+			continue
+		}
+		list := make(xfsquotamanager.NodeDiskQuotaInfoList, 0)
+		if err := json.Unmarshal([]byte(node.Annotations[xfs.NodeDiskQuotaInfoAnn]), &list); err != nil {
+			add(SeverityError, AnomalyMalformedDiskInfo, "node", node.Name, node.Name, "",
+				"annotation %s is not valid json: %v, the quota paths of the node are not checked", xfs.NodeDiskQuotaInfoAnn, err)
+			unknownDisks[node.Name] = true
+			continue
+		}
+		for _, disk := range quotaInfo.diskInfos {
+			if quota := disk.keep + disk.none + disk.share; quota > disk.capacity {
+				add(SeverityError, AnomalyDiskOverAllocated, "node", node.Name, node.Name, disk.path,
+					"quota %s is more than allocable %s", strings.Trim(convertIntToString(quota), " "),
+					strings.Trim(convertIntToString(disk.capacity), " "))
+			}
+		}
+		for _, disablePath := range getNodeQuotadiskDisableList(node) {
+			if getDiskInfoByPath(disablePath, quotaInfo.diskInfos) == nil {
+				add(SeverityWarning, AnomalyUnknownDisabledDisk, "node", node.Name, node.Name, disablePath,
+					"disabled disk is not a quota disk of the node")
+			}
+		}
+	}
+
+	podUIDs := make(map[string]*v1.Pod)
+	for i := range pods.Items {
+		podUIDs[string(pods.Items[i].UID)] = &pods.Items[i]
+	}
+
+	seenPaths := make(map[string]string)
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if algorithm.IsCommonHostPathPV(pv) == false || pv.Annotations == nil {
+			continue
+		}
+		if capacity := pv.Annotations[xfs.PVHostPathCapacityAnn]; capacity != "" {
+			if _, err := strconv.ParseInt(capacity, 10, 64); err != nil {
+				add(SeverityWarning, AnomalyMalformedCapacity, "pv", pv.Name, "", "",
+					"annotation %s=%q is not a valid size", xfs.PVHostPathCapacityAnn, capacity)
+			}
+		}
+		if pv.Annotations[xfs.PVVolumeHostPathMountNode] == "" {
+			continue
+		}
+		mountList := xfshostpath.HostPathPVMountInfoList{}
+		if err := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+			add(SeverityError, AnomalyMalformedMountInfo, "pv", pv.Name, "", "",
+				"annotation %s is not valid json: %v", xfs.PVVolumeHostPathMountNode, err)
+			continue
+		}
+		for _, item := range mountList {
+			quotaInfo, nodeExist := nodeInfos[item.NodeName]
+			if nodeExist == false {
+				add(SeverityWarning, AnomalyUnknownNode, "pv", pv.Name, item.NodeName, "",
+					"node does not exist, %d quota paths recorded", len(item.MountInfos))
+			}
+			for _, mountInfo := range item.MountInfos {
+				id := item.NodeName + ":" + path.Clean(mountInfo.HostPath)
+				if owner, exist := seenPaths[id]; exist {
+					add(SeverityError, AnomalyDuplicatePath, "pv", pv.Name, item.NodeName, mountInfo.HostPath,
+						"path is also recorded by pv %s", owner)
+				} else {
+					seenPaths[id] = pv.Name
+				}
+				if reported, exist := unknownDisks[item.NodeName]; exist {
+					if reported == false {
+						add(SeverityError, AnomalyMissingDiskInfo, "node", item.NodeName, item.NodeName, "",
+							"annotation %s is missing, the quota paths of the node are not checked", xfs.NodeDiskQuotaInfoAnn)
+						unknownDisks[item.NodeName] = true
+					}
+				} else if nodeExist {
+					disk := getDiskInfoByHostPath(mountInfo.HostPath, quotaInfo.diskInfos)
+					if disk == nil {
+						add(SeverityError, AnomalyUnknownDisk, "pv", pv.Name, item.NodeName, mountInfo.HostPath,
+							"path is not under any quota disk of the node")
+					} else if disk.disabled {
+						add(SeverityWarning, AnomalyDisabledDisk, "pv", pv.Name, item.NodeName, mountInfo.HostPath,
+							"path is on disabled disk %s", disk.path)
+					}
+				}
+				if mountInfo.PodInfo != nil && mountInfo.PodInfo.Info != "" {
+					ns, name, uid := getPodInfo(mountInfo.PodInfo.Info)
+					if pod, exist := podUIDs[uid]; exist == false || pod.Namespace != ns || pod.Name != name {
+						add(SeverityWarning, AnomalyStalePodInfo, "pv", pv.Name, item.NodeName, mountInfo.HostPath,
+							"pod %s/%s (uid %s) does not exist", ns, name, uid)
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func getDiskInfoByPath(diskPath string, diskinfos []DiskInfo) *DiskInfo {
+	for i := range diskinfos {
+		if path.Clean(diskinfos[i].path) == path.Clean(diskPath) {
+			return &diskinfos[i]
+		}
+	}
+	return nil
+}
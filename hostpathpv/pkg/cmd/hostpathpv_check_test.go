@@ -0,0 +1,102 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"k8s.io/api/core/v1"
+)
+
+// newTestCheckCluster returns nodes and pvs with one anomaly of every type.
+func newTestCheckCluster(t *testing.T) (*v1.PersistentVolumeList, *v1.NodeList) {
+	disks := xfsquotamanager.NodeDiskQuotaInfoList{
+		{MountPath: testDiskPath(1), Allocable: 1000},
+		{MountPath: testDiskPath(2), Allocable: 1000, Disabled: true},
+	}
+	nodes := &v1.NodeList{}
+	for i, disk := range []string{"", "missing", "{", "missing"} {
+		node := newTestQuotaNode(t, fmt.Sprintf("node%d", i+1), disks, testDiskPath(9))
+		if disk == "missing" {
+			node.Annotations = nil
+		} else if disk != "" {
+			node.Annotations[xfs.NodeDiskQuotaInfoAnn] = disk
+		}
+		nodes.Items = append(nodes.Items, *node)
+	}
+
+	stale := newTestKeepPV(t, "pv7", "node1", []string{testDiskPath(1) + "/s"}, []int64{0})
+	mountList := xfshostpath.HostPathPVMountInfoList{}
+	if err := json.Unmarshal([]byte(stale.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+		t.Fatal(err)
+	}
+	mountList[0].MountInfos[0].PodInfo = &xfshostpath.PodInfo{Info: "default:web-0:uid1"}
+	buf, err := json.Marshal(mountList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
+	broken := NewTmpHostPathPV("pv6")
+	broken.Annotations = map[string]string{
+		xfs.PVHostPathCapacityAnn:     "1x",
+		xfs.PVVolumeHostPathMountNode: "{",
+	}
+
+	pvs := &v1.PersistentVolumeList{Items: []v1.PersistentVolume{
+		newTestKeepPV(t, "pv1", "node1", []string{testDiskPath(1) + "/a", testDiskPath(3) + "/b", testDiskPath(2) + "/c"},
+			[]int64{100, 100, 100}),
+		newTestKeepPV(t, "pv2", "node1", []string{testDiskPath(1) + "/a"}, []int64{1000}),
+		newTestKeepPV(t, "pv3", "node2", []string{testDiskPath(1) + "/d", testDiskPath(1) + "/e"}, []int64{100, 100}),
+		newTestKeepPV(t, "pv4", "node3", []string{testDiskPath(1) + "/f", testDiskPath(3) + "/g"}, []int64{100, 100}),
+		newTestKeepPV(t, "pv5", "node9", []string{testDiskPath(1) + "/h"}, []int64{100}),
+		*broken,
+		stale,
+	}}
+	return pvs, nodes
+}
+
+func TestCheckAnnotations(t *testing.T) {
+	pvs, nodes := newTestCheckCluster(t)
+	anomalies := checkAnnotations(pvs, nodes, &v1.PodList{})
+	got := make([]string, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		got = append(got, fmt.Sprintf("%s %s %s/%s %s:%s", anomaly.Severity, anomaly.Type, anomaly.ObjectKind,
+			anomaly.ObjectName, anomaly.NodeName, anomaly.Path))
+	}
+	want := []string{
+		"Error DiskOverAllocated node/node1 node1:/xfs/disk1",
+		"Warning UnknownDisabledDisk node/node1 node1:/xfs/disk9",
+		"Error MalformedDiskInfo node/node3 node3:",
+		"Error UnknownDisk pv/pv1 node1:/xfs/disk3/b",
+		"Warning DisabledDisk pv/pv1 node1:/xfs/disk2/c",
+		"Error DuplicatePath pv/pv2 node1:/xfs/disk1/a",
+		// one anomaly for the node without disk info, not one for every path
+		"Error MissingDiskInfo node/node2 node2:",
+		"Warning UnknownNode pv/pv5 node9:",
+		"Warning MalformedCapacity pv/pv6 :",
+		"Error MalformedMountInfo pv/pv6 :",
+		"Warning StalePodInfo pv/pv7 node1:/xfs/disk1/s",
+	}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("got anomalies:\n%v\nwant:\n%v", got, want)
+	}
+}
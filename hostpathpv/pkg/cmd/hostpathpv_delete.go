@@ -20,14 +20,12 @@ import (
 	"fmt"
 	"io"
 	"path"
-	"time"
 
 	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
 	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
 	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
 
 	"github.com/spf13/cobra"
-	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/pkg/kubectl/util/templates"
@@ -56,14 +54,14 @@ var (
 		`)
 )
 
-func NewCmdHostPathPVDelete(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVDelete(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "delete (TYPE/NAME ...) [flags]",
 		Short:   T("Delete pv quota path"),
 		Long:    hostpathpv_delete_long,
 		Example: hostpathpv_delete_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunDelete(client, out, errOut, cmd, args)
+			err := RunDelete(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunDelete err:%v\n", err)
 			}
@@ -76,7 +74,7 @@ func NewCmdHostPathPVDelete(client *kubernetes.Clientset, out io.Writer, errOut
 	return cmd
 }
 
-func RunDelete(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunDelete(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", hostpathpv_delete_valid_resources)
 		usageString := "Required resource not specified."
@@ -88,6 +86,7 @@ func RunDelete(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobr
 	hostPath := GetFlagString(cmd, "path")
 	deleteAll := GetFlagBool(cmd, "all")
 	deleteForce := GetFlagBool(cmd, "force")
+	dryRun := isDryRun(cmd)
 
 	if nodeName == "" && deleteAll == false {
 		fmt.Fprint(errOut, "You must specify the node. ")
@@ -96,13 +95,17 @@ func RunDelete(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobr
 	if deleteAll == true {
 		nodeName = ""
 	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "pvs" || resource == "pv":
 		pvName := ""
 		if len(args) >= 2 {
 			pvName = args[1]
 		}
-		err := deletePVs(clientset, pvName, nodeName, hostPath, deleteForce)
+		err := deletePVs(clientset, pvName, nodeName, hostPath, deleteForce, dryRun)
 		if err != nil {
 			fmt.Fprintf(errOut, "delete err: %v\n", err)
 		}
@@ -115,7 +118,7 @@ func RunDelete(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobr
 	return nil
 }
 
-func deletePVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath string, deleteForce bool) error {
+func deletePVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath string, deleteForce, dryRun bool) error {
 	pv, err := clientset.Core().PersistentVolumes().Get(pvName, metav1.GetOptions{})
 	if err != nil {
 		return err
@@ -141,6 +144,15 @@ func deletePVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath strin
 		fmt.Printf("not quota path to delete\n")
 		return nil
 	}
+	if dryRun {
+		newPV := pv.DeepCopy()
+		buf, _ := json.Marshal(newMountList)
+		newPV.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
+		plan := NewDryRunPlan()
+		plan.UpdatePV(pv, newPV)
+		plan.Print()
+		return nil
+	}
 	if deleteForce != true {
 		for _, path := range deletePaths {
 			fmt.Printf("%s\n", path)
@@ -152,9 +164,11 @@ func deletePVs(clientset *kubernetes.Clientset, pvName, nodeName, hostPath strin
 			return nil
 		}
 	}
-	buf, _ := json.Marshal(newMountList)
-	pv.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
-	errUpdate := updatePV(clientset, pv)
+	_, errUpdate := mutatePVMountList(clientset, pv.Name, func(list xfshostpath.HostPathPVMountInfoList) (xfshostpath.HostPathPVMountInfoList, bool, error) {
+		newList, paths := getDeleteInfo(list, nodeName, hostPath)
+		deletePaths = paths
+		return newList, len(paths) > 0, nil
+	})
 	if errUpdate != nil {
 		return errUpdate
 	}
@@ -199,16 +213,3 @@ func getDeleteInfo(list xfshostpath.HostPathPVMountInfoList,
 	}
 	return
 }
-
-func updatePV(clientset *kubernetes.Clientset, pv *v1.PersistentVolume) error {
-	var err error
-	for i := 0; i < 3; i++ {
-		_, err = clientset.Core().PersistentVolumes().Update(pv)
-		if err == nil {
-			return nil
-		} else {
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-	return err
-}
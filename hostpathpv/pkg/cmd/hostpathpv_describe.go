@@ -64,40 +64,32 @@ var (
 		kubectl hostpathpv describe pvs
 
 		# Describe a pv quota info with specified NAME.
-		kubectl hostpathpv describe pv pvname`)
-)
+		kubectl hostpathpv describe pv pvname
 
-type DiskQuotaDetail struct {
-	pvname    string
-	pvtype    string
-	hostpath  string
-	pod       string
-	container string
-	podpath   string
-	quota     int64
-	used      int64
-}
+		# Describe a node quota info in yaml output format.
+		kubectl hostpathpv describe node nodename -o yaml`)
+)
 
-func NewCmdHostPathPVDescribe(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVDescribe(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "describe (TYPE/NAME ...) [flags]",
 		Short:   T("Describe node pod or pv quota information"),
 		Long:    hostpathpv_describe_long,
 		Example: hostpathpv_describe_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunHostpathPVDescribe(client, out, errOut, cmd, args)
+			err := RunHostpathPVDescribe(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunHostpathPVDescribe err:%v\n", err)
 			}
 		},
 	}
 	cmd.Flags().Bool("filter", true, "Ignored no disk quota resource")
-	cmd.Flags().StringP("namespace", "n", "default", "Namespace")
 	cmd.Flags().Bool("all-namespaces", false, "If present, list the requested object(s) across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
+	AddOutputFlag(cmd, "json|yaml|jsonpath=...|custom-columns=...")
 	return cmd
 }
 
-func RunHostpathPVDescribe(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunHostpathPVDescribe(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", hostpathpv_describe_valid_resources)
 		usageString := "Required resource not specified."
@@ -106,7 +98,27 @@ func RunHostpathPVDescribe(clientset *kubernetes.Clientset, out, errOut io.Write
 
 	resource := args[0]
 	filter := GetFlagBool(cmd, "filter")
-	namespaces := GetFlagString(cmd, "namespace")
+	output := GetFlagString(cmd, "output")
+	if output == "wide" {
+		return UsageErrorf(cmd, "describe does not support -o wide")
+	}
+	var printer ResultPrinter = &DescribePrinter{}
+	if output != "" {
+		p, err := NewResultPrinter(output)
+		if err != nil {
+			return UsageErrorf(cmd, "%v", err)
+		}
+		printer = p
+	}
+	list := NewQuotaList()
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	namespaces, err := f.Namespace()
+	if err != nil {
+		return err
+	}
 	allNamespaces := GetFlagBool(cmd, "all-namespaces")
 	if allNamespaces == true {
 		namespaces = metav1.NamespaceAll
@@ -127,77 +139,28 @@ func RunHostpathPVDescribe(clientset *kubernetes.Clientset, out, errOut io.Write
 				}
 			}
 		}
-		describePods(clientset, namespaces, podName, filter)
+		err = describePods(clientset, list, namespaces, podName, filter)
 	case resource == "nodes" || resource == "node":
 		nodeName := ""
 		if len(args) >= 2 {
 			nodeName = args[1]
 		}
-		describeNodes(clientset, nodeName, filter)
+		err = describeNodes(clientset, list, nodeName, filter)
 	case resource == "pvs" || resource == "pv":
 		pvName := ""
 		if len(args) >= 2 {
 			pvName = args[1]
 		}
-		describePVs(clientset, pvName, filter)
+		err = describePVs(clientset, list, pvName, filter)
 	default:
 		fmt.Fprint(errOut, "You must specify the type of resource to describe. ", hostpathpv_describe_valid_resources)
 		usageString := "Required resource not suport."
 		return UsageErrorf(cmd, usageString)
 	}
-
-	return nil
-}
-
-func describePods(clientset *kubernetes.Clientset, namespaces, podName string, filter bool) {
-	pods, err := clientset.Core().Pods(namespaces).List(metav1.ListOptions{})
 	if err != nil {
-		return
-	}
-	if len(pods.Items) == 0 {
-		return
+		return err
 	}
-	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
-
-	for i, _ := range pods.Items {
-		pod := &pods.Items[i]
-		if podName != "" && podName != pod.Name {
-			continue
-		}
-		displayer := NewDisplayer("  ", "  ", "PV", "HostPath", "Container", "PodPath", "Type", "Quota", "Used")
-		//displayer.AddCutOffLine("-")
-		var needPrint bool
-		for _, podVolume := range pod.Spec.Volumes {
-			if pvcSource := podVolume.VolumeSource.PersistentVolumeClaim; pvcSource != nil {
-				pvname, hostPath, pvtype, quota, used := getPodMountHostPathByPvc(pvcSource.ClaimName, pod, pvs)
-				if hostPath != "" {
-					needPrint = true
-					containers, podPaths := getPodPathByVolumeName(podVolume.Name, pod)
-					if len(containers) > 0 && len(containers) == len(podPaths) {
-						for j, container := range containers {
-							displayer.AddLine(pvname, hostPath, container, podPaths[j], pvtype,
-								convertIntToString(quota),
-								convertIntToString(used)+getPercentStr(used, quota))
-						}
-					}
-					if len(containers) == 0 {
-						displayer.AddLine(pvname, hostPath, "***", "***", pvtype,
-							convertIntToString(quota),
-							convertIntToString(used)+getPercentStr(used, quota))
-					}
-				}
-			}
-		}
-		if filter && needPrint {
-			fmt.Printf("Name:\t\t %s\n", pod.Name)
-			fmt.Printf("Namespace:\t %s\n", pod.Namespace)
-			fmt.Printf("Node:\t\t %s\n", pod.Spec.NodeName)
-			fmt.Printf("HostPath Mount:\n")
-			displayer.Print(true)
-			fmt.Printf("\n\n")
-		}
-	}
-
+	return printer.PrintResult(list, out)
 }
 
 func getPodMountHostPathByPvc(pvcSource string, pod *v1.Pod, pvs *v1.PersistentVolumeList) (pvname, hostPath, pvtype string, quota, used int64) {
@@ -292,308 +255,338 @@ func getDisableStr(disable bool) string {
 		return "OK"
 	}
 }
-func describeNodes(clientset *kubernetes.Clientset, nodeName string, filter bool) {
-	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+func getPodByUID(uid string, pods *v1.PodList) *v1.Pod {
+	for i, _ := range pods.Items {
+		if string(pods.Items[i].UID) == uid {
+			return &pods.Items[i]
+		}
+	}
+	return nil
+}
+func describePods(clientset *kubernetes.Clientset, list *QuotaList, namespaces, podName string, filter bool) error {
+	pods, err := clientset.Core().Pods(namespaces).List(metav1.ListOptions{})
 	if err != nil {
-		return
+		return fmt.Errorf("list pods err:%v", err)
 	}
-	if len(nodes.Items) == 0 {
-		return
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	for i, _ := range pods.Items {
+		pod := &pods.Items[i]
+		if podName != "" && podName != pod.Name {
+			continue
+		}
+		used, keep, none, share, hostpathpvnum := getPodQuotaInfo(pod, pvs)
+		podQuota := &PodQuota{
+			Kind:          QuotaKindPod,
+			Namespace:     pod.Namespace,
+			Name:          pod.Name,
+			Status:        string(pod.Status.Phase),
+			HostPathPVNum: hostpathpvnum,
+			Quota:         keep + none + share,
+			Used:          used,
+			Keep:          keep,
+			None:          none,
+			Share:         share,
+			PodIP:         pod.Status.PodIP,
+			HostIP:        pod.Status.HostIP,
+			NodeName:      pod.Spec.NodeName,
+			Paths:         []PathQuota{},
+		}
+		for _, podVolume := range pod.Spec.Volumes {
+			if pvcSource := podVolume.VolumeSource.PersistentVolumeClaim; pvcSource != nil {
+				pvname, hostPath, pvtype, quota, used := getPodMountHostPathByPvc(pvcSource.ClaimName, pod, pvs)
+				if hostPath == "" {
+					continue
+				}
+				containers, podPaths := getPodPathByVolumeName(podVolume.Name, pod)
+				if len(containers) == 0 || len(containers) != len(podPaths) {
+					containers, podPaths = []string{""}, []string{""}
+				}
+				for j, container := range containers {
+					podQuota.Paths = append(podQuota.Paths, PathQuota{PV: pvname, Type: pvtype, NodeName: pod.Spec.NodeName,
+						HostPath: hostPath, Pod: pod.Namespace + "/" + pod.Name, Container: container, PodPath: podPaths[j],
+						Quota: quota, Used: used})
+				}
+			}
+		}
+		if filter && len(podQuota.Paths) == 0 {
+			continue
+		}
+		list.Items = append(list.Items, podQuota)
+	}
+	return nil
+}
+
+func describeNodes(clientset *kubernetes.Clientset, list *QuotaList, nodeName string, filter bool) error {
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes err:%v", err)
 	}
 	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
 	pods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
-
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
 	for i, _ := range nodes.Items {
 		node := &nodes.Items[i]
 		if nodeName != "" && nodeName != node.Name {
 			continue
 		}
-
-		displayer1 := NewDisplayer("   ", "  ", "DiskPath", "Capacity", "Quota", "Used", "PathNum", "Keep", "None", "Share", "Status")
-		//displayer1.AddCutOffLine("-")
-
 		quotaInfo := getNodeQuotaInfos(node, pvs)
 		if quotaInfo.diskNum == 0 && filter == true {
 			continue
 		}
-		fmt.Printf("Name:\t\t%s\n", node.Name)
-		fmt.Printf("Quota Disks:\n")
+		nodeQuota := newNodeQuota(quotaInfo)
+		nodeQuota.Disks = make([]DiskQuota, 0, len(quotaInfo.diskInfos))
 		for _, diskInfo := range quotaInfo.diskInfos {
-			displayer1.AddLine(diskInfo.path, convertIntToString(diskInfo.capacity),
-				convertIntToString(diskInfo.keep+diskInfo.none+diskInfo.share)+getPercentStr(diskInfo.keep+diskInfo.none+diskInfo.share, diskInfo.capacity),
-				convertIntToString(diskInfo.used)+getPercentStr(diskInfo.used, diskInfo.capacity),
-				strconv.Itoa(diskInfo.dirNum),
-				convertIntToString(diskInfo.keep), convertIntToString(diskInfo.none),
-				convertIntToString(diskInfo.share), getDisableStr(diskInfo.disabled))
-		}
-		displayer1.Print(true)
-		fmt.Printf("\n")
-		displayers := make([]*Displayer, 0, len(quotaInfo.diskInfos))
-		for _, diskInfo := range quotaInfo.diskInfos {
-			displayer2 := NewDisplayer("  ", " ", "PVName", "Type", "HostPath", "Pod", "PodPath", "Quota", "Used")
-			//displayer2.AddCutOffLine("-")
-			displayers = append(displayers, displayer2)
-			details := getDiskQuotaDetails(diskInfo.path, node, pvs, pods)
-			for _, detail := range details {
-				displayer2.AddLine(detail.pvname, detail.pvtype, path.Base(detail.hostpath), detail.pod+":"+detail.container,
-					detail.podpath, convertIntToString(detail.quota), convertIntToString(detail.used))
-			}
-
+			diskQuota := newDiskQuota(diskInfo)
+			diskQuota.Paths = []PathQuota{}
+			diskQuota.Paths = getDiskPathQuotas(diskInfo.path, node.Name, pvs, pods)
+			nodeQuota.Disks = append(nodeQuota.Disks, diskQuota)
 		}
-		SyncDisplayersColumeLen(displayers)
-		for i, diskInfo := range quotaInfo.diskInfos {
-			fmt.Printf("%s quota info(%d) [%s]:\n", diskInfo.path, diskInfo.dirNum, getDisableStr(diskInfo.disabled))
-			displayers[i].Print(true)
-			fmt.Printf("\n")
-		}
-
-		fmt.Printf("\n\n")
+		list.Items = append(list.Items, nodeQuota)
 	}
+	return nil
 }
 
-func getDiskQuotaDetails(diskpath string, node *v1.Node, pvs *v1.PersistentVolumeList, pods *v1.PodList) []DiskQuotaDetail {
-	ret := make([]DiskQuotaDetail, 0, 10)
-	for _, pv := range pvs.Items {
-		if algorithm.IsCommonHostPathPV(&pv) == false {
+func describePVs(clientset *kubernetes.Clientset, list *QuotaList, pvName string, filter bool) error {
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	pods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if (pvName != "" && pv.Name != pvName) || algorithm.IsCommonHostPathPV(pv) == false {
 			continue
 		}
 		if pv.Annotations == nil || pv.Annotations[xfs.PVVolumeHostPathMountNode] == "" {
 			continue
 		}
-		mountInfo := pv.Annotations[xfs.PVVolumeHostPathMountNode]
-
 		mountList := hostpath.HostPathPVMountInfoList{}
-		errUmarshal := json.Unmarshal([]byte(mountInfo), &mountList)
+		errUmarshal := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList)
 		if errUmarshal != nil {
 			continue
 		}
-
+		if filter && len(mountList) == 0 {
+			continue
+		}
+		pvQuota := &PVQuota{
+			Kind:       QuotaKindPV,
+			Name:       pv.Name,
+			Status:     string(pv.Status.Phase),
+			Type:       getPVTypeStr(pv),
+			NodeNum:    len(mountList),
+			Capacity:   getPVCapacity(pv),
+			MountNodes: []string{},
+			Mounts:     make([]PVNodeQuota, 0, len(mountList)),
+		}
 		for _, item := range mountList {
-			if item.NodeName == node.Name {
-				for _, mountInfo := range item.MountInfos {
-					if strings.HasPrefix(path.Clean(mountInfo.HostPath), diskpath) {
-						if mountInfo.PodInfo != nil { // PodInfo != nil only for keeptrue and nonetrue pv
-							_, _, uid := getPodInfo(mountInfo.PodInfo.Info)
-							pod := getPodByUID(uid, pods)
-							if pod != nil && pv.Spec.ClaimRef != nil {
-								containers, paths := getPodPathByPVCName(pv.Spec.ClaimRef.Name, pod)
-								for i, container := range containers {
-									if i == 0 { // more than one container share the same hostpath only show the first
-										ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-											pod: pod.Namespace + "/" + pod.Name, container: container, podpath: paths[i], quota: mountInfo.VolumeQuotaSize,
-											used: mountInfo.VolumeCurrentSize,
-										})
-									} else {
-										ret = append(ret, DiskQuotaDetail{pvname: "", pvtype: "", hostpath: "",
-											pod: pod.Namespace + "/" + pod.Name, container: container, podpath: paths[i], quota: mountInfo.VolumeQuotaSize,
-											used: mountInfo.VolumeCurrentSize,
-										})
-									}
-								}
-								if len(containers) == 0 && len(paths) == 0 {
-									ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-										pod: pod.Namespace + "/" + pod.Name, container: "***", podpath: "***", quota: mountInfo.VolumeQuotaSize,
-										used: mountInfo.VolumeCurrentSize,
-									})
-								}
-							} else {
-								ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-									pod: "***", container: "***", podpath: "", quota: mountInfo.VolumeQuotaSize,
-									used: mountInfo.VolumeCurrentSize,
-								})
-							}
-						} else { // PodInfo == nil only for keepfalse and nonefalse pv
-							if pv.Spec.ClaimRef == nil || getPVTypeStr(&pv) == "KeepTrue" || getPVTypeStr(&pv) == "NoneTrue" {
-								ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-									pod: "***", container: "***", podpath: "", quota: mountInfo.VolumeQuotaSize,
-									used: mountInfo.VolumeCurrentSize,
-								})
-								continue
-							}
-							pvPods := getPodsWithPVCOfNode(pv.Spec.ClaimRef.Name, node.Name, pv.Spec.ClaimRef.Namespace, pods)
-							if len(pvPods) > 0 {
-								var index int
-								for _, pvPod := range pvPods {
-									containers, paths := getPodPathByPVCName(pv.Spec.ClaimRef.Name, pvPod)
-									for i, container := range containers {
-										if index == 0 { // share the same hostpath the first show the pv name type and hostpath
-											ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-												pod: pvPod.Namespace + "/" + pvPod.Name, container: container, podpath: paths[i], quota: mountInfo.VolumeQuotaSize,
-												used: mountInfo.VolumeCurrentSize,
-											})
-										} else { // share the same hostpath others not show the pv name type and hostpath
-											ret = append(ret, DiskQuotaDetail{pvname: "", pvtype: "", hostpath: "",
-												pod: pvPod.Namespace + "/" + pvPod.Name, container: container, podpath: paths[i], quota: mountInfo.VolumeQuotaSize,
-												used: mountInfo.VolumeCurrentSize,
-											})
-										}
-										index++
-									}
-									if len(containers) == 0 && len(paths) == 0 {
-										if index == 0 {
-											ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-												pod: pvPod.Namespace + "/" + pvPod.Name, container: "***", podpath: "***", quota: mountInfo.VolumeQuotaSize,
-												used: mountInfo.VolumeCurrentSize,
-											})
-										} else {
-											ret = append(ret, DiskQuotaDetail{pvname: "", pvtype: "", hostpath: "",
-												pod: pvPod.Namespace + "/" + pvPod.Name, container: "***", podpath: "***", quota: mountInfo.VolumeQuotaSize,
-												used: mountInfo.VolumeCurrentSize,
-											})
-										}
-										index++
-									}
-								}
-							} else { // pod is deleted
-								ret = append(ret, DiskQuotaDetail{pvname: pv.Name, pvtype: getPVTypeStr(&pv), hostpath: mountInfo.HostPath,
-									pod: "***", container: "***", podpath: "", quota: mountInfo.VolumeQuotaSize,
-									used: mountInfo.VolumeCurrentSize,
-								})
-							}
-
-						}
-					}
-				}
+			nodeQuota := PVNodeQuota{NodeName: item.NodeName, Paths: make([]PathQuota, 0, len(item.MountInfos))}
+			for _, mountInfo := range item.MountInfos {
+				nodeQuota.Paths = append(nodeQuota.Paths, getMountPathQuotas(pv, item.NodeName, mountInfo, pods)...)
+				pvQuota.Quota += mountInfo.VolumeQuotaSize
+				pvQuota.Used += mountInfo.VolumeCurrentSize
+				pvQuota.PathNum++
 			}
+			pvQuota.MountNodes = append(pvQuota.MountNodes, item.NodeName)
+			pvQuota.Mounts = append(pvQuota.Mounts, nodeQuota)
 		}
-	}
-	return ret
-}
-
-func getPodByUID(uid string, pods *v1.PodList) *v1.Pod {
-	for i, _ := range pods.Items {
-		if string(pods.Items[i].UID) == uid {
-			return &pods.Items[i]
-		}
+		list.Items = append(list.Items, pvQuota)
 	}
 	return nil
 }
-func describePVs(clientset *kubernetes.Clientset, pvName string, filter bool) {
-	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
-	if err != nil {
-		fmt.Printf("describe pv get pv err:%v\n", err)
-		return
-	}
-	pods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
-	if err != nil {
-		fmt.Printf("describe pv get pod err:%v\n", err)
-		return
-	}
-	for _, pv := range pvs.Items {
-		if pvName != "" && pv.Name != pvName {
-			continue
-		}
-		if algorithm.IsCommonHostPathPV(&pv) == false {
+
+// getDiskPathQuotas returns the rows of the quota paths of nodeName under diskPath.
+func getDiskPathQuotas(diskPath, nodeName string, pvs *v1.PersistentVolumeList, pods *v1.PodList) []PathQuota {
+	ret := make([]PathQuota, 0, 10)
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if algorithm.IsCommonHostPathPV(pv) == false {
 			continue
 		}
-
 		if pv.Annotations == nil || pv.Annotations[xfs.PVVolumeHostPathMountNode] == "" {
 			continue
 		}
-		mountInfo := pv.Annotations[xfs.PVVolumeHostPathMountNode]
-
 		mountList := hostpath.HostPathPVMountInfoList{}
-		errUmarshal := json.Unmarshal([]byte(mountInfo), &mountList)
+		errUmarshal := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList)
 		if errUmarshal != nil {
 			continue
 		}
-		if filter && len(mountList) == 0 {
-			continue
-		}
-		fmt.Printf("PVName:\t\t%s\n", pv.Name)
-		fmt.Printf("PVType:\t\t%s\n", getPVTypeStr(&pv))
-		fmt.Printf("Capacity:\t%s\n", strings.Trim(convertIntToString(getPVCapacity(&pv)), " "))
-		fmt.Printf("MountNodes:\t%d\n", len(mountList))
-		var sumQuota, sumUsed int64
-		displayers := make([]*Displayer, 0, len(mountList))
 		for _, item := range mountList {
-			displayer := NewDisplayer("   ", "  ", "HostPath", "Pod", "PodPath", "Quota", "Used")
-			//displayer.AddCutOffLine("-")
-			displayers = append(displayers, displayer)
+			if item.NodeName != nodeName {
+				continue
+			}
 			for _, mountInfo := range item.MountInfos {
-				sumQuota += mountInfo.VolumeQuotaSize
-				sumUsed += mountInfo.VolumeCurrentSize
-				if mountInfo.PodInfo != nil {
-					_, _, uid := getPodInfo(mountInfo.PodInfo.Info)
-					pod := getPodByUID(uid, pods)
-					if pod != nil {
-						if pv.Spec.ClaimRef != nil {
-							containers, paths := getPodPathByPVCName(pv.Spec.ClaimRef.Name, pod)
-							for i, container := range containers {
-								var hostPath string
-								if i == 0 {
-									hostPath = mountInfo.HostPath
-								}
-								displayer.AddLine(hostPath, pod.Namespace+"/"+pod.Name+":"+container, paths[i],
-									convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-							}
-							if len(containers) == 0 && len(paths) == 0 {
-								displayer.AddLine(mountInfo.HostPath, pod.Namespace+"/"+pod.Name+":"+"***", "***",
-									convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-
-							}
-						} else {
-							displayer.AddLine(mountInfo.HostPath, pod.Namespace+"/"+pod.Name+":"+"Unknow", "Unknow",
-								convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-						}
-					} else {
-						displayer.AddLine(mountInfo.HostPath, "***", "***",
-							convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-					}
-				} else {
-					if pv.Spec.ClaimRef != nil {
-						if getPVTypeStr(&pv) != "KeepTrue" && getPVTypeStr(&pv) != "NoneTrue" {
-							pvPods := getPodsWithPVCOfNode(pv.Spec.ClaimRef.Name, item.NodeName, pv.Spec.ClaimRef.Namespace, pods)
-							var index int
-							for _, pvPod := range pvPods {
-								containers, paths := getPodPathByPVCName(pv.Spec.ClaimRef.Name, pvPod)
-								for i, container := range containers {
-									var hostpath string
-									if index == 0 {
-										hostpath = mountInfo.HostPath
-
-									}
-									displayer.AddLine(hostpath, pvPod.Namespace+"/"+pvPod.Name+":"+container, paths[i],
-										convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-									index++
-								}
-								if len(containers) == 0 && len(paths) == 0 {
-									if index == 0 {
-										displayer.AddLine(mountInfo.HostPath, pvPod.Namespace+"/"+pvPod.Name+":"+"***", "***",
-											convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-									} else {
-										displayer.AddLine("", pvPod.Namespace+"/"+pvPod.Name+":"+"***", "***",
-											convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-									}
-									index++
-								}
-							}
-							if len(pvPods) == 0 {
-								displayer.AddLine(mountInfo.HostPath, "***", "***",
-									convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-							}
-						} else {
-							displayer.AddLine(mountInfo.HostPath, "***", "***",
-								convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-						}
-
-					} else {
-						displayer.AddLine(mountInfo.HostPath, "Unknow", "Unknow",
-							convertIntToString(mountInfo.VolumeQuotaSize), convertIntToString(mountInfo.VolumeCurrentSize))
-					}
+				if strings.HasPrefix(path.Clean(mountInfo.HostPath), diskPath) {
+					ret = append(ret, getMountPathQuotas(pv, nodeName, mountInfo, pods)...)
 				}
 			}
+		}
+	}
+	return ret
+}
+
+// getMountPathQuotas returns the rows of a quota path of pv on nodeName, one
+// for every container of the pods which use it, or one without a pod if no
+// pod uses it.
+func getMountPathQuotas(pv *v1.PersistentVolume, nodeName string, mountInfo hostpath.MountInfo, pods *v1.PodList) []PathQuota {
+	row := PathQuota{PV: pv.Name, Type: getPVTypeStr(pv), NodeName: nodeName, HostPath: mountInfo.HostPath,
+		Quota: mountInfo.VolumeQuotaSize, Used: mountInfo.VolumeCurrentSize, FileNum: mountInfo.VolumeCurrentFileNum}
+	usePods := make([]*v1.Pod, 0, 1)
+	if mountInfo.PodInfo != nil { // PodInfo != nil only for keeptrue and nonetrue pv
+		_, _, uid := getPodInfo(mountInfo.PodInfo.Info)
+		if pod := getPodByUID(uid, pods); pod != nil {
+			usePods = append(usePods, pod)
+		}
+	} else if pv.Spec.ClaimRef != nil && row.Type != "KeepTrue" && row.Type != "NoneTrue" {
+		usePods = getPodsWithPVCOfNode(pv.Spec.ClaimRef.Name, nodeName, pv.Spec.ClaimRef.Namespace, pods)
+	}
+	ret := make([]PathQuota, 0, len(usePods)+1)
+	for _, pod := range usePods {
+		row.Pod = pod.Namespace + "/" + pod.Name
+		var containers, podPaths []string
+		if pv.Spec.ClaimRef != nil {
+			containers, podPaths = getPodPathByPVCName(pv.Spec.ClaimRef.Name, pod)
+		}
+		if len(containers) == 0 {
+			ret = append(ret, row)
+		}
+		for i, container := range containers {
+			row.Container, row.PodPath = container, podPaths[i]
+			ret = append(ret, row)
+		}
+		row.Container, row.PodPath = "", ""
+	}
+	if len(ret) == 0 {
+		ret = append(ret, row)
+	}
+	return ret
+}
+
+// DescribePrinter prints the details of every pod, node and pv of describe.
+type DescribePrinter struct{}
+
+func (p *DescribePrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	for _, item := range list.Items {
+		switch t := item.(type) {
+		case *PodQuota:
+			p.printPod(t, out)
+		case *NodeQuota:
+			p.printNode(t, out)
+		case *PVQuota:
+			p.printPV(t, out)
+		}
+	}
+	return nil
+}
+
+func (p *DescribePrinter) printPod(pod *PodQuota, out io.Writer) {
+	displayer := NewDisplayer("  ", "  ", "PV", "HostPath", "Container", "PodPath", "Type", "Quota", "Used")
+	for _, row := range pod.Paths {
+		container, podPath := row.Container, row.PodPath
+		if container == "" {
+			container, podPath = "***", "***"
+		}
+		displayer.AddLine(row.PV, row.HostPath, container, podPath, row.Type, convertIntToString(row.Quota),
+			convertIntToString(row.Used)+getPercentStr(row.Used, row.Quota))
+	}
+	fmt.Fprintf(out, "Name:\t\t %s\n", pod.Name)
+	fmt.Fprintf(out, "Namespace:\t %s\n", pod.Namespace)
+	fmt.Fprintf(out, "Node:\t\t %s\n", pod.NodeName)
+	fmt.Fprintf(out, "HostPath Mount:\n")
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "\n\n")
+}
 
+func (p *DescribePrinter) printNode(node *NodeQuota, out io.Writer) {
+	fmt.Fprintf(out, "Name:\t\t%s\n", node.Name)
+	fmt.Fprintf(out, "Quota Disks:\n")
+	displayer := NewDisplayer("   ", "  ", "DiskPath", "Capacity", "Quota", "Used", "PathNum", "Keep", "None", "Share", "Status")
+	for _, disk := range node.Disks {
+		displayer.AddLine(disk.Path, convertIntToString(disk.Capacity),
+			convertIntToString(disk.Quota)+getPercentStr(disk.Quota, disk.Capacity),
+			convertIntToString(disk.Used)+getPercentStr(disk.Used, disk.Capacity),
+			strconv.Itoa(disk.PathNum), convertIntToString(disk.Keep), convertIntToString(disk.None),
+			convertIntToString(disk.Share), getDisableStr(disk.Disabled))
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "\n")
+
+	displayers := make([]*Displayer, 0, len(node.Disks))
+	for _, disk := range node.Disks {
+		displayer := NewDisplayer("  ", " ", "PVName", "Type", "HostPath", "Pod", "PodPath", "Quota", "Used")
+		for i, row := range disk.Paths {
+			pvName, pvType, hostPath := row.PV, row.Type, path.Base(row.HostPath)
+			if i > 0 && disk.Paths[i-1].PV == row.PV && disk.Paths[i-1].HostPath == row.HostPath {
+				// more pods or containers share the quota path, only the first shows it
+				pvName, pvType, hostPath = "", "", ""
+			}
+			pod, podPath := getDescribePodStr(row)
+			displayer.AddLine(pvName, pvType, hostPath, pod, podPath, convertIntToString(row.Quota), convertIntToString(row.Used))
 		}
-		fmt.Printf("AllQuota:\t%s\n", strings.Trim(convertIntToString(sumQuota), " "))
-		fmt.Printf("AllUsed:\t%s\n", strings.Trim(convertIntToString(sumUsed)+getPercentStr(sumUsed, sumQuota), " "))
-		SyncDisplayersColumeLen(displayers)
-		for i, item := range mountList {
-			fmt.Printf("%s: (Create quota path num %d)\n", item.NodeName, len(item.MountInfos))
-			displayers[i].Print(true)
-			fmt.Printf("\n")
+		displayers = append(displayers, displayer)
+	}
+	SyncDisplayersColumeLen(displayers)
+	for i, disk := range node.Disks {
+		fmt.Fprintf(out, "%s quota info(%d) [%s]:\n", disk.Path, disk.PathNum, getDisableStr(disk.Disabled))
+		displayers[i].Fprint(out, true)
+		fmt.Fprintf(out, "\n")
+	}
+	fmt.Fprintf(out, "\n\n")
+}
+
+func (p *DescribePrinter) printPV(pv *PVQuota, out io.Writer) {
+	fmt.Fprintf(out, "PVName:\t\t%s\n", pv.Name)
+	fmt.Fprintf(out, "PVType:\t\t%s\n", pv.Type)
+	fmt.Fprintf(out, "Capacity:\t%s\n", strings.Trim(convertIntToString(pv.Capacity), " "))
+	fmt.Fprintf(out, "MountNodes:\t%d\n", pv.NodeNum)
+	fmt.Fprintf(out, "AllQuota:\t%s\n", strings.Trim(convertIntToString(pv.Quota), " "))
+	fmt.Fprintf(out, "AllUsed:\t%s\n", strings.Trim(convertIntToString(pv.Used)+getPercentStr(pv.Used, pv.Quota), " "))
+
+	displayers := make([]*Displayer, 0, len(pv.Mounts))
+	pathNums := make([]int, 0, len(pv.Mounts))
+	for _, mount := range pv.Mounts {
+		displayer := NewDisplayer("   ", "  ", "HostPath", "Pod", "PodPath", "Quota", "Used")
+		var pathNum int
+		for i, row := range mount.Paths {
+			hostPath := row.HostPath
+			if i > 0 && mount.Paths[i-1].HostPath == row.HostPath {
+				hostPath = ""
+			} else {
+				pathNum++
+			}
+			pod, podPath := getDescribePodStr(row)
+			displayer.AddLine(hostPath, pod, podPath, convertIntToString(row.Quota), convertIntToString(row.Used))
 		}
+		displayers = append(displayers, displayer)
+		pathNums = append(pathNums, pathNum)
+	}
+	SyncDisplayersColumeLen(displayers)
+	for i, mount := range pv.Mounts {
+		fmt.Fprintf(out, "%s: (Create quota path num %d)\n", mount.NodeName, pathNums[i])
+		displayers[i].Fprint(out, true)
+		fmt.Fprintf(out, "\n")
+	}
+	fmt.Fprintf(out, "\n\n")
+}
 
-		fmt.Printf("\n\n")
+// getDescribePodStr returns the pod and pod path columns of row, *** is a
+// pod which is not found or a pod without a mount of the quota path.
+func getDescribePodStr(row PathQuota) (string, string) {
+	if row.Pod == "" {
+		return "***", "***"
+	}
+	if row.Container == "" {
+		return row.Pod + ":***", "***"
 	}
+	return row.Pod + ":" + row.Container, row.PodPath
 }
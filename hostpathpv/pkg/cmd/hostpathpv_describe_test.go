@@ -0,0 +1,79 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPVCPod(name, nodeName, claimName string, containers ...string) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Volumes: []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claimName}}}},
+		},
+	}
+	for _, c := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: c,
+			VolumeMounts: []v1.VolumeMount{{Name: "data", MountPath: "/data/" + c}}})
+	}
+	return pod
+}
+
+func TestGetMountPathQuotas(t *testing.T) {
+	pv := NewTmpHostPathPV("pv1")
+	pv.Spec.ClaimRef = &v1.ObjectReference{Namespace: "default", Name: "claim1"}
+	pods := &v1.PodList{Items: []v1.Pod{
+		newTestPVCPod("web-0", "node1", "claim1", "web", "sidecar"),
+		newTestPVCPod("web-1", "node1", "claim1"),
+		newTestPVCPod("web-2", "node2", "claim1", "web"),
+	}}
+	mountInfo := hostpath.MountInfo{HostPath: "/xfs/disk1/p1", VolumeQuotaSize: 100, VolumeCurrentSize: 10}
+
+	rows := getMountPathQuotas(pv, "node1", mountInfo, pods)
+	got := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.PV != "pv1" || row.HostPath != "/xfs/disk1/p1" || row.Quota != 100 || row.Used != 10 {
+			t.Errorf("row %+v does not have the quota path", row)
+		}
+		pod, podPath := getDescribePodStr(row)
+		got = append(got, pod+" "+podPath)
+	}
+	want := []string{"default/web-0:web /data/web", "default/web-0:sidecar /data/sidecar", "default/web-1:*** ***"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+
+	if rows := getMountPathQuotas(pv, "node3", mountInfo, pods); len(rows) != 1 || rows[0].Pod != "" {
+		t.Errorf("a quota path without pods has rows %+v, want one without a pod", rows)
+	}
+
+	// the quota path is shown only on the first row of the shared quota path
+	node := &NodeQuota{Name: "node1", Disks: []DiskQuota{{Path: "/xfs/disk1", PathNum: 1, Paths: rows}}}
+	out := &bytes.Buffer{}
+	(&DescribePrinter{}).PrintResult(&QuotaList{Items: []interface{}{node}}, out)
+	if n := strings.Count(out.String(), " p1 "); n != 1 {
+		t.Errorf("quota path is shown %d times, want 1:\n%s", n, out.String())
+	}
+}
@@ -53,14 +53,14 @@ var (
 		`)
 )
 
-func NewCmdHostPathPVDisable(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVDisable(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "setdisable (TYPE/NAME ...) [flags]",
 		Short:   T("Disable or unDisable node quota disk"),
 		Long:    disable_long,
 		Example: disable_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunDisable(client, out, errOut, cmd, args)
+			err := RunDisable(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunDisable err:%v\n", err)
 			}
@@ -71,7 +71,7 @@ func NewCmdHostPathPVDisable(client *kubernetes.Clientset, out io.Writer, errOut
 	return cmd
 }
 
-func RunDisable(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunDisable(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to disable. ", disable_valid_resources)
 		usageString := "Required resource not specified."
@@ -85,16 +85,21 @@ func RunDisable(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cob
 	if diskpath == "" {
 		return fmt.Errorf("please input diskpath")
 	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "nodes" || resource == "node":
 		nodeName := ""
 		if len(args) >= 2 {
 			nodeName = args[1]
 		}
-		err := disableNode(clientset, nodeName, diskpath, disable)
+		dryRun := isDryRun(cmd)
+		err := disableNode(clientset, nodeName, diskpath, disable, dryRun)
 		if err != nil {
 			fmt.Fprintf(errOut, "disable err: %v\n", err)
-		} else {
+		} else if dryRun == false {
 			fmt.Fprintf(out, "set success\n")
 		}
 	default:
@@ -106,27 +111,34 @@ func RunDisable(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cob
 	return nil
 }
 
-func disableNode(clientset *kubernetes.Clientset, nodeName, diskpath string, disable bool) error {
-	node, errGetNode := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
-	if errGetNode != nil {
-		return fmt.Errorf("get node err:%v", errGetNode)
-	}
-	list := getNodeQuotaDisks(node)
-	for _, disk := range list {
-		if path.Clean(disk.MountPath) == path.Clean(diskpath) {
-			if disk.Disabled == disable {
-				return nil
-			} else {
-				changed := addOrRemoveNodeDisableDisk(node, diskpath, disable)
-				if changed == false {
-					return nil
+func disableNode(clientset *kubernetes.Clientset, nodeName, diskpath string, disable, dryRun bool) error {
+	setDisable := func(node *v1.Node) (bool, error) {
+		for _, disk := range getNodeQuotaDisks(node) {
+			if path.Clean(disk.MountPath) == path.Clean(diskpath) {
+				if disk.Disabled == disable {
+					return false, nil
 				}
-				_, errUpdate := clientset.Core().Nodes().Update(node)
-				return errUpdate
+				return addOrRemoveNodeDisableDisk(node, diskpath, disable), nil
 			}
 		}
+		return false, fmt.Errorf("%s is not in quota disks", diskpath)
+	}
+	if dryRun {
+		node, errGetNode := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+		if errGetNode != nil {
+			return fmt.Errorf("get node err:%v", errGetNode)
+		}
+		newNode := node.DeepCopy()
+		if _, err := setDisable(newNode); err != nil {
+			return err
+		}
+		plan := NewDryRunPlan()
+		plan.UpdateNode(node, newNode)
+		plan.Print()
+		return nil
 	}
-	return fmt.Errorf("%s is not in quota disks", diskpath)
+	_, err := mutateNode(clientset, nodeName, setDisable)
+	return err
 }
 
 func addOrRemoveNodeDisableDisk(node *v1.Node, diskpath string, add bool) (changed bool) {
@@ -17,6 +17,8 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 type Displayer struct {
@@ -88,29 +90,27 @@ func SyncDisplayersColumeLen(displayers []*Displayer) {
 }
 
 func (d *Displayer) Print(needUnderLine bool) {
+	d.Fprint(os.Stdout, needUnderLine)
+}
+
+func (d *Displayer) Fprint(out io.Writer, needUnderLine bool) {
 	for i, title := range d.titles {
-		fmt.Printf("%s%s%s%s", d.prefix, title, getNumSpace(d.maxColumeLen[i]-len(title), " "), d.space)
+		fmt.Fprintf(out, "%s%s%s%s", d.prefix, title, getNumSpace(d.maxColumeLen[i]-len(title), " "), d.space)
 	}
-	fmt.Printf("\n")
+	fmt.Fprintf(out, "\n")
 	if needUnderLine {
 		for i := 0; i < len(d.titles); i++ {
-			fmt.Printf("%s%s%s", d.prefix, getNumSpace(d.maxColumeLen[i], "-"), d.space)
+			fmt.Fprintf(out, "%s%s%s", d.prefix, getNumSpace(d.maxColumeLen[i], "-"), d.space)
 		}
-		fmt.Printf("\n")
+		fmt.Fprintf(out, "\n")
 	}
 
 	for _, lineContent := range d.content {
 		for i, content := range lineContent {
-			fmt.Printf("%s%s%s%s", d.prefix, content, getNumSpace(d.maxColumeLen[i]-len(content), " "), d.space)
+			fmt.Fprintf(out, "%s%s%s%s", d.prefix, content, getNumSpace(d.maxColumeLen[i]-len(content), " "), d.space)
 		}
-		fmt.Printf("\n")
+		fmt.Fprintf(out, "\n")
 	}
-	/*if needUnderLine {
-		for i := 0; i < len(d.titles); i++ {
-			fmt.Printf("%s%s%s", d.prefix, getNumSpace(d.maxColumeLen[i], "-"), d.space)
-		}
-		fmt.Printf("\n")
-	}*/
 }
 
 func getNumSpace(num int, space string) string {
@@ -0,0 +1,176 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+)
+
+var (
+	drain_long = templates.LongDesc(`
+		Move all the keep quota paths of a node to other nodes, e.g. before its hardware
+		maintenance.
+
+		The keep quota paths of every pod on the node are moved together by one node to
+		node move like move node --from --to. The to node of a pod is the one of --to,
+		or of all the ready and scheduleable nodes if it is not given, with the most free
+		quota where all its quota paths fit, every quota path goes to the not disabled
+		disk with the most free quota. The plan is shown before anything is changed.
+
+		The node is set unscheduleable first and is kept unscheduleable. The moves run one
+		by one, or --parallel of them at the same time to different nodes, a failed move
+		does not stop the others and is rolled back if its pv mount paths are not changed
+		yet. A report of all moves is printed at the end, a move stopped after that can
+		be continued with move node --resume=ID.
+		The move flags are the ones of move.`)
+
+	drain_example = templates.Examples(`
+		# Show where the quota paths of node1 would be moved.
+		kubectl hostpathpv drain node node1 --dry-run
+
+		# Move the quota paths of node1 to node2 and node3, 2 moves at a time.
+		kubectl hostpathpv drain node node1 --to=node2,node3 --parallel=2 --verify=true
+		`)
+)
+
+func NewCmdHostPathPVDrain(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "drain node NAME [flags]",
+		Short:   T("Move all keep quota paths of a node to other nodes"),
+		Long:    drain_long,
+		Example: drain_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunDrain(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunDrain err:%v\n", err)
+			}
+		},
+	}
+	cmd.Flags().StringSlice("to", []string{}, "Nodes to move to, all the ready and scheduleable nodes if it is empty")
+	cmd.Flags().Int("parallel", 1, "Max moves at the same time, the moves to one node are always one by one")
+	cmd.Flags().Bool("force", false, "Drain force with no confirmation")
+	addMoveOptionsFlags(cmd)
+	return cmd
+}
+
+func RunDrain(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	if len(args) != 2 || (args[0] != "node" && args[0] != "nodes") {
+		return UsageErrorf(cmd, "Required node NAME")
+	}
+	parallel := GetFlagInt(cmd, "parallel")
+	if parallel < 1 {
+		return UsageErrorf(cmd, "--parallel should be > 0")
+	}
+	toNodes, err := cmd.Flags().GetStringSlice("to")
+	if err != nil {
+		return err
+	}
+	opts, err := getMoveOptions(cmd)
+	if err != nil {
+		return UsageErrorf(cmd, "%v", err)
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	config, err := f.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	return drainNode(clientset, config, args[1], FilterEmptyStr(toNodes), opts, parallel, GetFlagBool(cmd, "force"), isDryRun(cmd), out)
+}
+
+func drainNode(clientset *kubernetes.Clientset, config *rest.Config, nodeName string, toNodes []string, opts moveOptions,
+	parallel int, force, dryRun bool, out io.Writer) error {
+	if stringsContain(toNodes, nodeName) {
+		return fmt.Errorf("can not drain %s to itself", nodeName)
+	}
+	node, err := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get node %s err:%v", nodeName, err)
+	}
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes err:%v", err)
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	allPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+
+	moves, err := groupMovePaths(getNodeKeepQuotaPaths(pvs, nodeName, ""), allPods, pvs, nodeName)
+	if err != nil {
+		return err
+	}
+	if len(moves) == 0 {
+		fmt.Fprintf(out, "Node %s has no keep quota path\n", nodeName)
+		return nil
+	}
+	targets, err := getMoveTargets(nodes, pvs, toNodes, map[string]bool{nodeName: true})
+	if err != nil {
+		return err
+	}
+	for _, move := range moves {
+		if err := placeMove(move, targets); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Drain node %s:\n", nodeName)
+	printMovePlan(moves, out)
+
+	if dryRun {
+		plan := NewDryRunPlan()
+		if node.Spec.Unschedulable == false {
+			plan.SetNodeScheduleable([]string{nodeName}, true)
+		}
+		plan.Print()
+		return printPlannedMovesDryRun(pvs, allPods, moves, opts)
+	}
+	if force == false {
+		fmt.Printf("Are you sure to drain node %s (y/n):", nodeName)
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
+		}
+	}
+	if _, err := SetNodeScheduleable(clientset, []string{nodeName}, true); err != nil {
+		return fmt.Errorf("set node %s unscheduleable err:%v", nodeName, err)
+	}
+	if err := runPlannedMoves(clientset, config, moves, opts, parallel); err != nil {
+		return err
+	}
+	printMoveReport(moves, out)
+	fmt.Fprintf(out, "Node %s is kept unscheduleable\n", nodeName)
+	for _, move := range moves {
+		if move.err != nil {
+			return fmt.Errorf("not all quota paths of %s are moved", nodeName)
+		}
+	}
+	return nil
+}
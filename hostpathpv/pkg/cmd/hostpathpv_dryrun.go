@@ -0,0 +1,122 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+)
+
+const dryRunFlag = "dry-run"
+
+func isDryRun(cmd *cobra.Command) bool {
+	return GetFlagBool(cmd, dryRunFlag)
+}
+
+// DryRunPlan records the changes a mutating command would make, it is printed
+// instead of being applied when --dry-run is set.
+type DryRunPlan struct {
+	lines []string
+}
+
+func NewDryRunPlan() *DryRunPlan {
+	return &DryRunPlan{lines: make([]string, 0)}
+}
+
+func (plan *DryRunPlan) addLine(format string, a ...interface{}) {
+	plan.lines = append(plan.lines, fmt.Sprintf(format, a...))
+}
+
+func (plan *DryRunPlan) UpdatePV(old, cur *v1.PersistentVolume) {
+	plan.addLine("update pv %s:", cur.Name)
+	plan.addDiff(old.Annotations, cur.Annotations)
+}
+
+func (plan *DryRunPlan) UpdateNode(old, cur *v1.Node) {
+	plan.addLine("update node %s:", cur.Name)
+	plan.addDiff(old.Annotations, cur.Annotations)
+}
+
+func (plan *DryRunPlan) addDiff(oldAnn, newAnn map[string]string) {
+	lines := diffAnnotations(oldAnn, newAnn)
+	if len(lines) == 0 {
+		plan.addLine("  no annotation change")
+	}
+	for _, line := range lines {
+		plan.addLine("  %s", line)
+	}
+}
+
+func (plan *DryRunPlan) CreatePV(pv *v1.PersistentVolume) {
+	plan.addLine("create pv %s", pv.Name)
+	plan.addDiff(nil, pv.Annotations)
+}
+
+func (plan *DryRunPlan) DeletePV(pvName string) {
+	plan.addLine("delete pv %s", pvName)
+}
+
+func (plan *DryRunPlan) CreatePod(pod *v1.Pod) {
+	hostPaths := make([]string, 0, len(pod.Spec.Volumes))
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil {
+			hostPaths = append(hostPaths, path.Clean(v.HostPath.Path))
+		}
+	}
+	plan.addLine("create pod %s/%s on node %s with hostpaths %v", pod.Namespace, pod.Name, pod.Spec.NodeName, hostPaths)
+}
+
+func (plan *DryRunPlan) DeletePods(pods []*v1.Pod) {
+	for _, pod := range pods {
+		plan.addLine("delete pod %s/%s on node %s", pod.Namespace, pod.Name, pod.Spec.NodeName)
+	}
+}
+
+func (plan *DryRunPlan) ScaleWorkloads(refs []WorkloadRef, down bool) {
+	for _, ref := range refs {
+		if down {
+			plan.addLine("scale %s from %d to %d replicas", ref, ref.Replicas, ref.ScaledTo)
+		} else {
+			plan.addLine("scale %s back to %d replicas", ref, ref.Replicas)
+		}
+	}
+}
+
+func (plan *DryRunPlan) SetNodeScheduleable(nodeNames []string, unschedulable bool) {
+	for _, nodeName := range nodeNames {
+		if unschedulable {
+			plan.addLine("set node %s unscheduleable", nodeName)
+		} else {
+			plan.addLine("set node %s scheduleable", nodeName)
+		}
+	}
+}
+
+func (plan *DryRunPlan) Print() {
+	plan.Fprint(os.Stdout)
+}
+
+func (plan *DryRunPlan) Fprint(out io.Writer) {
+	fmt.Fprintf(out, "Dry run, nothing is changed:\n")
+	for _, line := range plan.lines {
+		fmt.Fprintf(out, "%s\n", line)
+	}
+}
@@ -0,0 +1,187 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// With the exec transport the from pod and the move pod only sleep, they can
+// be of any image with sh and tar. Every from dir is copied by exec of tar -c
+// in the from pod and tar -x in the move pod, the tar stream goes through this
+// command, so no image has to be built and the pods need not reach each other.
+
+const (
+	moveTransportImage = "image"
+	moveTransportExec  = "exec"
+
+	// default_move_execimage is the move image of the exec transport if
+	// --moveimage is not given.
+	default_move_execimage = "busybox"
+
+	execSleepCmd   = "trap 'exit 0' TERM; while true; do sleep 1; done"
+	execStreamSize = 64 * 1024
+)
+
+func (op *MoveOperation) isExecTransport() bool {
+	return op.Transport == moveTransportExec
+}
+
+// newTmpPodExec makes pod sleep until the move execs in it.
+func newTmpPodExec(pod *v1.Pod) *v1.Pod {
+	pod.Spec.Containers[0].Command = []string{"/bin/sh"}
+	pod.Spec.Containers[0].Args = []string{"-c", execSleepCmd}
+	return pod
+}
+
+func execInPod(clientset *kubernetes.Clientset, config *rest.Config, pod *v1.Pod, cmd string, stdin io.Reader, stdout io.Writer) error {
+	req := clientset.Core().RESTClient().Post().Resource("pods").Name(pod.Name).Namespace(pod.Namespace).SubResource("exec")
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: pod.Spec.Containers[0].Name,
+		Command:   []string{"/bin/sh", "-c", cmd},
+		Stdin:     stdin != nil,
+		Stdout:    stdout != nil,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	err = exec.Stream(remotecommand.StreamOptions{Stdin: stdin, Stdout: stdout, Stderr: stderr})
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%v, %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// execStreamWriter counts the bytes of all tar streams and limits them to the
+// bandwidth cap.
+type execStreamWriter struct {
+	w       io.Writer
+	moved   *int64
+	limiter *rate.Limiter
+}
+
+func (w *execStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > execStreamSize {
+			n = execStreamSize
+		}
+		if w.limiter != nil {
+			time.Sleep(w.limiter.ReserveN(time.Now(), n).Delay())
+		}
+		m, err := w.w.Write(p[:n])
+		written += m
+		atomic.AddInt64(w.moved, int64(m))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// execCopyDir pipes tar of fromDir in podFrom to tar of /todir-index in podTo.
+func execCopyDir(clientset *kubernetes.Clientset, config *rest.Config, podFrom, podTo *v1.Pod, index int, fromDir string,
+	tuning MoveTuning, moved *int64, limiter *rate.Limiter) error {
+	fromDir = path.Clean(fromDir)
+	z := ""
+	if tuning.Compress {
+		z = "z"
+	}
+	tarFrom := fmt.Sprintf("%star -C /fromdir/%s -c%sf - %s", tuning.ioNicePrefix(), path.Base(path.Dir(fromDir)), z, path.Base(fromDir))
+	tarTo := fmt.Sprintf("%star -C /todir-%d -x%sf -", tuning.ioNicePrefix(), index, z)
+
+	pr, pw := io.Pipe()
+	errFrom := make(chan error, 1)
+	go func() {
+		err := execInPod(clientset, config, podFrom, tarFrom, nil, &execStreamWriter{w: pw, moved: moved, limiter: limiter})
+		pw.CloseWithError(err)
+		errFrom <- err
+	}()
+	err := execInPod(clientset, config, podTo, tarTo, pr, nil)
+	pr.CloseWithError(fmt.Errorf("tar in %s quit", podTo.Name))
+	if e := <-errFrom; e != nil {
+		return fmt.Errorf("%s of %s err:%v", tarFrom, podFrom.Name, e)
+	}
+	if err != nil {
+		return fmt.Errorf("%s of %s err:%v", tarTo, podTo.Name, err)
+	}
+	return nil
+}
+
+// execMove copies the from dirs of op from podFrom to podTo and updates
+// progress with the moved bytes every second.
+func execMove(clientset *kubernetes.Clientset, config *rest.Config, op *MoveOperation, podFrom, podTo *v1.Pod,
+	progress *moveProgress) error {
+	var moved int64
+	var limiter *rate.Limiter
+	if op.Tuning.BWLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(op.Tuning.BWLimit*1024*1024), execStreamSize)
+	}
+	stop := make(chan struct{}, 0)
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Second):
+			}
+			progress.update(atomic.LoadInt64(&moved), 0)
+		}
+	}()
+
+	sem := make(chan struct{}, op.Tuning.parallel(len(op.FromDirs)))
+	errs := make([]error, len(op.FromDirs))
+	var wg sync.WaitGroup
+	for i, fromDir := range op.FromDirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, fromDir string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = execCopyDir(clientset, config, podFrom, podTo, i, fromDir, op.Tuning, &moved, limiter)
+		}(i, fromDir)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
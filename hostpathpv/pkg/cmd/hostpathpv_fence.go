@@ -0,0 +1,128 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// While a node to node move copies, the deleted pods must not come back on the
+// from or the to node. The fence of the move decides how:
+//   node  cordons both nodes, nothing else is scheduled to them either.
+//   none  leaves the nodes as they are, only with --scaledown as the scaled
+//         down workloads do not recreate their pods.
+// The pods can not be kept away one by one, a taint or an affinity would keep
+// away every pod which does not tolerate it or roll out the workloads.
+
+const (
+	moveFenceNode = "node"
+	moveFenceNone = "none"
+)
+
+func checkMoveFence(fence string, scaleDown bool) error {
+	switch fence {
+	case moveFenceNode:
+		return nil
+	case moveFenceNone:
+		if scaleDown == false {
+			return fmt.Errorf("--fence=%s needs --scaledown, the deleted pods would come back", moveFenceNone)
+		}
+		return nil
+	}
+	return fmt.Errorf("--fence should be %s or %s", moveFenceNode, moveFenceNone)
+}
+
+// fence returns the fence of op, moves saved before there were fences cordon
+// the nodes.
+func (op *MoveOperation) fence() string {
+	if op.Fence == "" {
+		return moveFenceNode
+	}
+	return op.Fence
+}
+
+func (op *MoveOperation) fenceNodes() []string {
+	if op.FromNode == op.ToNode {
+		return []string{op.FromNode}
+	}
+	return []string{op.FromNode, op.ToNode}
+}
+
+func (op *MoveOperation) fenceStepName() string {
+	if op.fence() == moveFenceNone {
+		return "Skip fence nodes, the workloads are scaled down"
+	}
+	return fmt.Sprintf("Start set node %s, %s unscheduleable", op.FromNode, op.ToNode)
+}
+
+func (op *MoveOperation) unfenceStepName() string {
+	if op.fence() == moveFenceNone {
+		return "Skip unfence nodes"
+	}
+	return fmt.Sprintf("Start set node %v scheduleable", op.UnscheduledNodes)
+}
+
+// fenceMoveNodes keeps the pods of the quota paths of op from the from and the
+// to node. Cordoned nodes are recorded so that only they are uncordoned.
+func fenceMoveNodes(clientset *kubernetes.Clientset, op *MoveOperation, nodeFrom, nodeTo *v1.Node) error {
+	if op.fence() == moveFenceNone {
+		return nil
+	}
+	if op.UnscheduledNodes == nil {
+		op.UnscheduledNodes = make([]string, 0, 2)
+		for _, node := range []*v1.Node{nodeFrom, nodeTo} {
+			if node.Spec.Unschedulable == false && (len(op.UnscheduledNodes) == 0 || op.UnscheduledNodes[0] != node.Name) {
+				op.UnscheduledNodes = append(op.UnscheduledNodes, node.Name)
+			}
+		}
+		if err := saveMoveOperation(clientset, op); err != nil {
+			return fmt.Errorf("save move %s err:%v", op.ID, err)
+		}
+	}
+	if _, err := SetNodeScheduleable(clientset, op.UnscheduledNodes, true); err != nil {
+		return fmt.Errorf("set node %v scheduleable false err:%v\n", op.UnscheduledNodes, err)
+	}
+	return nil
+}
+
+// unfenceMoveNodes undoes fenceMoveNodes.
+func unfenceMoveNodes(clientset *kubernetes.Clientset, op *MoveOperation) error {
+	if op.fence() == moveFenceNone {
+		return nil
+	}
+	if _, err := SetNodeScheduleable(clientset, op.UnscheduledNodes, false); err != nil {
+		return fmt.Errorf("set node %v scheduleable true err:%v\n", op.UnscheduledNodes, err)
+	}
+	return nil
+}
+
+// addFencePlan adds fencing, or unfencing if fence is false, the nodes of op
+// to plan.
+func addFencePlan(plan *DryRunPlan, op *MoveOperation, fence bool) {
+	if op.fence() == moveFenceNone {
+		return
+	}
+	if fence {
+		plan.SetNodeScheduleable(op.fenceNodes(), true)
+	} else if op.UnscheduledNodes != nil {
+		plan.SetNodeScheduleable(op.UnscheduledNodes, false)
+	} else {
+		plan.SetNodeScheduleable(op.fenceNodes(), false)
+	}
+}
@@ -0,0 +1,101 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckMoveFence(t *testing.T) {
+	tests := []struct {
+		fence     string
+		scaleDown bool
+		err       string
+	}{
+		{fence: moveFenceNode},
+		{fence: moveFenceNode, scaleDown: true},
+		{fence: moveFenceNone, scaleDown: true},
+		{fence: moveFenceNone, err: "needs --scaledown"},
+		{fence: "taint", err: "--fence should be"},
+	}
+	for _, test := range tests {
+		err := checkMoveFence(test.fence, test.scaleDown)
+		if test.err != "" {
+			if err == nil || strings.Contains(err.Error(), test.err) == false {
+				t.Errorf("%s scaledown %t: err %v, want %q", test.fence, test.scaleDown, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s scaledown %t: err %v", test.fence, test.scaleDown, err)
+		}
+	}
+}
+
+func TestAddFencePlan(t *testing.T) {
+	tests := []struct {
+		name             string
+		fence            string
+		toNode           string
+		unscheduledNodes []string
+		fenceLines       []string
+		unfenceLines     []string
+	}{
+		{
+			name:         "moves saved without a fence cordon both nodes",
+			toNode:       "node2",
+			fenceLines:   []string{"set node node1 unscheduleable", "set node node2 unscheduleable"},
+			unfenceLines: []string{"set node node1 scheduleable", "set node node2 scheduleable"},
+		},
+		{
+			name:         "a move on one node cordons it once",
+			fence:        moveFenceNode,
+			toNode:       "node1",
+			fenceLines:   []string{"set node node1 unscheduleable"},
+			unfenceLines: []string{"set node node1 scheduleable"},
+		},
+		{
+			name:             "only the nodes cordoned by the move are uncordoned",
+			fence:            moveFenceNode,
+			toNode:           "node2",
+			unscheduledNodes: []string{"node2"},
+			fenceLines:       []string{"set node node1 unscheduleable", "set node node2 unscheduleable"},
+			unfenceLines:     []string{"set node node2 scheduleable"},
+		},
+		{
+			name:         "none leaves the nodes",
+			fence:        moveFenceNone,
+			toNode:       "node2",
+			fenceLines:   []string{},
+			unfenceLines: []string{},
+		},
+	}
+	for _, test := range tests {
+		op := newMoveOperation("node1", test.toNode, []string{"/xfs/disk1/dir1"}, []string{"/xfs/disk2"}, "image", 100, 10, 1024, false)
+		op.Fence = test.fence
+		op.UnscheduledNodes = test.unscheduledNodes
+		plan := NewDryRunPlan()
+		addFencePlan(plan, op, true)
+		if reflect.DeepEqual(plan.lines, test.fenceLines) == false {
+			t.Errorf("%s: fence %v, want %v", test.name, plan.lines, test.fenceLines)
+		}
+		plan = NewDryRunPlan()
+		addFencePlan(plan, op, false)
+		if reflect.DeepEqual(plan.lines, test.unfenceLines) == false {
+			t.Errorf("%s: unfence %v, want %v", test.name, plan.lines, test.unfenceLines)
+		}
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"io"
 	"path"
 	//	"path"
-	"strconv"
 	"strings"
 
 	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
@@ -29,7 +28,6 @@ import (
 	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
 	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
 
-	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -71,7 +69,19 @@ var (
 		kubectl hostpathpv get pv pvname
 
 		# List all resources quota info.
-		kubectl hostpathpv get all`)
+		kubectl hostpathpv get all
+
+		# List all nodes quota info in json output format.
+		kubectl hostpathpv get nodes -o json
+
+		# List all nodes with path number and free quota.
+		kubectl hostpathpv get nodes -o wide
+
+		# List the name and used size of every pv.
+		kubectl hostpathpv get pvs -o custom-columns=NAME:.name,USED:.used
+
+		# List the name of every pod whose quota is more than 10GB.
+		kubectl hostpathpv get pods -o jsonpath='{range .items[?(@.quota>10737418240)]}{.name}{"\n"}{end}'`)
 )
 
 const (
@@ -112,27 +122,27 @@ type NodeInfoItem struct {
 	diskInfos []DiskInfo
 }
 
-func NewCmdHostPathPVGet(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVGet(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "get (TYPE/NAME ...) [flags]",
 		Short:   T("Display node pod or pv quota information"),
 		Long:    hostpathpv_get_long,
 		Example: hostpathpv_get_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunHostpathPVGet(client, out, errOut, cmd, args)
+			err := RunHostpathPVGet(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunHostpathPVGet err:%v\n", err)
 			}
 		},
 	}
 	cmd.Flags().Bool("filter", true, "Ignored no disk quota resource")
-	cmd.Flags().StringP("namespace", "n", "default", "namespace")
 	cmd.Flags().Bool("all-namespaces", false, "If present, list the requested object(s) across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
 	//cmd.Flags().StringP("human-readable", "h", "", "print human readable sizes (e.g., 1K 234M 2G)")
+	AddOutputFlag(cmd, "json|yaml|wide|jsonpath=...|custom-columns=...")
 	return cmd
 }
 
-func RunHostpathPVGet(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunHostpathPVGet(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", hostpathpv_valid_resources)
 		usageString := "Required resource not specified."
@@ -141,8 +151,19 @@ func RunHostpathPVGet(clientset *kubernetes.Clientset, out, errOut io.Writer, cm
 
 	resource := args[0]
 	filter := GetFlagBool(cmd, "filter")
-	//	namespaces, _, _ := f.ToRawKubeConfigLoader().Namespace()
-	namespaces := GetFlagString(cmd, "namespace")
+	printer, err := NewResultPrinter(GetFlagString(cmd, "output"))
+	if err != nil {
+		return UsageErrorf(cmd, "%v", err)
+	}
+	list := NewQuotaList()
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	namespaces, err := f.Namespace()
+	if err != nil {
+		return err
+	}
 	allNamespaces := GetFlagBool(cmd, "all-namespaces")
 	if allNamespaces == true {
 		namespaces = metav1.NamespaceAll
@@ -163,44 +184,49 @@ func RunHostpathPVGet(clientset *kubernetes.Clientset, out, errOut io.Writer, cm
 				}
 			}
 		}
-		getPods(clientset, namespaces, podName, filter)
+		err = getPods(clientset, list, namespaces, podName, filter)
 	case resource == "nodes" || resource == "node":
 		nodeName := ""
 		if len(args) >= 2 {
 			nodeName = args[1]
 		}
-		getNodes(clientset, nodeName, filter)
+		err = getNodes(clientset, list, nodeName, filter)
 	case resource == "pvs" || resource == "pv":
 		pvName := ""
 		if len(args) >= 2 {
 			pvName = args[1]
 		}
-		getPVs(clientset, pvName)
+		err = getPVs(clientset, list, pvName)
 	case resource == "all":
-		getPods(clientset, namespaces, "", filter)
-		getNodes(clientset, "", filter)
-		getPVs(clientset, "")
+		if err = getPods(clientset, list, namespaces, "", filter); err == nil {
+			if err = getNodes(clientset, list, "", filter); err == nil {
+				err = getPVs(clientset, list, "")
+			}
+		}
 	default:
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", hostpathpv_valid_resources)
 		usageString := "Required resource not suport."
 		return UsageErrorf(cmd, usageString)
 	}
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return printer.PrintResult(list, out)
 }
 
-func getPods(clientset *kubernetes.Clientset, namespaces, podName string, filter bool) {
+func getPods(clientset *kubernetes.Clientset, list *QuotaList, namespaces, podName string, filter bool) error {
 	pods, err := clientset.Core().Pods(namespaces).List(metav1.ListOptions{})
 	if err != nil {
-		return
+		return fmt.Errorf("list pods err:%v", err)
 	}
 	if len(pods.Items) == 0 {
-		return
+		return nil
 	}
 	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
-	var sumQuota, sumUsed, sumKeep, sumNone, sumShare int64
-
-	displayer := NewDisplayer("  ", "", "Name", "Status", "HostPathPVNum", "Quota", "Used", "Keep", "None", "Share", "IP", "Node")
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
 
 	for i, _ := range pods.Items {
 		pod := &pods.Items[i]
@@ -211,34 +237,37 @@ func getPods(clientset *kubernetes.Clientset, namespaces, podName string, filter
 		if keep+none+share == 0 && filter == true {
 			continue
 		}
-		displayer.AddLine(pod.Namespace+"/"+pod.Name, string(pod.Status.Phase), strconv.Itoa(hostpathpvnum), convertIntToString(keep+none+share),
-			convertIntToString(used), convertIntToString(keep), convertIntToString(none), convertIntToString(share), pod.Status.PodIP, pod.Status.HostIP)
-
-		sumQuota += keep + none + share
-		sumUsed += used
-		sumKeep += keep
-		sumNone += none
-		sumShare += share
+		list.Items = append(list.Items, &PodQuota{
+			Kind:          QuotaKindPod,
+			Namespace:     pod.Namespace,
+			Name:          pod.Name,
+			Status:        string(pod.Status.Phase),
+			HostPathPVNum: hostpathpvnum,
+			Quota:         keep + none + share,
+			Used:          used,
+			Keep:          keep,
+			None:          none,
+			Share:         share,
+			PodIP:         pod.Status.PodIP,
+			HostIP:        pod.Status.HostIP,
+			NodeName:      pod.Spec.NodeName,
+		})
 	}
-	displayer.Print(true)
-	fmt.Printf("AllQuota: %s, AllUsed: %s, AllKeep: %s, AllNone: %s, AllShare: %s\n\n",
-		convertIntToString(sumQuota), convertIntToString(sumUsed), convertIntToString(sumKeep),
-		convertIntToString(sumNone), convertIntToString(sumShare))
+	return nil
 }
 
-func getNodes(clientset *kubernetes.Clientset, nodeName string, filter bool) {
+func getNodes(clientset *kubernetes.Clientset, list *QuotaList, nodeName string, filter bool) error {
 	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
-
 	if err != nil {
-		glog.Errorf("getNodes err:%v\n", err)
-		return
+		return fmt.Errorf("list nodes err:%v", err)
 	}
 	if len(nodes.Items) == 0 {
-		return
+		return nil
 	}
 	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
-	displayer := NewDisplayer("   ", "", "Name", "Status", "DiskNum", "Capacity", "Quota", "Used", "Keep", "None", "Share")
-	var allCapacity, allQuota, allUsed, allKeep, allNone, allShare int64
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
 	for i, _ := range nodes.Items {
 		node := &nodes.Items[i]
 		if nodeName != "" && nodeName != node.Name {
@@ -248,49 +277,67 @@ func getNodes(clientset *kubernetes.Clientset, nodeName string, filter bool) {
 		if quotaInfo.diskNum == 0 && filter == true {
 			continue
 		}
-		displayer.AddLine(quotaInfo.name, quotaInfo.status, fmt.Sprintf("(%d/%d)", quotaInfo.diskNum-quotaInfo.diskDisableNum, quotaInfo.diskNum),
-			convertIntToString(quotaInfo.diskCapacity),
-			convertIntToString(quotaInfo.allQuota)+getPercentStr(quotaInfo.allQuota, quotaInfo.diskCapacity),
-			convertIntToString(quotaInfo.diskUsed)+getPercentStr(quotaInfo.diskUsed, quotaInfo.diskCapacity),
-			convertIntToString(quotaInfo.keepQuota)+getPercentStr(quotaInfo.keepQuota, quotaInfo.diskCapacity),
-			convertIntToString(quotaInfo.noneQuota)+getPercentStr(quotaInfo.noneQuota, quotaInfo.diskCapacity),
-			convertIntToString(quotaInfo.shareQuota)+getPercentStr(quotaInfo.shareQuota, quotaInfo.diskCapacity))
-		allCapacity += quotaInfo.diskCapacity
-		allQuota += quotaInfo.allQuota
-		allUsed += quotaInfo.diskUsed
-		allKeep += quotaInfo.keepQuota
-		allNone += quotaInfo.noneQuota
-		allShare += quotaInfo.shareQuota
+		list.Items = append(list.Items, newNodeQuota(quotaInfo))
+	}
+	return nil
+}
+
+func newNodeQuota(quotaInfo NodeInfoItem) *NodeQuota {
+	ret := &NodeQuota{
+		Kind:           QuotaKindNode,
+		Name:           quotaInfo.name,
+		Status:         quotaInfo.status,
+		DiskNum:        quotaInfo.diskNum,
+		DiskDisableNum: quotaInfo.diskDisableNum,
+		Capacity:       quotaInfo.diskCapacity,
+		Quota:          quotaInfo.allQuota,
+		Used:           quotaInfo.diskUsed,
+		Keep:           quotaInfo.keepQuota,
+		None:           quotaInfo.noneQuota,
+		Share:          quotaInfo.shareQuota,
 	}
-	displayer.Print(true)
-	fmt.Printf("AllCapacity: %s, AllQuota: %s, AllUsed: %s, AllKeep: %s, AllNone: %s, AllShare: %s\n\n",
-		convertIntToString(allCapacity), convertIntToString(allQuota)+getPercentStr(allQuota, allCapacity),
-		convertIntToString(allUsed)+getPercentStr(allUsed, allCapacity),
-		convertIntToString(allKeep)+getPercentStr(allKeep, allCapacity),
-		convertIntToString(allNone)+getPercentStr(allNone, allCapacity),
-		convertIntToString(allShare)+getPercentStr(allShare, allCapacity))
+	for _, diskInfo := range quotaInfo.diskInfos {
+		ret.PathNum += diskInfo.dirNum
+	}
+	return ret
+}
 
+func newDiskQuota(diskInfo DiskInfo) DiskQuota {
+	return DiskQuota{
+		Path:     diskInfo.path,
+		Disabled: diskInfo.disabled,
+		PathNum:  diskInfo.dirNum,
+		Capacity: diskInfo.capacity,
+		Quota:    diskInfo.keep + diskInfo.none + diskInfo.share,
+		Used:     diskInfo.used,
+		Keep:     diskInfo.keep,
+		None:     diskInfo.none,
+		Share:    diskInfo.share,
+	}
 }
 
-func getPVs(clientset *kubernetes.Clientset, pvName string) {
+func getPVs(clientset *kubernetes.Clientset, list *QuotaList, pvName string) error {
 	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
 	if err != nil {
-		return
+		return fmt.Errorf("list pvs err:%v", err)
 	}
-	displayer := NewDisplayer("   ", "", "Name", "Status", "NodeNum", "PathNum", "Capacity", "Type", "Quota", "Used")
-	// fmt.Printf("pvs=%d\n", len(pvs.Items))
-	var sumQuota, sumUsed int64
-	var sumPaths, sumPVs int
 	for i, _ := range pvs.Items {
 		pv := &pvs.Items[i]
 		if algorithm.IsCommonHostPathPV(pv) == false || (pvName != "" && pv.Name != pvName) {
 			continue
 		}
+		pvQuota := &PVQuota{
+			Kind:       QuotaKindPV,
+			Name:       pv.Name,
+			Status:     string(pv.Status.Phase),
+			Type:       getPVTypeStr(pv),
+			Capacity:   getPVCapacity(pv),
+			MountNodes: []string{},
+		}
 		if pv.Annotations == nil || pv.Annotations[common.PVVolumeHostPathMountNode] == "" {
-			displayer.AddLine(pv.Name, string(pv.Status.Phase), "0", "0", convertIntToString(getPVCapacity(pv)), getPVTypeStr(pv), convertIntToString(0), convertIntToString(0))
+			list.Items = append(list.Items, pvQuota)
 			continue
 		}
-		sumPVs++
 		mountInfo := pv.Annotations[common.PVVolumeHostPathMountNode]
 
 		mountList := hostpath.HostPathPVMountInfoList{}
@@ -298,24 +345,18 @@ func getPVs(clientset *kubernetes.Clientset, pvName string) {
 		if errUmarshal != nil {
 			continue
 		}
-		var allQuota, allUsed int64
-		var pathNum int
 		for _, item := range mountList {
+			pvQuota.MountNodes = append(pvQuota.MountNodes, item.NodeName)
 			for _, mountInfo := range item.MountInfos {
-				allQuota += mountInfo.VolumeQuotaSize
-				allUsed += mountInfo.VolumeCurrentSize
-				pathNum++
+				pvQuota.Quota += mountInfo.VolumeQuotaSize
+				pvQuota.Used += mountInfo.VolumeCurrentSize
+				pvQuota.PathNum++
 			}
 		}
-		sumPaths += pathNum
-		sumQuota += allQuota
-		sumUsed += allUsed
-		displayer.AddLine(pv.Name, string(pv.Status.Phase), strconv.Itoa(len(mountList)), strconv.Itoa(pathNum),
-			convertIntToString(getPVCapacity(pv)), getPVTypeStr(pv), convertIntToString(allQuota), convertIntToString(allUsed))
+		pvQuota.NodeNum = len(mountList)
+		list.Items = append(list.Items, pvQuota)
 	}
-	displayer.Print(true)
-	fmt.Printf("NumPVs: %d, NumPaths: %d, AllUsed: %s, AllQuota: %s\n\n",
-		sumPVs, sumPVs, convertIntToString(sumUsed), convertIntToString(sumQuota))
+	return nil
 }
 
 func getNodeQuotaInfos(node *v1.Node, pvs *v1.PersistentVolumeList) NodeInfoItem {
@@ -0,0 +1,224 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// The helper pods of move and upgrade (from, move, verify and change quota
+// path type pods) run in kube-system without tolerations by default. A pod
+// template given by --podtemplate and the --pod* flags is merged into every
+// helper pod, so that they start on tainted nodes and in restricted clusters.
+
+// helperPodTemplate is merged into every helper pod, it is nil if none is
+// given. It is set by setHelperPodTemplate and, for a resumed or aborted
+// move, from the move.
+var helperPodTemplate *v1.PodTemplateSpec
+
+func addHelperPodFlags(cmd *cobra.Command) {
+	cmd.Flags().String("podtemplate", "", "Yaml or json pod template file merged into the helper pods: namespace, labels, annotations, tolerations, priorityClassName, serviceAccountName, imagePullSecrets, securityContext and the resources and securityContext of the first container, the --pod* flags override it")
+	cmd.Flags().String("podnamespace", "", "Namespace of the helper pods, kube-system if it is not given by --podtemplate either")
+	cmd.Flags().StringSlice("podtolerations", []string{}, "Tolerations of the helper pods, KEY[=VALUE][:EFFECT]")
+	cmd.Flags().String("podpriorityclass", "", "PriorityClassName of the helper pods")
+	cmd.Flags().String("podserviceaccount", "", "ServiceAccountName of the helper pods")
+	cmd.Flags().StringSlice("podimagepullsecrets", []string{}, "ImagePullSecrets of the helper pods")
+	cmd.Flags().String("podcpurequest", "", "Cpu request of the helper pods, e.g. 100m")
+}
+
+// setHelperPodTemplate sets helperPodTemplate from --podtemplate, the --pod*
+// flags override it.
+func setHelperPodTemplate(cmd *cobra.Command) error {
+	tpl, err := getHelperPodTemplate(cmd)
+	if err != nil {
+		return err
+	}
+	helperPodTemplate = tpl
+	return nil
+}
+
+func getHelperPodTemplate(cmd *cobra.Command) (*v1.PodTemplateSpec, error) {
+	tpl := &v1.PodTemplateSpec{}
+	isSet := false
+	if filename := GetFlagString(cmd, "podtemplate"); filename != "" {
+		buf, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(buf, tpl); err != nil {
+			return nil, fmt.Errorf("parse %s err:%v", filename, err)
+		}
+		isSet = true
+	}
+	if ns := GetFlagString(cmd, "podnamespace"); ns != "" {
+		tpl.Namespace = ns
+		isSet = true
+	}
+	tolerations, err := cmd.Flags().GetStringSlice("podtolerations")
+	if err != nil {
+		return nil, err
+	}
+	for _, str := range tolerations {
+		toleration, err := parseToleration(str)
+		if err != nil {
+			return nil, err
+		}
+		tpl.Spec.Tolerations = append(tpl.Spec.Tolerations, toleration)
+		isSet = true
+	}
+	if priorityClass := GetFlagString(cmd, "podpriorityclass"); priorityClass != "" {
+		tpl.Spec.PriorityClassName = priorityClass
+		isSet = true
+	}
+	if serviceAccount := GetFlagString(cmd, "podserviceaccount"); serviceAccount != "" {
+		tpl.Spec.ServiceAccountName = serviceAccount
+		isSet = true
+	}
+	pullSecrets, err := cmd.Flags().GetStringSlice("podimagepullsecrets")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pullSecrets {
+		tpl.Spec.ImagePullSecrets = append(tpl.Spec.ImagePullSecrets, v1.LocalObjectReference{Name: name})
+		isSet = true
+	}
+	if cpu := GetFlagString(cmd, "podcpurequest"); cpu != "" {
+		quantity, err := resource.ParseQuantity(cpu)
+		if err != nil {
+			return nil, fmt.Errorf("--podcpurequest %s err:%v", cpu, err)
+		}
+		if len(tpl.Spec.Containers) == 0 {
+			tpl.Spec.Containers = []v1.Container{{}}
+		}
+		if tpl.Spec.Containers[0].Resources.Requests == nil {
+			tpl.Spec.Containers[0].Resources.Requests = v1.ResourceList{}
+		}
+		tpl.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = quantity
+		isSet = true
+	}
+	if isSet == false {
+		return nil, nil
+	}
+	return tpl, nil
+}
+
+// parseToleration parses KEY[=VALUE][:EFFECT], a toleration without value
+// tolerates every value of the key.
+func parseToleration(str string) (v1.Toleration, error) {
+	toleration := v1.Toleration{Operator: v1.TolerationOpExists}
+	if i := strings.LastIndex(str, ":"); i >= 0 {
+		toleration.Effect = v1.TaintEffect(str[i+1:])
+		str = str[:i]
+		switch toleration.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return toleration, fmt.Errorf("toleration effect %s is not supported", toleration.Effect)
+		}
+	}
+	if i := strings.Index(str, "="); i >= 0 {
+		toleration.Operator = v1.TolerationOpEqual
+		toleration.Value = str[i+1:]
+		str = str[:i]
+	}
+	toleration.Key = str
+	if toleration.Key == "" && toleration.Operator == v1.TolerationOpEqual {
+		return toleration, fmt.Errorf("toleration with a value should have a key")
+	}
+	return toleration, nil
+}
+
+// helperPodNamespace returns the namespace of the helper pods and of the
+// secrets they use.
+func helperPodNamespace() string {
+	if helperPodTemplate != nil && helperPodTemplate.Namespace != "" {
+		return helperPodTemplate.Namespace
+	}
+	return metav1.NamespaceSystem
+}
+
+// applyHelperPodTemplate merges helperPodTemplate into pod. The labels and
+// annotations of pod are kept, the resources of the template are set on every
+// container.
+func applyHelperPodTemplate(pod *v1.Pod) *v1.Pod {
+	pod.Namespace = helperPodNamespace()
+	tpl := helperPodTemplate
+	if tpl == nil {
+		return pod
+	}
+	for k, v := range tpl.Labels {
+		if pod.Labels == nil {
+			pod.Labels = make(map[string]string)
+		}
+		if _, exist := pod.Labels[k]; exist == false {
+			pod.Labels[k] = v
+		}
+	}
+	for k, v := range tpl.Annotations {
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		if _, exist := pod.Annotations[k]; exist == false {
+			pod.Annotations[k] = v
+		}
+	}
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, tpl.Spec.Tolerations...)
+	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, tpl.Spec.ImagePullSecrets...)
+	if tpl.Spec.PriorityClassName != "" {
+		pod.Spec.PriorityClassName = tpl.Spec.PriorityClassName
+	}
+	if tpl.Spec.ServiceAccountName != "" {
+		pod.Spec.ServiceAccountName = tpl.Spec.ServiceAccountName
+	}
+	if tpl.Spec.SecurityContext != nil {
+		pod.Spec.SecurityContext = tpl.Spec.SecurityContext.DeepCopy()
+	}
+	if len(tpl.Spec.Containers) == 0 {
+		return pod
+	}
+	container := tpl.Spec.Containers[0]
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if c.Resources.Limits == nil && len(container.Resources.Limits) > 0 {
+			c.Resources.Limits = v1.ResourceList{}
+		}
+		for name, quantity := range container.Resources.Limits {
+			c.Resources.Limits[name] = quantity
+		}
+		if c.Resources.Requests == nil && len(container.Resources.Requests) > 0 {
+			c.Resources.Requests = v1.ResourceList{}
+		}
+		for name, quantity := range container.Resources.Requests {
+			c.Resources.Requests[name] = quantity
+			// the helper pods limit cpu to 0, which is no limit but is less
+			// than the request.
+			if limit, exist := c.Resources.Limits[name]; exist && limit.IsZero() && quantity.IsZero() == false {
+				delete(c.Resources.Limits, name)
+			}
+		}
+		if container.SecurityContext != nil {
+			c.SecurityContext = container.SecurityContext.DeepCopy()
+		}
+	}
+	return pod
+}
@@ -0,0 +1,575 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a small subset of kubectl's jsonpath templates:
+// {.a.b}, {.a[0]}, {.a[0:2]}, {.a[*]}, {.a['b']}, {..a}, {.a[?(@.b=="c")]},
+// {range .a[*]}...{end} and {"literal"}. Like kubectl a missing key or index
+// is an error unless missing keys are allowed.
+type JSONPath struct {
+	name             string
+	nodes            []jsonPathNode
+	allowMissingKeys bool
+}
+
+type jsonPathNode struct {
+	text    string
+	path    []jsonPathSegment
+	isPath  bool
+	isRange bool
+	body    []jsonPathNode
+}
+
+const (
+	segmentField = iota
+	segmentIndex
+	segmentWildcard
+	segmentRecursive
+	segmentFilter
+	segmentSlice
+)
+
+type jsonPathSegment struct {
+	kind  int
+	field string
+	index int
+
+	// slice: [start:end:step], a missing start or end is the first or the
+	// end of the array
+	start, end, step int
+	hasStart, hasEnd bool
+
+	// filter: @<filterPath> <op> <value>, op == "" means existence check
+	filterPath  []jsonPathSegment
+	filterOp    string
+	filterValue interface{}
+}
+
+func NewJSONPath(name string) *JSONPath {
+	return &JSONPath{name: name}
+}
+
+// AllowMissingKeys makes a missing key or index print nothing instead of
+// failing.
+func (j *JSONPath) AllowMissingKeys(allow bool) *JSONPath {
+	j.allowMissingKeys = allow
+	return j
+}
+
+func (j *JSONPath) Parse(template string) error {
+	stack := [][]jsonPathNode{{}}
+	rangeNodes := []jsonPathNode{}
+	for len(template) > 0 {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: template})
+			break
+		}
+		if start > 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: template[:start]})
+		}
+		end := findJSONPathClose(template, start+1, '}')
+		if end < 0 {
+			return fmt.Errorf("%s: unclosed action in %q", j.name, template)
+		}
+		action := strings.TrimSpace(template[start+1 : end])
+		template = template[end+1:]
+		switch {
+		case action == "end":
+			if len(rangeNodes) == 0 {
+				return fmt.Errorf("%s: {end} without {range}", j.name)
+			}
+			node := rangeNodes[len(rangeNodes)-1]
+			rangeNodes = rangeNodes[:len(rangeNodes)-1]
+			node.body = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], node)
+		case strings.HasPrefix(action, "range "):
+			path, err := parseJSONPathExpr(strings.TrimSpace(strings.TrimPrefix(action, "range ")))
+			if err != nil {
+				return fmt.Errorf("%s: %v", j.name, err)
+			}
+			rangeNodes = append(rangeNodes, jsonPathNode{isRange: true, path: path})
+			stack = append(stack, []jsonPathNode{})
+		case strings.HasPrefix(action, "\"") || strings.HasPrefix(action, "'"):
+			text, err := unquoteJSONPathLiteral(action)
+			if err != nil {
+				return fmt.Errorf("%s: invalid literal %s: %v", j.name, action, err)
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: text})
+		default:
+			path, err := parseJSONPathExpr(action)
+			if err != nil {
+				return fmt.Errorf("%s: %v", j.name, err)
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{isPath: true, path: path})
+		}
+	}
+	if len(rangeNodes) != 0 {
+		return fmt.Errorf("%s: {range} without {end}", j.name)
+	}
+	j.nodes = stack[0]
+	return nil
+}
+
+// Execute renders the template against data. data is converted through json first
+// so struct field tags are honored.
+func (j *JSONPath) Execute(out io.Writer, data interface{}) error {
+	root, err := toJSONValue(data)
+	if err != nil {
+		return err
+	}
+	return j.executeNodes(out, j.nodes, root)
+}
+
+// FindResults returns the values matched by the first path of the template.
+func (j *JSONPath) FindResults(data interface{}) ([]interface{}, error) {
+	root, err := toJSONValue(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range j.nodes {
+		if node.isPath {
+			return evalJSONPath(node.path, root, j.allowMissingKeys)
+		}
+	}
+	return nil, nil
+}
+
+func toJSONValue(data interface{}) (interface{}, error) {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (j *JSONPath) executeNodes(out io.Writer, nodes []jsonPathNode, cur interface{}) error {
+	for _, node := range nodes {
+		switch {
+		case node.isRange:
+			items, err := evalJSONPath(node.path, cur, j.allowMissingKeys)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := j.executeNodes(out, node.body, item); err != nil {
+					return err
+				}
+			}
+		case node.isPath:
+			results, err := evalJSONPath(node.path, cur, j.allowMissingKeys)
+			if err != nil {
+				return err
+			}
+			strs := make([]string, 0, len(results))
+			for _, result := range results {
+				strs = append(strs, jsonValueString(result))
+			}
+			fmt.Fprint(out, strings.Join(strs, " "))
+		default:
+			fmt.Fprint(out, node.text)
+		}
+	}
+	return nil
+}
+
+func jsonValueString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		buf, _ := json.Marshal(t)
+		return string(buf)
+	}
+}
+
+// evalJSONPath returns the values path matches in cur. A missing key or index
+// is an error unless allowMissing, wildcards, filters and slices which match
+// nothing are not.
+func evalJSONPath(path []jsonPathSegment, cur interface{}, allowMissing bool) ([]interface{}, error) {
+	results := []interface{}{cur}
+	for _, seg := range path {
+		next := make([]interface{}, 0, len(results))
+		for _, r := range results {
+			values, err := evalJSONPathSegment(seg, r)
+			if err != nil && allowMissing == false {
+				return nil, err
+			}
+			next = append(next, values...)
+		}
+		results = next
+	}
+	return results, nil
+}
+
+func evalJSONPathSegment(seg jsonPathSegment, cur interface{}) ([]interface{}, error) {
+	switch seg.kind {
+	case segmentField:
+		if m, ok := cur.(map[string]interface{}); ok {
+			if v, exist := m[seg.field]; exist {
+				return []interface{}{v}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not found", seg.field)
+	case segmentIndex:
+		a, ok := cur.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[%d] is not of an array", seg.index)
+		}
+		i := seg.index
+		if i < 0 {
+			i += len(a)
+		}
+		if i < 0 || i >= len(a) {
+			return nil, fmt.Errorf("array index out of bounds: index %d, length %d", seg.index, len(a))
+		}
+		return []interface{}{a[i]}, nil
+	case segmentSlice:
+		a, ok := cur.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		start, end := 0, len(a)
+		if seg.hasStart {
+			start = clampJSONPathIndex(seg.start, len(a))
+		}
+		if seg.hasEnd {
+			end = clampJSONPathIndex(seg.end, len(a))
+		}
+		ret := make([]interface{}, 0, len(a))
+		for i := start; i < end; i += seg.step {
+			ret = append(ret, a[i])
+		}
+		return ret, nil
+	case segmentWildcard:
+		switch t := cur.(type) {
+		case []interface{}:
+			return t, nil
+		case map[string]interface{}:
+			ret := make([]interface{}, 0, len(t))
+			for _, k := range sortedKeys(t) {
+				ret = append(ret, t[k])
+			}
+			return ret, nil
+		}
+	case segmentRecursive:
+		ret := []interface{}{}
+		collectJSONPathField(cur, seg.field, &ret)
+		return ret, nil
+	case segmentFilter:
+		items, ok := cur.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		ret := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if matchJSONPathFilter(seg, item) {
+				ret = append(ret, item)
+			}
+		}
+		return ret, nil
+	}
+	return nil, nil
+}
+
+// clampJSONPathIndex returns the slice bound i of an array of length, a
+// negative one is from the end.
+func clampJSONPathIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	} else if i > length {
+		return length
+	}
+	return i
+}
+
+func collectJSONPathField(cur interface{}, field string, ret *[]interface{}) {
+	switch t := cur.(type) {
+	case map[string]interface{}:
+		if v, exist := t[field]; exist {
+			*ret = append(*ret, v)
+		}
+		for _, k := range sortedKeys(t) {
+			collectJSONPathField(t[k], field, ret)
+		}
+	case []interface{}:
+		for _, v := range t {
+			collectJSONPathField(v, field, ret)
+		}
+	}
+}
+
+// matchJSONPathFilter returns whether item matches the filter, an item without
+// the filtered key does not.
+func matchJSONPathFilter(seg jsonPathSegment, item interface{}) bool {
+	values, _ := evalJSONPath(seg.filterPath, item, true)
+	if seg.filterOp == "" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if compareJSONValue(v, seg.filterOp, seg.filterValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareJSONValue(v interface{}, op string, want interface{}) bool {
+	if wantNum, ok := want.(float64); ok {
+		num, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return false
+		}
+		switch op {
+		case "==":
+			return f == wantNum
+		case "!=":
+			return f != wantNum
+		case "<":
+			return f < wantNum
+		case "<=":
+			return f <= wantNum
+		case ">":
+			return f > wantNum
+		case ">=":
+			return f >= wantNum
+		}
+		return false
+	}
+	s := jsonValueString(v)
+	w := jsonValueString(want)
+	switch op {
+	case "==":
+		return s == w
+	case "!=":
+		return s != w
+	}
+	return false
+}
+
+func parseJSONPathExpr(expr string) ([]jsonPathSegment, error) {
+	if strings.HasPrefix(expr, "$") || strings.HasPrefix(expr, "@") {
+		expr = expr[1:]
+	}
+	segs := make([]jsonPathSegment, 0, 4)
+	for len(expr) > 0 {
+		switch {
+		case strings.HasPrefix(expr, ".."):
+			field, rest := splitJSONPathField(expr[2:])
+			if field == "" {
+				return nil, fmt.Errorf("invalid recursive descent in %q", expr)
+			}
+			segs = append(segs, jsonPathSegment{kind: segmentRecursive, field: field})
+			expr = rest
+		case expr[0] == '.':
+			field, rest := splitJSONPathField(expr[1:])
+			if field == "*" {
+				segs = append(segs, jsonPathSegment{kind: segmentWildcard})
+			} else if field != "" {
+				segs = append(segs, jsonPathSegment{kind: segmentField, field: field})
+			}
+			expr = rest
+		case expr[0] == '[':
+			end := findJSONPathClose(expr, 1, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", expr)
+			}
+			seg, err := parseJSONPathBracket(strings.TrimSpace(expr[1:end]))
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			expr = expr[end+1:]
+		default:
+			field, rest := splitJSONPathField(expr)
+			segs = append(segs, jsonPathSegment{kind: segmentField, field: field})
+			expr = rest
+		}
+	}
+	return segs, nil
+}
+
+func splitJSONPathField(expr string) (string, string) {
+	i := strings.IndexAny(expr, ".[")
+	if i < 0 {
+		return expr, ""
+	}
+	return expr[:i], expr[i:]
+}
+
+func parseJSONPathBracket(content string) (jsonPathSegment, error) {
+	switch {
+	case content == "*":
+		return jsonPathSegment{kind: segmentWildcard}, nil
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, "\""):
+		field, err := unquoteJSONPathLiteral(content)
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("invalid field %s: %v", content, err)
+		}
+		return jsonPathSegment{kind: segmentField, field: field}, nil
+	case strings.HasPrefix(content, "?(") && strings.HasSuffix(content, ")"):
+		return parseJSONPathFilter(strings.TrimSpace(content[2 : len(content)-1]))
+	case strings.Contains(content, ":"):
+		return parseJSONPathSlice(content)
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("unsupported index [%s]", content)
+		}
+		return jsonPathSegment{kind: segmentIndex, index: index}, nil
+	}
+}
+
+func parseJSONPathSlice(content string) (jsonPathSegment, error) {
+	seg := jsonPathSegment{kind: segmentSlice, step: 1}
+	strs := strings.Split(content, ":")
+	if len(strs) > 3 {
+		return seg, fmt.Errorf("invalid slice [%s]", content)
+	}
+	for i, str := range strs {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		value, err := strconv.Atoi(str)
+		if err != nil {
+			return seg, fmt.Errorf("invalid slice [%s]", content)
+		}
+		switch i {
+		case 0:
+			seg.start, seg.hasStart = value, true
+		case 1:
+			seg.end, seg.hasEnd = value, true
+		case 2:
+			seg.step = value
+		}
+	}
+	if seg.step <= 0 {
+		return seg, fmt.Errorf("invalid slice step in [%s]", content)
+	}
+	return seg, nil
+}
+
+func parseJSONPathFilter(filter string) (jsonPathSegment, error) {
+	seg := jsonPathSegment{kind: segmentFilter}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if i := strings.Index(filter, op); i > 0 {
+			path, err := parseJSONPathExpr(strings.TrimSpace(filter[:i]))
+			if err != nil {
+				return seg, err
+			}
+			value := strings.TrimSpace(filter[i+len(op):])
+			seg.filterPath = path
+			seg.filterOp = op
+			if strings.HasPrefix(value, "'") || strings.HasPrefix(value, "\"") {
+				str, err := unquoteJSONPathLiteral(value)
+				if err != nil {
+					return seg, fmt.Errorf("invalid filter value %s: %v", value, err)
+				}
+				seg.filterValue = str
+			} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+				seg.filterValue = f
+			} else {
+				seg.filterValue = value
+			}
+			return seg, nil
+		}
+	}
+	path, err := parseJSONPathExpr(filter)
+	if err != nil {
+		return seg, err
+	}
+	seg.filterPath = path
+	return seg, nil
+}
+
+func unquoteJSONPathLiteral(s string) (string, error) {
+	if strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") && len(s) >= 2 {
+		return s[1 : len(s)-1], nil
+	}
+	return strconv.Unquote(s)
+}
+
+// findJSONPathClose returns the index of the close char matching an already opened
+// bracket, skipping quoted strings and nested brackets.
+func findJSONPathClose(s string, from int, close byte) int {
+	open := byte('{')
+	if close == ']' {
+		open = '['
+	}
+	depth := 0
+	var quote byte
+	for i := from; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == open:
+			depth++
+		case c == close:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
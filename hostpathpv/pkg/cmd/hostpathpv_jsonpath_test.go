@@ -0,0 +1,142 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	list := NewQuotaList()
+	list.Items = append(list.Items,
+		&NodeQuota{Kind: QuotaKindNode, Name: "node1", Quota: 100, Used: 10},
+		&NodeQuota{Kind: QuotaKindNode, Name: "node2", Quota: 300, Used: 30},
+		&PVQuota{Kind: QuotaKindPV, Name: "pv1", Quota: 200, Used: 20, MountNodes: []string{"a", "b"},
+			Mounts: []PVNodeQuota{{NodeName: "node1", Paths: []PathQuota{{HostPath: "/xfs/disk1/p1", Quota: 200}}}}},
+	)
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		// parseErr and execErr are parts of the expected errors
+		parseErr string
+		execErr  string
+	}{
+		{name: "field", template: "{.kind}", want: "List"},
+		{name: "index", template: "{.items[1].name}", want: "node2"},
+		{name: "negative index", template: "{.items[-1].name}", want: "pv1"},
+		{name: "wildcard", template: "{.items[*].name}", want: "node1 node2 pv1"},
+		{name: "quoted field", template: "{.items[0]['name']}", want: "node1"},
+		{name: "slice", template: "{.items[0:2].name}", want: "node1 node2"},
+		{name: "open slice", template: "{.items[1:].name}", want: "node2 pv1"},
+		{name: "negative slice", template: "{.items[-2:].name}", want: "node2 pv1"},
+		{name: "slice step", template: "{.items[::2].name}", want: "node1 pv1"},
+		{name: "slice out of range", template: "{.items[1:10].name}", want: "node2 pv1"},
+		{name: "recursive", template: "{..hostPath}", want: "/xfs/disk1/p1"},
+		{name: "filter", template: "{.items[?(@.quota>150)].name}", want: "node2 pv1"},
+		{name: "filter string", template: `{.items[?(@.kind=="PersistentVolume")].name}`, want: "pv1"},
+		// items without mounts do not match and are no error
+		{name: "filter existence", template: "{.items[?(@.mounts)].name}", want: "pv1"},
+		{name: "range", template: `{range .items[*]}{.name}:{.used}{"\n"}{end}`, want: "node1:10\nnode2:30\npv1:20\n"},
+		{name: "array value", template: "{.items[2].mountNodes}", want: `["a","b"]`},
+		{name: "missing key", template: "{.items[0].missing}", execErr: "missing is not found"},
+		{name: "missing key in range", template: "{range .items[*]}{.mounts}{end}", execErr: "mounts is not found"},
+		{name: "index out of range", template: "{.items[5].name}", execErr: "array index out of bounds"},
+		{name: "unclosed action", template: "{.items", parseErr: "unclosed action"},
+		{name: "end without range", template: "{end}", parseErr: "{end} without {range}"},
+		{name: "range without end", template: "{range .items[*]}{.name}", parseErr: "{range} without {end}"},
+		{name: "bad index", template: "{.items[a]}", parseErr: "unsupported index"},
+		{name: "bad slice", template: "{.items[0:a]}", parseErr: "invalid slice"},
+		{name: "zero slice step", template: "{.items[0:2:0]}", parseErr: "invalid slice step"},
+	}
+	for _, test := range tests {
+		p := NewJSONPath(test.name)
+		err := p.Parse(test.template)
+		if test.parseErr != "" {
+			if err == nil || strings.Contains(err.Error(), test.parseErr) == false {
+				t.Errorf("%s: parse err %v, want %q", test.name, err, test.parseErr)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: parse err %v", test.name, err)
+			continue
+		}
+		out := &bytes.Buffer{}
+		err = p.Execute(out, list)
+		if test.execErr != "" {
+			if err == nil || strings.Contains(err.Error(), test.execErr) == false {
+				t.Errorf("%s: execute err %v, want %q", test.name, err, test.execErr)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: execute err %v", test.name, err)
+			continue
+		}
+		if out.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, out.String(), test.want)
+		}
+	}
+}
+
+func TestJSONPathAllowMissingKeys(t *testing.T) {
+	p := NewJSONPath("missing").AllowMissingKeys(true)
+	if err := p.Parse("{.items[0].missing}{.items[5].name}{.kind}"); err != nil {
+		t.Fatalf("parse err %v", err)
+	}
+	out := &bytes.Buffer{}
+	list := NewQuotaList()
+	list.Items = append(list.Items, &NodeQuota{Kind: QuotaKindNode, Name: "node1"})
+	if err := p.Execute(out, list); err != nil {
+		t.Fatalf("execute err %v", err)
+	}
+	if out.String() != "List" {
+		t.Errorf("got %q, want %q", out.String(), "List")
+	}
+}
+
+func TestCustomColumnsMissingValue(t *testing.T) {
+	p, err := NewCustomColumnsPrinter("NAME:.name,POD:.mounts[0].paths[0].hostPath")
+	if err != nil {
+		t.Fatalf("new printer err %v", err)
+	}
+	out := &bytes.Buffer{}
+	list := NewQuotaList()
+	list.Items = append(list.Items, &NodeQuota{Kind: QuotaKindNode, Name: "node1"})
+	if err := p.PrintResult(list, out); err != nil {
+		t.Fatalf("print err %v", err)
+	}
+	if strings.Contains(out.String(), "<none>") == false {
+		t.Errorf("missing value is not <none>: %q", out.String())
+	}
+}
+
+func TestJSONPathPrinterMissingKeys(t *testing.T) {
+	p, err := NewResultPrinter(`jsonpath={range .items[*]}{.name}:{.disks[0].paths}{"\n"}{end}`)
+	if err != nil {
+		t.Fatalf("new printer err %v", err)
+	}
+	out := &bytes.Buffer{}
+	list := NewQuotaList()
+	list.Items = append(list.Items, &NodeQuota{Kind: QuotaKindNode, Name: "node1"})
+	if err := p.PrintResult(list, out); err != nil {
+		t.Fatalf("print err %v", err)
+	}
+	if out.String() != "node1:\n" {
+		t.Errorf("got %q, want %q", out.String(), "node1:\n")
+	}
+}
@@ -0,0 +1,339 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// A node to node move leaves the from dirs on the from node. With --keep-source
+// they are recorded in a configmap next to the move state when the move ends,
+// so that they can be listed by move sources and deleted by
+// move cleanup-source ID once the moved data is known to be good.
+
+const (
+	retainedSourceDataKey    = "source"
+	retainedSourceNamePrefix = "hostpathpv-source-"
+)
+
+// RetainedSource is the kept source data of a node to node move.
+type RetainedSource struct {
+	// ID is the id of the move.
+	ID     string               `json:"id"`
+	Time   string               `json:"time"`
+	Node   string               `json:"node"`
+	ToNode string               `json:"toNode"`
+	Paths  []RetainedSourcePath `json:"paths"`
+}
+
+// RetainedSourcePath is a kept from dir and the path it was moved to.
+type RetainedSourcePath struct {
+	Path   string `json:"path"`
+	ToPath string `json:"toPath"`
+	// Size is the used size of the quota path when it was moved.
+	Size int64 `json:"size"`
+}
+
+func (src *RetainedSource) size() int64 {
+	var ret int64
+	for _, p := range src.Paths {
+		ret += p.Size
+	}
+	return ret
+}
+
+// newRetainedSource returns the from dirs of the finished move op. The used
+// sizes are taken from the moved quota paths in pvs.
+func newRetainedSource(op *MoveOperation, pvs *v1.PersistentVolumeList) *RetainedSource {
+	src := &RetainedSource{
+		ID:     op.ID,
+		Time:   time.Now().Format(time.RFC3339),
+		Node:   op.FromNode,
+		ToNode: op.ToNode,
+		Paths:  make([]RetainedSourcePath, 0, len(op.FromDirs)),
+	}
+	for i, fromDir := range op.FromDirs {
+		toPath := path.Join(op.ToDirs[i], path.Base(fromDir))
+		src.Paths = append(src.Paths, RetainedSourcePath{
+			Path:   fromDir,
+			ToPath: toPath,
+			Size:   GetQuotaPathUsedSize(pvs, op.ToNode, toPath),
+		})
+	}
+	return src
+}
+
+func getRetainedSourceConfigMapName(id string) string {
+	return retainedSourceNamePrefix + id
+}
+
+// getRetainedSource returns nil and no error if the source does not exist.
+func getRetainedSource(clientset *kubernetes.Clientset, id string) (*RetainedSource, error) {
+	cm, err := clientset.Core().ConfigMaps(moveOperationNamespace).Get(getRetainedSourceConfigMapName(id), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get kept source %s err:%v", id, err)
+	}
+	return decodeRetainedSource(cm)
+}
+
+func decodeRetainedSource(cm *v1.ConfigMap) (*RetainedSource, error) {
+	src := &RetainedSource{}
+	if err := json.Unmarshal([]byte(cm.Data[retainedSourceDataKey]), src); err != nil {
+		return nil, fmt.Errorf("kept source %s is broken: %v", cm.Name, err)
+	}
+	return src, nil
+}
+
+// listRetainedSources returns the kept sources, oldest first.
+func listRetainedSources(clientset *kubernetes.Clientset) ([]*RetainedSource, error) {
+	cms, err := clientset.Core().ConfigMaps(moveOperationNamespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", moveOperationLabel, retainedSourceDataKey),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list kept sources err:%v", err)
+	}
+	ret := make([]*RetainedSource, 0, len(cms.Items))
+	for i := range cms.Items {
+		src, err := decodeRetainedSource(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, src)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Time != ret[j].Time {
+			return ret[i].Time < ret[j].Time
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func saveRetainedSource(clientset *kubernetes.Clientset, src *RetainedSource) error {
+	buf, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	name := getRetainedSourceConfigMapName(src.ID)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		cm, err := clientset.Core().ConfigMaps(moveOperationNamespace).Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = clientset.Core().ConfigMaps(moveOperationNamespace).Create(&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: moveOperationNamespace,
+					Labels:    map[string]string{"app": "kubectlhostpathpv", moveOperationLabel: retainedSourceDataKey},
+				},
+				Data: map[string]string{retainedSourceDataKey: string(buf)},
+			})
+			return err
+		} else if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[retainedSourceDataKey] = string(buf)
+		_, err = clientset.Core().ConfigMaps(moveOperationNamespace).Update(cm)
+		return err
+	})
+}
+
+func deleteRetainedSource(clientset *kubernetes.Clientset, id string) error {
+	err := clientset.Core().ConfigMaps(moveOperationNamespace).Delete(getRetainedSourceConfigMapName(id), &metav1.DeleteOptions{})
+	if err != nil && errors.IsNotFound(err) == false {
+		return err
+	}
+	return nil
+}
+
+// keepMoveSource records the from dirs of the finished move op.
+func keepMoveSource(clientset *kubernetes.Clientset, op *MoveOperation) error {
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	src := newRetainedSource(op, pvs)
+	if err := saveRetainedSource(clientset, src); err != nil {
+		return fmt.Errorf("save kept source %s err:%v", src.ID, err)
+	}
+	fmt.Printf("%sThe source %s:%v (%s) is kept, delete it with move cleanup-source %s\n", op.logPrefix(),
+		src.Node, op.FromDirs, strings.Trim(convertIntToString(src.size()), " "), src.ID)
+	return nil
+}
+
+func printRetainedSources(sources []*RetainedSource, out io.Writer) {
+	displayer := NewDisplayer("  ", "", "Move", "Node", "Path", "Size", "MovedTo", "Time")
+	var total int64
+	for _, src := range sources {
+		for _, p := range src.Paths {
+			displayer.AddLine(src.ID, src.Node, p.Path, strings.Trim(convertIntToString(p.Size), " "),
+				fmt.Sprintf("%s:%s", src.ToNode, p.ToPath), src.Time)
+		}
+		total += src.size()
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "Kept sources: %d, Size: %s\n", len(sources), strings.Trim(convertIntToString(total), " "))
+}
+
+// listMoveSources prints the kept sources of the node to node moves.
+func listMoveSources(clientset *kubernetes.Clientset, out io.Writer) error {
+	sources, err := listRetainedSources(clientset)
+	if err != nil {
+		return err
+	}
+	printRetainedSources(sources, out)
+	return nil
+}
+
+func getCleanupSourcePodName(id string, i int) string {
+	return fmt.Sprintf("cleanup-source-%s-%d", id, i)
+}
+
+// cleanupMoveSource deletes the kept source of move id by a helper pod on its
+// node for every path, and then the record of it. A path which is the mount
+// path of a pv again, e.g. after the data was moved back, is not deleted.
+func cleanupMoveSource(clientset *kubernetes.Clientset, id, image string, timeout int, force, dryRun bool, out io.Writer) error {
+	src, err := getRetainedSource(clientset, id)
+	if err != nil {
+		return err
+	} else if src == nil {
+		return fmt.Errorf("kept source %s is not found", id)
+	}
+	printRetainedSources([]*RetainedSource{src}, out)
+
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	for _, p := range src.Paths {
+		if base := path.Base(p.Path); base == "/" || base == "." || base == ".." {
+			return fmt.Errorf("%s:%s is not a quota path, it is not deleted", src.Node, p.Path)
+		}
+		if pv := getPVByNodeMountPath(clientset, pvs, src.Node, p.Path); pv != nil {
+			return fmt.Errorf("%s:%s is a mount path of pv %s, it is not deleted", src.Node, p.Path, pv.Name)
+		}
+	}
+	pods := make([]*v1.Pod, 0, len(src.Paths))
+	for i, p := range src.Paths {
+		pods = append(pods, newCleanupSourcePod(src.Node, getCleanupSourcePodName(src.ID, i), p.Path, image, timeout))
+	}
+	if dryRun {
+		plan := NewDryRunPlan()
+		for _, pod := range pods {
+			plan.CreatePod(pod)
+			plan.DeletePods([]*v1.Pod{pod})
+		}
+		plan.addLine("delete configmap %s/%s", moveOperationNamespace, getRetainedSourceConfigMapName(src.ID))
+		plan.Fprint(out)
+		return nil
+	}
+	if force == false {
+		fmt.Printf("Are you sure to delete these kept sources (y/n):")
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
+		}
+	}
+
+	for i, pod := range pods {
+		fmt.Fprintf(out, "Delete %s:%s:", src.Node, src.Paths[i].Path)
+		if err := runCleanupSourcePod(clientset, pod, timeout); err != nil {
+			fmt.Fprintf(out, " Fail\n")
+			return err
+		}
+		fmt.Fprintf(out, " OK\n")
+	}
+	if err := deleteRetainedSource(clientset, src.ID); err != nil {
+		return fmt.Errorf("delete kept source %s err:%v", src.ID, err)
+	}
+	fmt.Fprintf(out, "Kept source %s is deleted, %s freed\n", src.ID, strings.Trim(convertIntToString(src.size()), " "))
+	return nil
+}
+
+func runCleanupSourcePod(clientset *kubernetes.Clientset, pod *v1.Pod, timeout int) error {
+	WaitPodsDeleted(clientset, pod.Spec.NodeName, []*v1.Pod{pod}, true)
+	created, err := clientset.Core().Pods(pod.Namespace).Create(pod)
+	if err != nil {
+		return fmt.Errorf("create pod %s err:%v", pod.Name, err)
+	}
+	defer func() {
+		if err := WaitPodsDeleted(clientset, created.Spec.NodeName, []*v1.Pod{created}, true); err != nil {
+			fmt.Printf("\nclean : delele pod %s:%s err:%v\n", created.Namespace, created.Name, err)
+		}
+	}()
+	if err := WaitPodQuit(clientset, []*v1.Pod{created}, timeout); err != nil {
+		return fmt.Errorf("wait pod %s err:%v", created.Name, err)
+	}
+	return nil
+}
+
+func newCleanupSourcePod(nodeName, podName, sourcePath, image string, timeout int) *v1.Pod {
+	deadline := int64(timeout)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: helperPodNamespace(),
+		},
+		Spec: v1.PodSpec{
+			NodeName:              nodeName,
+			ActiveDeadlineSeconds: &deadline,
+			RestartPolicy:         v1.RestartPolicyNever,
+			Volumes: []v1.Volume{
+				{
+					Name: "sourcedir",
+					VolumeSource: v1.VolumeSource{
+						HostPath: &v1.HostPathVolumeSource{
+							Path: path.Dir(sourcePath),
+						},
+					},
+				},
+			},
+			Containers: []v1.Container{
+				{
+					Name:            "cleanup",
+					Image:           image,
+					ImagePullPolicy: v1.PullIfNotPresent,
+					Command:         []string{"/bin/sh"},
+					Args:            []string{"-c", fmt.Sprintf("rm -rf /sourcedir/%s", path.Base(sourcePath))},
+					VolumeMounts: []v1.VolumeMount{
+						{
+							Name:      "sourcedir",
+							MountPath: "/sourcedir",
+						},
+					},
+				},
+			},
+		},
+	}
+	return applyHelperPodTemplate(pod)
+}
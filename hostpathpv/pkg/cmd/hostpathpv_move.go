@@ -22,9 +22,9 @@ import (
 	"os"
 	"os/signal"
 	"path"
-	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -38,6 +38,7 @@ import (
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/kubernetes/pkg/kubectl/util/templates"
 )
 
@@ -129,34 +130,107 @@ var (
 	move_valid_resources = `Valid resource types include:
 
     * node
+    * disk
+    * pod
+    * pv
+    * sources
+    * cleanup-source
     `
 
 	move_long = templates.LongDesc(`
 		Move node quota path from one disk to other disk.
 
+		move node moves quota paths on one node or from one node to another node. move
+		disk NODE:DISKPATH disables a quota disk and moves its keep quota paths to the
+		other disks of the node. move pod and move pv move the keep quota paths of a pod
+		or the quota paths of a pv to --to-node, move -f runs the moves of a plan file,
+		e.g. the one saved by rebalance. move sources and move cleanup-source list and
+		delete the from dirs kept by --keep-source.
+
+		A node to node move stops the pods of the quota paths, copies the data by helper
+		pods, changes the pv mount paths and waits for the pods on the to node. Its
+		progress is saved in a configmap in kube-system, listed by
+		kubectl get configmap -n kube-system -l hostpathpv-operation=move. A move which
+		fails before the pv mount paths are changed is rolled back at once, one which
+		fails after that or is killed can be continued with --resume=ID, and rolled back
+		with --abort=ID as long as its pv mount paths are not changed.
+
 		` + move_valid_resources)
 
 	move_example = templates.Examples(`
 		# Move quota path.
 		
 		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1,/xfs/disk2/dir2 --to=node2:/xfs/disk2,/xfs/disk3
+
+		# Move quota path and verify the copied data before using it.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --verify=true
+
+		# Copy while the pods are running and stop them only for the final sync.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --presync=true --presyncmaxdelta=512
+
+		# Move quota paths at most 50MB/s in total, 2 dirs at a time, with the lowest io priority.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1,/xfs/disk1/dir2,/xfs/disk1/dir3 --to=node2:/xfs/disk2 --movebwlimit=50 --moveparallel=2 --moveionice=7
+
+		# Move all quota paths of the disk /xfs/disk1 of node1 to its other disks.
+		kubectl hostpathpv move disk node1:/xfs/disk1
+
+		# Move the keep quota paths of pod default/web-0 to the disks of node2 with the most free quota.
+		kubectl hostpathpv move pod default/web-0 --to-node=node2
+
+		# Move the quota paths of pv data-pv on node1 to the disk /xfs/disk2 of node3.
+		kubectl hostpathpv move pv data-pv --node=node1 --to-node=node3 --to-disks=/xfs/disk2
+
+		# Run the moves of the plan file plan.yaml, 2 at a time.
+		# kind: HostPathPVMovePlan
+		# moves:
+		# - pod: default/web-0
+		#   to: node2
+		# - pv: data-pv
+		#   node: node1
+		#   to: node3:/xfs/disk2
+		# - from: node1:/xfs/disk1/dir1
+		#   to: node2:/xfs/disk1
+		kubectl hostpathpv move -f plan.yaml --parallel=2
+
+		# Move the pods of a StatefulSet without cordoning the nodes.
+		kubectl hostpathpv move pod default/web-0 --to-node=node2 --scaledown=true --fence=none
+
+		# Move quota path with helper pods which tolerate the taints of the storage nodes.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --podtolerations=storage:NoSchedule --podpriorityclass=system-node-critical
+
+		# Move quota path by scp over ssh instead of hostpathpv-mover.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --mover=ssh
+
+		# Move quota path in a cluster without the move image, by tar through this command.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --transport=exec --moveimage=127.0.0.1:29006/library/busybox:1.28
+
+		# Move quota path and keep the source, then list the kept sources and delete them.
+		kubectl hostpathpv move node --from=node1:/xfs/disk1/dir1 --to=node2:/xfs/disk2 --keep-source=true
+		kubectl hostpathpv move sources
+		kubectl hostpathpv move cleanup-source 3f2a9c01d4
+
+		# Continue an interrupted move.
+		kubectl hostpathpv move node --resume=3f2a9c01d4
+
+		# Roll back an interrupted move.
+		kubectl hostpathpv move node --abort=3f2a9c01d4
 		`)
 )
 
 const (
-	default_move_busyboximage = "127.0.0.1:29006/library/hostpathscpmove:v3.1"
+	default_move_busyboximage = "127.0.0.1:29006/library/hostpathscpmove:v5.0"
 )
 
 type cleanDeferFun func()
 
-func NewCmdHostPathPVMove(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVMove(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "move (TYPE/NAME ...) [flags]",
 		Short:   T("Move quota path"),
 		Long:    move_long,
 		Example: move_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunMove(client, out, errOut, cmd, args)
+			err := RunMove(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunMove err:%v\n", err)
 			}
@@ -165,15 +239,21 @@ func NewCmdHostPathPVMove(client *kubernetes.Clientset, out io.Writer, errOut io
 	cmd.Flags().String("from", "", "Move quota path from")
 	cmd.Flags().String("to", "", "Move quota to")
 	cmd.Flags().Bool("force", false, "Move force with no confirmation")
-	cmd.Flags().Bool("alwayspullmoveimage", false, "Move pod pull images alwasy")
-	cmd.Flags().Int("movetimeout", 100000, "Move pod scp timeout")
-	cmd.Flags().Int("movepodmemlimit", 1024, "Move pod memory MB")
-	cmd.Flags().Int("tmppvkeepwait", 60, "Wait time at create tmp pv")
-	cmd.Flags().String("moveimage", default_move_busyboximage, "Image create to move dir")
+	addMoveOptionsFlags(cmd)
+	cmd.Flags().String("resume", "", "Continue the interrupted node to node move of the id")
+	cmd.Flags().String("abort", "", "Roll back the interrupted node to node move of the id, the tmp pods and pv and the copied data are deleted and the nodes and workloads are restored, not once the pv mount paths are changed")
+	cmd.Flags().String("node", "", "Node of the quota paths of move pod and move pv, the node of the pod or the only mount node of the pv if it is empty")
+	cmd.Flags().String("to-node", "", "Node to move the quota paths of move pod and move pv to")
+	cmd.Flags().StringSlice("to-disks", []string{}, "Disks of --to-node for the quota paths of move pod and move pv in path order, one disk for all, or the disks with the most free quota if it is empty")
+	cmd.Flags().StringP("filename", "f", "", "Plan file of the moves to run")
+	cmd.Flags().Int("parallel", 1, "Max moves of the plan file at the same time, the moves of one node are always one by one")
 	return cmd
 }
 
-func RunMove(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunMove(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	if filename := GetFlagString(cmd, "filename"); filename != "" {
+		return runMovePlanFile(f, out, errOut, cmd, filename)
+	}
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", move_valid_resources)
 		usageString := "Required resource not specified."
@@ -184,17 +264,56 @@ func RunMove(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.
 	fromDir := GetFlagString(cmd, "from")
 	toDir := GetFlagString(cmd, "to")
 	moveForce := GetFlagBool(cmd, "force")
-	moveImage := GetFlagString(cmd, "moveimage")
-	moveTimeout := GetFlagInt(cmd, "movetimeout")
-	movepodmemlimit := GetFlagInt(cmd, "movepodmemlimit")
-	alwayspullmoveimage := GetFlagBool(cmd, "alwayspullmoveimage")
-	tmppvkeepwait := GetFlagInt(cmd, "tmppvkeepwait")
+	dryRun := isDryRun(cmd)
+	opts, err := getMoveOptions(cmd)
+	if err != nil {
+		return UsageErrorf(cmd, "%v", err)
+	}
+	resumeID := GetFlagString(cmd, "resume")
+	abortID := GetFlagString(cmd, "abort")
+
+	if resumeID != "" || abortID != "" {
+		if resumeID != "" && abortID != "" {
+			return UsageErrorf(cmd, "--resume and --abort can not be used together")
+		}
+		if resource != "node" && resource != "nodes" {
+			return UsageErrorf(cmd, "--resume and --abort are only supported by node")
+		}
+		clientset, err := f.ClientSet()
+		if err != nil {
+			return err
+		}
+		config, err := f.ToRESTConfig()
+		if err != nil {
+			return err
+		}
+		if resumeID != "" {
+			err = resumeMove(clientset, config, resumeID, moveForce, dryRun)
+		} else {
+			err = abortMove(clientset, abortID, moveForce, dryRun)
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+		}
+		return nil
+	}
 
-	if fromDir == "" || toDir == "" {
+	isDisk := resource == "disk" || resource == "disks"
+	isPod := resource == "pod" || resource == "pods"
+	isPV := resource == "pv" || resource == "pvs"
+	if (resource == "node" || resource == "nodes") && (fromDir == "" || toDir == "") {
 		fmt.Fprint(errOut, "Please input move from path and to path")
 		return UsageErrorf(cmd, "input error")
 	}
 
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	config, err := f.ToRESTConfig()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "node" || resource == "nodes":
 		nodeName := ""
@@ -202,16 +321,65 @@ func RunMove(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.
 			nodeName = args[1]
 		}
 		if nodeName != "" {
-			err := moveNode(clientset, nodeName, fromDir, toDir, moveForce, moveImage, moveTimeout)
+			err := moveNode(clientset, nodeName, fromDir, toDir, moveForce, opts.moveImage, opts.moveTimeout, opts.stallTimeout, dryRun)
 			if err != nil {
 				fmt.Fprintf(errOut, "\nmove err: %v\n", err)
 			}
 		} else {
-			err := moveNodeToNode(clientset, fromDir, toDir, moveForce, moveImage, moveTimeout, tmppvkeepwait, movepodmemlimit, alwayspullmoveimage)
+			err := moveNodeToNode(clientset, config, fromDir, toDir, moveForce, opts, dryRun)
 			if err != nil {
 				fmt.Fprintf(errOut, "\nmove err: %v\n", err)
 			}
 		}
+	case isDisk:
+		if len(args) < 2 {
+			return UsageErrorf(cmd, "Required NODE:DISKPATH")
+		}
+		err := evacuateDisk(clientset, args[1], moveForce, opts.moveImage, opts.moveTimeout, opts.stallTimeout, dryRun, out)
+		if err != nil {
+			fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+		}
+	case resource == "sources" || resource == "source":
+		if err := listMoveSources(clientset, out); err != nil {
+			fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+		}
+	case resource == "cleanup-source":
+		if len(args) < 2 {
+			return UsageErrorf(cmd, "Required move ID of the kept source")
+		}
+		err := cleanupMoveSource(clientset, args[1], opts.moveImage, opts.moveTimeout, moveForce, dryRun, out)
+		if err != nil {
+			fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+		}
+	case isPod || isPV:
+		if len(args) < 2 {
+			return UsageErrorf(cmd, "Required %s NAME", resource)
+		}
+		toNode := GetFlagString(cmd, "to-node")
+		if toNode == "" {
+			return UsageErrorf(cmd, "Required --to-node")
+		}
+		toDisks, err := cmd.Flags().GetStringSlice("to-disks")
+		if err != nil {
+			return err
+		}
+		item := MovePlanItem{Node: GetFlagString(cmd, "node"), To: toNode}
+		if isPod {
+			item.Pod = args[1]
+			if strings.Contains(item.Pod, "/") == false {
+				namespace, err := f.Namespace()
+				if err != nil {
+					return err
+				}
+				item.Pod = namespace + "/" + item.Pod
+			}
+		} else {
+			item.PV = args[1]
+		}
+		err = movePodOrPV(clientset, config, item, FilterEmptyStr(toDisks), moveForce, opts, dryRun, out)
+		if err != nil {
+			fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+		}
 	default:
 		fmt.Fprint(errOut, "You must specify the type of resource to describe. ", move_valid_resources)
 		usageString := "Required resource not suport."
@@ -221,6 +389,29 @@ func RunMove(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.
 	return nil
 }
 
+func runMovePlanFile(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, filename string) error {
+	parallel := GetFlagInt(cmd, "parallel")
+	if parallel < 1 {
+		return UsageErrorf(cmd, "--parallel should be > 0")
+	}
+	opts, err := getMoveOptions(cmd)
+	if err != nil {
+		return UsageErrorf(cmd, "%v", err)
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	config, err := f.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	if err := moveByPlanFile(clientset, config, filename, opts, parallel, GetFlagBool(cmd, "force"), isDryRun(cmd), out); err != nil {
+		fmt.Fprintf(errOut, "\nmove err: %v\n", err)
+	}
+	return nil
+}
+
 func checkMoveNodeToNodePath(p string) (node string, dirs []string, err error) {
 	strs := strings.Split(p, ":")
 	if len(strs) != 2 {
@@ -233,6 +424,22 @@ func checkMoveNodeToNodePath(p string) (node string, dirs []string, err error) {
 	return strs[0], FilterEmptyStr(paths), nil
 }
 
+// expandMoveToDirs returns a to disk for every from dir, one to disk is the
+// to disk of all from dirs.
+func expandMoveToDirs(fromDirs, toDirs []string) ([]string, error) {
+	if len(toDirs) == 1 && len(fromDirs) > 1 {
+		ret := make([]string, 0, len(fromDirs))
+		for range fromDirs {
+			ret = append(ret, toDirs[0])
+		}
+		return ret, nil
+	}
+	if len(fromDirs) != len(toDirs) {
+		return nil, fmt.Errorf("len(fromDirs) != len(toDirs)")
+	}
+	return toDirs, nil
+}
+
 func getPodHostPaths(podnamespace, podname, nodename string, pvs *v1.PersistentVolumeList) (keepPaths, noneKeepPaths []string) {
 	for _, pv := range pvs.Items {
 		if algorithm.IsCommonHostPathPV(&pv) == false {
@@ -323,17 +530,23 @@ func getTodirsByFromDirs(frompaths, topaths []string) []string {
 }
 
 var cleanDeferFunList []cleanDeferFun
+var cleanDeferFunLock sync.Mutex
 
 func addCleanDeferFun(fun cleanDeferFun) {
+	cleanDeferFunLock.Lock()
+	defer cleanDeferFunLock.Unlock()
 	cleanDeferFunList = append(cleanDeferFunList, fun)
 }
 func runCleanDeferFun() {
+	cleanDeferFunLock.Lock()
+	funs := cleanDeferFunList
+	cleanDeferFunList = make([]cleanDeferFun, 0, 10)
+	cleanDeferFunLock.Unlock()
 	fmt.Printf("Do cleanup work...")
-	for _, fun := range cleanDeferFunList {
+	for _, fun := range funs {
 		fun()
 	}
 	fmt.Println()
-	cleanDeferFunList = make([]cleanDeferFun, 0, 10)
 }
 
 func handleSignal(ch chan os.Signal) {
@@ -345,18 +558,10 @@ func handleSignal(ch chan os.Signal) {
 	os.Exit(0)
 }
 
-func moveNodeToNode(clientset *kubernetes.Clientset, fromDir, toDir string, moveForce bool, moveImage string, movetimeout, tmppvkeepwait, movepodmemlimit int, alwayspullmoveimage bool) error {
-	cleanDeferFunList = make([]cleanDeferFun, 0, 10)
-	defer runCleanDeferFun()
-	signalChan := make(chan os.Signal)
-	go handleSignal(signalChan)
-
-	signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGINT)
-
+func moveNodeToNode(clientset *kubernetes.Clientset, config *rest.Config, fromDir, toDir string, moveForce bool, opts moveOptions, dryRun bool) error {
 	var fromNodeName, toNodeName string
 	var fromDirs, toDirs []string
 	var err error
-	var step int = 1
 	pvs, errGetPVs := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
 	if errGetPVs != nil {
 		return fmt.Errorf("get pvs err:%v", errGetPVs)
@@ -374,9 +579,9 @@ func moveNodeToNode(clientset *kubernetes.Clientset, fromDir, toDir string, move
 		fmt.Printf(" Fail\n")
 		return fmt.Errorf("to dir %s err", toDir)
 	}
-	if len(fromDirs) != len(toDirs) {
+	if toDirs, err = expandMoveToDirs(fromDirs, toDirs); err != nil {
 		fmt.Printf(" Fail\n")
-		return fmt.Errorf("len(fromDirs) != len(toDirs)")
+		return err
 	}
 
 	nodeFrom, errGetNode1 := clientset.Core().Nodes().Get(fromNodeName, metav1.GetOptions{})
@@ -394,6 +599,19 @@ func moveNodeToNode(clientset *kubernetes.Clientset, fromDir, toDir string, move
 	for i := range fromDirs {
 		fmt.Printf("%s:%s -> %s:%s\n", fromNodeName, path.Clean(fromDirs[i]), toNodeName, path.Clean(toDirs[i]))
 	}
+	op := opts.newMoveOperation(fromNodeName, toNodeName, fromDirs, toDirs)
+	if dryRun {
+		if err := checkMovePathsIsBelongOnePod(fromDirs, allPods, pvs, fromNodeName); err != nil {
+			return err
+		}
+		if err := CheckCanMove(clientset, nodeFrom, nodeTo, pvs, fromDirs, toDirs); err != nil {
+			return err
+		}
+		if err := checkMovePlacement(clientset, op.placement(), nodeFrom, nodeTo, nil, pvs, allPods, fromDirs); err != nil {
+			return err
+		}
+		return printMoveNodeToNodePlan(pvs, allPods, op)
+	}
 	if moveForce == false {
 		fmt.Printf("Are you sure to move these hostpaths (y/n):")
 		var ans byte
@@ -402,226 +620,768 @@ func moveNodeToNode(clientset *kubernetes.Clientset, fromDir, toDir string, move
 			return nil
 		}
 	}
-	//************************************ step 1 ***********************************/
-	//fmt.Printf("(Step %d) Start check quota path is moveable:", step)
-	statueChan := make(chan string, 0)
-	defer close(statueChan)
-	stepPrintf(statueChan, "(Step %d) Start check quota path is moveable:", step)
-	if err := checkMovePathsIsBelongOnePod(fromDirs, allPods, pvs, fromNodeName); err != nil {
-		statueChan <- "Fail"
+	if exist, err := getMoveOperation(clientset, op.ID); err != nil {
 		return err
+	} else if exist != nil {
+		return fmt.Errorf("move %s of these hostpaths is not finished, %s", exist.ID, exist.getContinueHint(""))
 	}
-	if err := CheckCanMove(clientset, nodeFrom, nodeTo, pvs, fromDirs, toDirs); err != nil {
-		statueChan <- "Fail"
-		runtime.Gosched()
-		return err
-	}
-	step++
-	statueChan <- "OK"
-	runtime.Gosched()
-
-	//************************************ step 2 ***********************************/
-	pvName := fmt.Sprintf("move-%s-tmp-pv-%s", toNodeName, getHashStr(getTodirsByFromDirs(fromDirs, toDirs), 5))
-	stepPrintf(statueChan, "(Step %d) Start create tmp pv %s and sleep 10s to keep dir in %s:", step, pvName, toNodeName)
-
-	//fromDirQuotaSize, _, _ := getNodeQuotaPathQuotaSize(pvs, nodeFrom.Name, fromDir)
-	if err, pv := CreateTmpPV(clientset, pvName, toNodeName, getTodirsByFromDirs(fromDirs, toDirs), 0); err != nil {
-		statueChan <- "Fail"
-		runtime.Gosched()
-		return fmt.Errorf("create pv:%s err:%v\n", pvName, err)
-	} else {
-		addCleanDeferFun(func() {
-			errDeletePV := deletePV(clientset, pv)
-			if errDeletePV != nil {
-				fmt.Printf("\nclean : delete pv %s err:%v\n", pv.Name, errDeletePV)
-			} else {
-				//fmt.Printf("\nclean : delete pv %s sucess\n", pv.Name)
-			}
-		})
-	}
-	step++
+	fmt.Printf("Move id: %s\n", op.ID)
+	return runMoveOperation(clientset, config, op)
+}
 
-	stop := make(chan struct{}, 0)
-	printTimeDelay(getDelayStyle1(tmppvkeepwait, 1*time.Second, stop), stop)
-	time.Sleep(time.Duration(tmppvkeepwait) * time.Second)
-	stop <- struct{}{}
-	close(stop)
-	time.Sleep(10 * time.Microsecond)
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
-
-	//************************************ step 3 ***********************************/
-	stepPrintf(statueChan, "(Step %d) Start set node %s, %s unscheduleable:", step, fromNodeName, toNodeName)
-	var setNodeUnScheduled []string
-	if setNodeUnScheduled, err = SetNodeScheduleable(clientset, []string{fromNodeName, toNodeName}, true); err != nil {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("set node %s scheduleable false err:%v\n", fromNodeName, err)
+const (
+	moveStepCheck = iota + 1
+	moveStepCreateTmpPV
+	moveStepPreSync
+	moveStepSetUnscheduleable
+	moveStepDeletePods
+	moveStepWaitPodsDeleted
+	moveStepCreateFromPod
+	moveStepWaitFromPod
+	moveStepCreateMovePod
+	moveStepWaitMovePod
+	moveStepWaitMove
+	moveStepVerify
+	moveStepChangeMountPath
+	moveStepSetScheduleable
+	moveStepRestoreWorkloads
+	moveStepWaitPods
+)
+
+type moveStep struct {
+	name func() string
+	run  func() error
+}
+
+// runMoveOperation runs the steps of op which are not completed yet and saves
+// op after every step. When it fails or is interrupted before the pv mount
+// paths are changed it is rolled back as abortMove does, after that everything
+// is kept as it is so that the move can be resumed later.
+func runMoveOperation(clientset *kubernetes.Clientset, config *rest.Config, op *MoveOperation) error {
+	finished := false
+	cleanup := func() {
+		if finished || op.CompletedStep == 0 {
+			return
+		}
+		if op.canAbort() == false {
+			if err := deleteMoveTmpPods(clientset, op); err != nil {
+				fmt.Printf("\nclean : delele move pods err:%v\n", err)
+			}
+			fmt.Printf("\n%smove %s is stopped after step %d, the pv mount paths are changed to %s, %s",
+				op.logPrefix(), op.ID, op.CompletedStep, op.ToNode, op.getContinueHint(""))
+			return
+		}
+		rb, err := newMoveRollback(clientset, op)
+		if err == nil {
+			err = rb.run(clientset, op)
+		}
+		if err != nil {
+			fmt.Printf("\n%sroll back move %s after step %d err:%v, %s",
+				op.logPrefix(), op.ID, op.CompletedStep, err, op.getContinueHint(""))
+			return
+		}
+		fmt.Printf("\n%smove %s is rolled back after step %d", op.logPrefix(), op.ID, op.CompletedStep)
+	}
+	if op.quiet {
+		// the command running the moves handles the signals.
+		var once sync.Once
+		clean := func() { once.Do(cleanup) }
+		addCleanDeferFun(clean)
+		defer clean()
 	} else {
-		addCleanDeferFun(func() {
-			SetNodeScheduleable(clientset, setNodeUnScheduled, false)
-		})
+		cleanDeferFunList = make([]cleanDeferFun, 0, 10)
+		defer runCleanDeferFun()
+		signalChan := make(chan os.Signal)
+		go handleSignal(signalChan)
+		signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGINT)
+		addCleanDeferFun(cleanup)
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
 
-	//************************************ step 4 ***********************************/
-	pods, err := GetQuotaPathUsePods(allPods, pvs, fromNodeName, fromDirs[0])
-	if err != nil {
-		return fmt.Errorf("getQuotaPathUsePods err:%v", err)
+	pvs, errGetPVs := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if errGetPVs != nil {
+		return fmt.Errorf("get pvs err:%v", errGetPVs)
 	}
-	names := make([]string, 0, len(pods))
-	for _, pod := range pods {
-		names = append(names, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	allPods, errPods := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if errPods != nil {
+		return fmt.Errorf("get pods err:%v", errPods)
 	}
-	stepPrintf(statueChan, "(Step %d) Start delete pods[%v]:", step, names)
-	if err := DeletePods(clientset, fromNodeName, pods, 0); err != nil {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("delete pods err:%v\n", err)
+	nodeFrom, errGetNode1 := clientset.Core().Nodes().Get(op.FromNode, metav1.GetOptions{})
+	if errGetNode1 != nil {
+		return fmt.Errorf("get from node %s err:%v", op.FromNode, errGetNode1)
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
-
-	//************************************ step 5 ***********************************/
-	stepPrintf(statueChan, "(Step %d) Start wait pods[%v] deleted:", step, names)
-	if err := WaitPodsDeleted(clientset, fromNodeName, pods, false); err != nil {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("wait delete pods err:%v\n", err)
+	nodeTo, errGetNode2 := clientset.Core().Nodes().Get(op.ToNode, metav1.GetOptions{})
+	if errGetNode2 != nil {
+		return fmt.Errorf("get to node %s err:%v", op.ToNode, errGetNode2)
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
-
-	//************************************ step 6 ***********************************/
-	podFromName := fmt.Sprintf("move-%s-tmp-pod-from-%s", fromNodeName, getHashStr(fromDirs, 5))
-	stepPrintf(statueChan, "(Step %d) Start create from pod to move:", step)
-	var tmpPodFrom *v1.Pod
-	var errCreateTmpPodFrom error
-	if errCreateTmpPodFrom, tmpPodFrom = CreateTmpPodFrom(clientset, fromNodeName, podFromName, fromDirs[0], moveImage, movepodmemlimit, alwayspullmoveimage); errCreateTmpPodFrom != nil {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("create pod:%s err:%v\n", podFromName, errCreateTmpPodFrom)
-	} else {
-		addCleanDeferFun(func() {
-			errPodDelete := WaitPodsDeleted(clientset, fromNodeName, []*v1.Pod{tmpPodFrom}, true)
-			if errPodDelete != nil {
-				fmt.Printf("\nclean : delele pod %s:%s err:%v\n", tmpPodFrom.Namespace, tmpPodFrom.Name, errPodDelete)
-			} else {
-				//fmt.Printf("\nclean : delele pod %s:%s success\n", tmpPod.Namespace, tmpPod.Name)
-			}
-		})
+	if op.CompletedStep = op.getResumeStep(); op.CompletedStep == moveStepWaitPodsDeleted {
+		if err := deleteMoveTmpPods(clientset, op); err != nil {
+			return fmt.Errorf("delete move pods err:%v", err)
+		}
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
 
-	//************************************ step 7 ***********************************/
-	stepPrintf(statueChan, "(Step %d) Start wait from pod [%s] to running:", step, tmpPodFrom.Name)
+	var tmpPodFrom, tmpPodMove *v1.Pod
 	waitPodIp := ""
-	if pods, err := WaitPodRunning(clientset, fromNodeName, []*v1.Pod{tmpPodFrom}); err != nil || len(pods) != 1 {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("wait from pod [%s] to running err:%v\n", podFromName, err)
-	} else {
-		waitPodIp = pods[0].Status.PodIP
-		statueChan <- "OK"
-		time.Sleep(10 * time.Microsecond)
+	podNames := func(pods []*v1.Pod) []string {
+		names := make([]string, 0, len(pods))
+		for _, pod := range pods {
+			names = append(names, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+		}
+		return names
+	}
+	statueChan := make(chan string, 0)
+	defer close(statueChan)
+
+	steps := []moveStep{
+		{
+			name: func() string {
+				if op.placement() == movePlacementIgnore {
+					return "Start check quota path is moveable"
+				}
+				return "Start check quota path is moveable and the pods fit the to node"
+			},
+			run: func() error {
+				if err := checkMovePathsIsBelongOnePod(op.FromDirs, allPods, pvs, op.FromNode); err != nil {
+					return err
+				}
+				if err := CheckCanMove(clientset, nodeFrom, nodeTo, pvs, op.FromDirs, op.ToDirs); err != nil {
+					return err
+				}
+				return checkMovePlacement(clientset, op.placement(), nodeFrom, nodeTo, nil, pvs, allPods, op.FromDirs)
+			},
+		},
+		{
+			name: func() string {
+				return fmt.Sprintf("Start create tmp pv %s and sleep %ds to keep dir in %s", op.TmpPVName, op.TmpPVKeepWait, op.ToNode)
+			},
+			run: func() error {
+				if err, _ := CreateTmpPV(clientset, op.TmpPVName, op.ToNode, getTodirsByFromDirs(op.FromDirs, op.ToDirs), 0); err != nil {
+					return fmt.Errorf("create pv:%s err:%v\n", op.TmpPVName, err)
+				}
+				stop := make(chan struct{}, 0)
+				op.printProgress(getDelayStyle1(op.TmpPVKeepWait, 1*time.Second, stop), stop)
+				time.Sleep(time.Duration(op.TmpPVKeepWait) * time.Second)
+				stop <- struct{}{}
+				close(stop)
+				time.Sleep(10 * time.Microsecond)
+				return nil
+			},
+		},
+		{
+			name: func() string {
+				if op.PreSync == false {
+					return "Skip pre-sync data"
+				}
+				return fmt.Sprintf("Start pre-sync data, max delta=%dMB", op.PreSyncMaxDelta)
+			},
+			run: func() error {
+				if op.PreSync == false {
+					return nil
+				}
+				strChan := make(chan string, 0)
+				stop := make(chan struct{}, 0)
+				var lastLen int
+				op.printProgress(strChan, stop)
+				err := preSyncMove(clientset, op, strChan, &lastLen)
+				close(stop)
+				statueChan <- strconv.Itoa(lastLen)
+				return err
+			},
+		},
+		{
+			name: op.fenceStepName,
+			run: func() error {
+				return fenceMoveNodes(clientset, op, nodeFrom, nodeTo)
+			},
+		},
+		{
+			name: func() string {
+				if op.ScaleDown {
+					return "Start scale down the workloads of the pods using the quota paths"
+				}
+				return "Start delete the pods using the quota paths"
+			},
+			run: func() error {
+				// the pods are listed again, a pre-sync may have run for long
+				curPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+				if err != nil {
+					return fmt.Errorf("get pods err:%v", err)
+				}
+				usePods, err := GetQuotaPathUsePods(curPods, pvs, op.FromNode, op.FromDirs[0])
+				if err != nil {
+					return fmt.Errorf("getQuotaPathUsePods err:%v", err)
+				}
+				deletePods := usePods
+				if op.ScaleDown {
+					refs, others, err := getPodsWorkloads(clientset, usePods)
+					if err != nil {
+						return err
+					}
+					// the replicas are recorded only once, they are 0 when resumed
+					if op.ScaledWorkloads == nil {
+						op.ScaledWorkloads = refs
+					}
+					deletePods = others
+				}
+				op.DeletedPods = op.DeletedPods[:0]
+				for _, pod := range usePods {
+					ref := MovePodRef{Namespace: pod.Namespace, Name: pod.Name, UID: string(pod.UID)}
+					if owner := metav1.GetControllerOf(pod); owner != nil {
+						ref.Owner = owner.Kind + "/" + owner.Name
+					}
+					op.DeletedPods = append(op.DeletedPods, ref)
+				}
+				if err := saveMoveOperation(clientset, op); err != nil {
+					return fmt.Errorf("save move %s err:%v", op.ID, err)
+				}
+				if err := scaleDownWorkloads(clientset, op.ScaledWorkloads); err != nil {
+					return err
+				}
+				if err := DeletePods(clientset, op.FromNode, deletePods, 0); err != nil {
+					return fmt.Errorf("delete pods err:%v\n", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string { return fmt.Sprintf("Start wait pods%v deleted", podNames(op.deletedPods())) },
+			run: func() error {
+				if err := WaitPodsDeleted(clientset, op.FromNode, op.deletedPods(), false); err != nil {
+					return fmt.Errorf("wait delete pods err:%v\n", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string { return "Start create from pod to move" },
+			run: func() error {
+				var err error
+				if tmpPodFrom, err = createMoveFromPod(clientset, op); err != nil {
+					return fmt.Errorf("%v\n", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string { return fmt.Sprintf("Start wait from pod [%s] to running", op.FromPodName) },
+			run: func() error {
+				pods, err := WaitPodRunning(clientset, op.FromNode, []*v1.Pod{tmpPodFrom})
+				if err != nil || len(pods) != 1 {
+					return fmt.Errorf("wait from pod [%s] to running err:%v\n", op.FromPodName, err)
+				}
+				waitPodIp = pods[0].Status.PodIP
+				return nil
+			},
+		},
+		{
+			name: func() string { return fmt.Sprintf("Start create %s move pod :%s", op.moverName(), op.ToPodName) },
+			run: func() error {
+				var err error
+				tmpPodMove = newMoveToPod(op, waitPodIp, op.PreSync, GetQuotaPathsUsedSize(pvs, op.FromNode, op.FromDirs))
+				if err, tmpPodMove = createTmpPod(clientset, tmpPodMove); err != nil {
+					return fmt.Errorf("create pod move err:%v\n", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string { return fmt.Sprintf("Start wait to pod [%s] to running", op.ToPodName) },
+			run: func() error {
+				if pods, err := WaitPodRunning(clientset, op.ToNode, []*v1.Pod{tmpPodMove}); err != nil || len(pods) != 1 {
+					return fmt.Errorf("wait to pod [%s] to running err:%v\n", op.ToPodName, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string {
+				moveSize := GetQuotaPathsUsedSize(pvs, op.FromNode, op.FromDirs)
+				name := fmt.Sprintf("Start wait move size=%s , stallTimeout=%ds", strings.Trim(convertIntToString(moveSize), " "),
+					op.stallTimeout())
+				if op.Tuning.isSet() {
+					name += ", " + op.Tuning.String()
+				}
+				if eta := op.Tuning.estimateMoveTime(moveSize); eta > 0 {
+					name += fmt.Sprintf(", eta>=%ds", eta)
+				}
+				return name
+			},
+			run: func() error {
+				progress := newMoveProgress(GetQuotaPathsUsedSize(pvs, op.FromNode, op.FromDirs))
+				stopRead := make(chan struct{}, 0)
+				strChan := make(chan string, 0)
+				op.printProgress(strChan, stopRead)
+				var stateLen int
+				var quit func() (bool, error)
+				if op.isExecTransport() {
+					done := make(chan error, 1)
+					go func() {
+						done <- execMove(clientset, config, op, tmpPodFrom, tmpPodMove, progress)
+					}()
+					quit = func() (bool, error) {
+						select {
+						case err := <-done:
+							if err != nil {
+								return true, fmt.Errorf("exec move err:%v", err)
+							}
+							return true, nil
+						default:
+							return false, nil
+						}
+					}
+				} else {
+					followMovePodProgress(clientset, tmpPodMove, progress, op.progressParser(op.PreSync), stopRead)
+					quit = func() (bool, error) {
+						return isMovePodQuit(clientset, tmpPodMove)
+					}
+				}
+				err := waitMoveProgress(progress, op.stallTimeout(), quit, strChan, &stateLen)
+				close(stopRead)
+				statueChan <- strconv.Itoa(stateLen)
+				if op.isExecTransport() {
+					if err != nil {
+						return fmt.Errorf("%v\n", err)
+					}
+					return nil
+				}
+				if err != nil && op.isNativeMover() {
+					if _, moverErr := getMoverResult(clientset, tmpPodMove); moverErr != nil {
+						err = fmt.Errorf("%v, %v", err, moverErr)
+					}
+				}
+				if err != nil {
+					return fmt.Errorf("wait move pod:%s err:%v\n", op.ToPodName, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: func() string {
+				if op.Verify == false {
+					return "Skip verify moved data"
+				}
+				return "Start verify moved data"
+			},
+			run: func() error {
+				if op.Verify == false {
+					return nil
+				}
+				return verifyMove(clientset, config, pvs, op)
+			},
+		},
+		{
+			name: func() string { return "Start change PV mount history" },
+			run: func() error {
+				for i, fromDir := range op.FromDirs {
+					toPath := path.Join(op.ToDirs[i], path.Base(fromDir))
+					pv := getPVByNodeMountPath(clientset, pvs, op.FromNode, fromDir)
+					if pv == nil {
+						// changed before the move was interrupted
+						if getPVByNodeMountPath(clientset, pvs, op.ToNode, toPath) != nil {
+							continue
+						}
+						return fmt.Errorf("getPVByNodeMountPath err\n")
+					}
+					if err := changePVMountPath(clientset, pv, op.FromNode, op.ToNode, fromDir, toPath); err != nil {
+						return fmt.Errorf("changePVMountPath err:%v\n", err)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: op.unfenceStepName,
+			run: func() error {
+				return unfenceMoveNodes(clientset, op)
+			},
+		},
+		{
+			name: func() string {
+				if len(op.ScaledWorkloads) == 0 {
+					return "Skip restore workloads"
+				}
+				return fmt.Sprintf("Start restore workloads %v and wait their pods ready on %s, timeOut=%ds", op.ScaledWorkloads, op.ToNode, op.ReadyTimeout)
+			},
+			run: func() error {
+				if len(op.ScaledWorkloads) == 0 {
+					return nil
+				}
+				if err := restoreWorkloads(clientset, op.ScaledWorkloads); err != nil {
+					return err
+				}
+				return waitWorkloadsReady(clientset, op.ScaledWorkloads, op.ToNode, op.ReadyTimeout)
+			},
+		},
+		{
+			name: func() string {
+				if op.WaitPods == false || op.podsComeBack() == false {
+					return "Skip wait pods back"
+				}
+				return fmt.Sprintf("Start wait pods ready on %s and using the moved paths, timeOut=%ds", op.ToNode, op.ReadyTimeout)
+			},
+			run: func() error {
+				if op.WaitPods == false || op.podsComeBack() == false {
+					return nil
+				}
+				return waitMovedPodsBack(clientset, op, op.ReadyTimeout)
+			},
+		},
 	}
-	step++
 
-	//************************************ step 8 ***********************************/
-	var tmpPodMove *v1.Pod
-	var errCreateTmpPodMove error
-	podToName := fmt.Sprintf("move-%s-tmp-pod-to-%s", toNodeName, getHashStr(getTodirsByFromDirs(fromDirs, toDirs), 5))
-	stepPrintf(statueChan, "(Step %d) Start create scp move pod :%s", step, podToName)
-	if errCreateTmpPodMove, tmpPodMove = CreateTmpPodMove(clientset, toNodeName, podToName, waitPodIp, fromDirs, toDirs, moveImage, movepodmemlimit, alwayspullmoveimage); errCreateTmpPodMove != nil {
-		statueChan <- "Fail"
+	for i, s := range steps {
+		step := i + 1
+		if step <= op.CompletedStep {
+			fmt.Printf("%s(Step %d) %s: Done\n", op.logPrefix(), step, s.name())
+			continue
+		}
+		op.stepPrintf(statueChan, "(Step %d) %s:", step, s.name())
+		if err := s.run(); err != nil {
+			statueChan <- "Fail"
+			time.Sleep(10 * time.Microsecond)
+			return err
+		}
+		statueChan <- "OK"
 		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("create pod scp move err:%v\n", errCreateTmpPodMove)
-	} else {
-		addCleanDeferFun(func() {
-			errPodDelete := WaitPodsDeleted(clientset, toNodeName, []*v1.Pod{tmpPodMove}, true)
-			if errPodDelete != nil {
-				fmt.Printf("\nclean : delele pod %s:%s err:%v\n", tmpPodMove.Namespace, tmpPodMove.Name, errPodDelete)
+		op.CompletedStep = step
+		if step < len(steps) {
+			if err := saveMoveOperation(clientset, op); err != nil {
+				return fmt.Errorf("save move %s err:%v", op.ID, err)
 			}
-		})
+		}
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
+	finished = true
 
-	//************************************ step 9 *********************************Volume**/
-	stepPrintf(statueChan, "(Step %d) Start wait to pod [%s] to running:", step, tmpPodMove.Name)
+	if err := deleteMoveTmpPods(clientset, op); err != nil {
+		fmt.Printf("\nclean : delele move pods err:%v\n", err)
+	}
+	if err := deleteTmpPV(clientset, op.TmpPVName); err != nil {
+		fmt.Printf("\nclean : delete pv %s err:%v\n", op.TmpPVName, err)
+	}
+	if op.KeepSource {
+		if err := keepMoveSource(clientset, op); err != nil {
+			fmt.Printf("\n%skeep source %s:%v err:%v, it is left on the node without a record\n", op.logPrefix(), op.FromNode, op.FromDirs, err)
+		}
+	}
+	if err := deleteMoveOperation(clientset, op.ID); err != nil {
+		fmt.Printf("\nclean : delete move %s state err:%v\n", op.ID, err)
+	}
+	fmt.Printf("\n%sMove hostpaths from %s to %s success\n", op.logPrefix(), op.FromNode, op.ToNode)
+	return nil
+}
 
-	if pods, err := WaitPodRunning(clientset, toNodeName, []*v1.Pod{tmpPodMove}); err != nil || len(pods) != 1 {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("wait to pod [%s] to running err:%v\n", podFromName, err)
-	} else {
-		statueChan <- "OK"
-		time.Sleep(10 * time.Microsecond)
+// getResumeStep returns the completed step op is continued after. The tmp pods
+// and the copy progress are not kept, so an interrupted copy is started again
+// from the from pod creation.
+func (op *MoveOperation) getResumeStep() int {
+	if op.CompletedStep >= moveStepWaitPodsDeleted && op.CompletedStep < moveStepWaitMove {
+		return moveStepWaitPodsDeleted
 	}
-	step++
+	return op.CompletedStep
+}
 
-	//************************************ step 10 ***********************************/
-	moveSize := GetQuotaPathsUsedSize(pvs, fromNodeName, fromDirs)
-	timeOut := calcSizeShouldMoveTime(moveSize, movetimeout)
-	stepPrintf(statueChan, "(Step %d) Start wait move size=%s , timeOut=%ds:", step, strings.Trim(convertIntToString(moveSize), " "), timeOut)
-	//go testfun(clientset, tmpPodMove)
-	reader := getMovePodLogReader(clientset, tmpPodMove)
-	stopRead := make(chan struct{}, 0)
-	var stateLen int
-	printTimeDelay(getFromReader(reader, &stateLen), stopRead)
-	if err := WaitPodQuit(clientset, []*v1.Pod{tmpPodMove}, timeOut); err != nil {
-		close(stopRead)
-		statueChan <- strconv.Itoa(stateLen)
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("wait move pod:%s err:%v\n", tmpPodMove.Name, err)
+func printMoveOperation(op *MoveOperation) {
+	fmt.Printf("Move %s started at %s, %d of %d steps completed:\n", op.ID, op.StartTime, op.CompletedStep, moveStepWaitPods)
+	for i := range op.FromDirs {
+		fmt.Printf("%s:%s -> %s:%s\n", op.FromNode, op.FromDirs[i], op.ToNode, op.ToDirs[i])
 	}
-	close(stopRead)
-	step++
-	statueChan <- strconv.Itoa(stateLen)
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
+}
 
-	//************************************ step 11 ***********************************/
-	stepPrintf(statueChan, "(Step %d) Start change PV mount history", step)
+// resumeMove continues move id from its first not completed step.
+func resumeMove(clientset *kubernetes.Clientset, config *rest.Config, id string, moveForce, dryRun bool) error {
+	op, err := getMoveOperation(clientset, id)
+	if err != nil {
+		return err
+	} else if op == nil {
+		return fmt.Errorf("move %s is not found", id)
+	}
+	printMoveOperation(op)
+	helperPodTemplate = op.HelperPod
+	if dryRun {
+		fmt.Printf("Dry run, move %s would be resumed after step %d\n", id, op.CompletedStep)
+		return nil
+	}
+	if moveForce == false {
+		fmt.Printf("Are you sure to resume this move (y/n):")
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
+		}
+	}
+	return runMoveOperation(clientset, config, op)
+}
 
-	for i, fromDir := range fromDirs {
-		pv := getPVByNodeMountPath(clientset, pvs, fromNodeName, fromDir)
-		if pv == nil {
-			statueChan <- "Fail"
-			time.Sleep(10 * time.Microsecond)
-			return fmt.Errorf("getPVByNodeMountPath err\n")
+// abortMove rolls move id back: the tmp pods and pv are deleted, the changed pv
+// mount records are changed back, the data copied to the to node is deleted,
+// the nodes are unfenced again and the scaled down workloads are scaled back.
+// A move is not rolled back once its pv mount paths are changed, the pods may
+// use the data on the to node then.
+func abortMove(clientset *kubernetes.Clientset, id string, moveForce, dryRun bool) error {
+	op, err := getMoveOperation(clientset, id)
+	if err != nil {
+		return err
+	} else if op == nil {
+		return fmt.Errorf("move %s is not found", id)
+	}
+	printMoveOperation(op)
+	if op.canAbort() == false {
+		return fmt.Errorf("the pv mount paths of move %s are changed to %s, it can not be rolled back, continue it with --resume=%s", op.ID, op.ToNode, op.ID)
+	}
+	helperPodTemplate = op.HelperPod
+	rb, err := newMoveRollback(clientset, op)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		plan := NewDryRunPlan()
+		if err := rb.addPlan(plan, op); err != nil {
+			return err
 		}
-		if err := changePVMountPath(clientset, pv, fromNodeName, toNodeName, fromDir, path.Join(toDirs[i], path.Base(fromDir))); err != nil {
-			statueChan <- "Fail"
-			time.Sleep(10 * time.Microsecond)
-			return fmt.Errorf("changePVMountPath err:%v\n", err)
+		plan.Print()
+		return nil
+	}
+	if moveForce == false {
+		fmt.Printf("Are you sure to roll back this move (y/n):")
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
 		}
 	}
-	step++
-	statueChan <- "OK"
-	time.Sleep(10 * time.Microsecond)
+	if err := rb.run(clientset, op); err != nil {
+		return err
+	}
+	fmt.Printf("Move %s is rolled back, the data copied to %s is deleted\n", op.ID, op.ToNode)
+	return nil
+}
 
-	//************************************ step 12 ***********************************/
-	stepPrintf(statueChan, "(Step %d) Start set node %v scheduleable:", step, setNodeUnScheduled)
-	if _, err := SetNodeScheduleable(clientset, setNodeUnScheduled, false); err != nil {
-		statueChan <- "Fail"
-		time.Sleep(10 * time.Microsecond)
-		return fmt.Errorf("set node %s scheduleable true err:%v\n", fromNodeName, err)
+// canAbort is whether op can still be rolled back, that is its pv mount paths
+// are not all changed to the to node yet.
+func (op *MoveOperation) canAbort() bool {
+	return op.CompletedStep < moveStepChangeMountPath
+}
+
+// getContinueHint returns how the not finished op can be continued, cmd is the
+// command of --resume and --abort.
+func (op *MoveOperation) getContinueHint(cmd string) string {
+	if op.canAbort() == false {
+		return fmt.Sprintf("continue it with %s--resume=%s", cmd, op.ID)
 	}
-	step++
-	statueChan <- "OK"
+	return fmt.Sprintf("continue it with %s--resume=%s or roll it back with %s--abort=%s", cmd, op.ID, cmd, op.ID)
+}
 
-	time.Sleep(10 * time.Microsecond)
+// moveRollback is what rolling back a move changes.
+type moveRollback struct {
+	pvs *v1.PersistentVolumeList
+	// changedFrom and changedTo are the mount paths which are already changed
+	// to the to node.
+	changedFrom []string
+	changedTo   []string
+	copyPods    []*v1.Pod
+}
 
-	fmt.Printf("\nMove hostpaths from %s to %s success\n", fromNodeName, toNodeName)
+func newMoveRollback(clientset *kubernetes.Clientset, op *MoveOperation) (*moveRollback, error) {
+	pvs, errGetPVs := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if errGetPVs != nil {
+		return nil, fmt.Errorf("get pvs err:%v", errGetPVs)
+	}
+	return getMoveRollback(clientset, pvs, op), nil
+}
+
+func getMoveRollback(clientset *kubernetes.Clientset, pvs *v1.PersistentVolumeList, op *MoveOperation) *moveRollback {
+	rb := &moveRollback{pvs: pvs, changedFrom: make([]string, 0), changedTo: make([]string, 0)}
+	for i, fromDir := range op.FromDirs {
+		toPath := path.Join(op.ToDirs[i], path.Base(fromDir))
+		if getPVByNodeMountPath(clientset, pvs, op.FromNode, fromDir) == nil &&
+			getPVByNodeMountPath(clientset, pvs, op.ToNode, toPath) != nil {
+			rb.changedFrom = append(rb.changedFrom, fromDir)
+			rb.changedTo = append(rb.changedTo, toPath)
+		}
+	}
+	rb.copyPods = getAbortCopyPods(clientset, pvs, op, rb.changedTo)
+	return rb
+}
+
+func (rb *moveRollback) addPlan(plan *DryRunPlan, op *MoveOperation) error {
+	plan.DeletePods(op.tmpPods())
+	if err := addChangeMountPathPlan(plan, rb.pvs, op.ToNode, op.FromNode, rb.changedTo, rb.changedFrom); err != nil {
+		return err
+	}
+	for _, pod := range rb.copyPods {
+		plan.CreatePod(pod)
+		plan.DeletePods([]*v1.Pod{pod})
+	}
+	plan.DeletePV(op.TmpPVName)
+	addFencePlan(plan, op, false)
+	plan.ScaleWorkloads(op.ScaledWorkloads, false)
+	return nil
+}
+
+func (rb *moveRollback) run(clientset *kubernetes.Clientset, op *MoveOperation) error {
+	if err := deleteMoveTmpPods(clientset, op); err != nil {
+		return fmt.Errorf("delete move pods err:%v", err)
+	}
+	for i, toPath := range rb.changedTo {
+		pv := getPVByNodeMountPath(clientset, rb.pvs, op.ToNode, toPath)
+		if err := changePVMountPath(clientset, pv, op.ToNode, op.FromNode, toPath, rb.changedFrom[i]); err != nil {
+			return fmt.Errorf("change pv %s mount path back err:%v", pv.Name, err)
+		}
+	}
+	for _, pod := range rb.copyPods {
+		if err := runCleanupSourcePod(clientset, pod, op.MoveTimeout); err != nil {
+			return fmt.Errorf("delete data copied to %s err:%v", op.ToNode, err)
+		}
+	}
+	if err := deleteTmpPV(clientset, op.TmpPVName); err != nil {
+		return fmt.Errorf("delete pv %s err:%v", op.TmpPVName, err)
+	}
+	if err := unfenceMoveNodes(clientset, op); err != nil {
+		return err
+	}
+	if err := restoreWorkloads(clientset, op.ScaledWorkloads); err != nil {
+		return err
+	}
+	if err := deleteMoveOperation(clientset, op.ID); err != nil {
+		return fmt.Errorf("delete move %s state err:%v", op.ID, err)
+	}
+	return nil
+}
+
+// getAbortCopyPods returns the helper pods which delete the data op copied to
+// the to node. changedTo are mount paths which are changed back first, a path
+// which is a mount path of a pv after that is not deleted.
+func getAbortCopyPods(clientset *kubernetes.Clientset, pvs *v1.PersistentVolumeList, op *MoveOperation, changedTo []string) []*v1.Pod {
+	pods := make([]*v1.Pod, 0, len(op.FromDirs))
+	for i, fromDir := range op.FromDirs {
+		toPath := path.Join(op.ToDirs[i], path.Base(fromDir))
+		if base := path.Base(toPath); base == "/" || base == "." || base == ".." {
+			continue
+		}
+		if stringsContain(changedTo, toPath) == false && getPVByNodeMountPath(clientset, pvs, op.ToNode, toPath) != nil {
+			continue
+		}
+		pods = append(pods, newCleanupSourcePod(op.ToNode, getCleanupSourcePodName(op.ID, i), toPath, op.MoveImage, op.MoveTimeout))
+	}
+	return pods
+}
+
+func deleteTmpPV(clientset *kubernetes.Clientset, pvName string) error {
+	err := clientset.Core().PersistentVolumes().Delete(pvName, &metav1.DeleteOptions{})
+	if err != nil && IsNotFound(err) == false {
+		return err
+	}
+	return nil
+}
+
+func getMoveTmpPVName(toNodeName string, fromDirs, toDirs []string) string {
+	return fmt.Sprintf("move-%s-tmp-pv-%s", toNodeName, getHashStr(getTodirsByFromDirs(fromDirs, toDirs), 5))
+}
+
+func getMoveFromPodName(fromNodeName string, fromDirs []string) string {
+	return fmt.Sprintf("move-%s-tmp-pod-from-%s", fromNodeName, getHashStr(fromDirs, 5))
+}
+
+func getMoveToPodName(toNodeName string, fromDirs, toDirs []string) string {
+	return fmt.Sprintf("move-%s-tmp-pod-to-%s", toNodeName, getHashStr(getTodirsByFromDirs(fromDirs, toDirs), 5))
+}
+
+func printMoveNodeToNodePlan(pvs *v1.PersistentVolumeList, allPods *v1.PodList, op *MoveOperation) error {
+	plan := NewDryRunPlan()
+	tmpPV := newTmpPV(op.TmpPVName, op.ToNode, getTodirsByFromDirs(op.FromDirs, op.ToDirs), 0)
+	plan.CreatePV(tmpPV)
+	podFrom := newMoveFromPod(op)
+	if op.isNativeMover() {
+		plan.addLine("create secret %s/%s with a new mover credential", helperPodNamespace(), op.credentialName())
+	} else if op.isSSHMover() {
+		plan.addLine("create secret %s/%s with new ssh host and client keys", helperPodNamespace(), op.credentialName())
+	}
+	if op.PreSync {
+		plan.addLine("pre-sync by %s mover while the pods are running:", op.moverName())
+		plan.CreatePod(podFrom)
+		plan.CreatePod(newMoveToPod(op, "<from pod ip>", true, 0))
+		plan.addLine("repeat the sync pod until a pass transfers less than the max delta")
+	}
+	addFencePlan(plan, op, true)
+	pods, err := GetQuotaPathUsePods(allPods, pvs, op.FromNode, op.FromDirs[0])
+	if err != nil {
+		return fmt.Errorf("getQuotaPathUsePods err:%v", err)
+	}
+	if op.ScaleDown {
+		for _, pod := range pods {
+			if owner := metav1.GetControllerOf(pod); owner != nil {
+				plan.addLine("scale the workload of pod %s/%s (%s %s) down to stop the pod if its poddisruptionbudgets allow", pod.Namespace, pod.Name, owner.Kind, owner.Name)
+			} else {
+				plan.DeletePods([]*v1.Pod{pod})
+			}
+		}
+	} else {
+		plan.DeletePods(pods)
+	}
+	podMove := newMoveToPod(op, "<from pod ip>", op.PreSync, GetQuotaPathsUsedSize(pvs, op.FromNode, op.FromDirs))
+	if op.Tuning.isSet() {
+		plan.addLine("copy with %s", op.Tuning.String())
+	}
+	plan.CreatePod(podFrom)
+	plan.CreatePod(podMove)
+	if op.isExecTransport() {
+		plan.addLine("copy every from dir by exec of tar in %s and %s through this command", podFrom.Name, podMove.Name)
+	}
+	plan.addLine("stop the copy if nothing is moved for %ds", op.stallTimeout())
+	if op.Verify {
+		toPaths := getMoveVerifyToDirs(op.FromDirs, op.ToDirs)
+		plan.CreatePod(newTmpPodVerify(op.FromNode, getMoveVerifyPodName(op.FromNode, op.FromDirs), op.FromDirs, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage))
+		plan.CreatePod(newTmpPodVerify(op.ToNode, getMoveVerifyPodName(op.ToNode, toPaths), toPaths, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage))
+		plan.addLine("compare the md5 sum of every file, stop if any is different")
+	}
+	if err := addChangeMountPathPlan(plan, pvs, op.FromNode, op.ToNode, op.FromDirs, getTodirsByFromDirs(op.FromDirs, op.ToDirs)); err != nil {
+		return err
+	}
+	addFencePlan(plan, op, false)
+	if op.ScaleDown {
+		plan.addLine("scale the workloads back to their replicas and wait %ds for their pods ready on node %s", op.ReadyTimeout, op.ToNode)
+	}
+	if op.WaitPods {
+		for _, pod := range pods {
+			if metav1.GetControllerOf(pod) != nil {
+				plan.addLine("wait %ds for the recreated pods ready on node %s and using the moved paths", op.ReadyTimeout, op.ToNode)
+				break
+			}
+		}
+	}
+	plan.DeletePods([]*v1.Pod{podMove, podFrom})
+	if op.isNativeMover() || op.isSSHMover() {
+		plan.addLine("delete secret %s/%s", helperPodNamespace(), op.credentialName())
+	}
+	plan.DeletePV(tmpPV.Name)
+	if op.KeepSource {
+		plan.addLine("record the kept source %s:%v in configmap %s/%s", op.FromNode, op.FromDirs, moveOperationNamespace, getRetainedSourceConfigMapName(op.ID))
+	}
+	plan.Print()
+	return nil
+}
+
+// addChangeMountPathPlan adds the pv annotations diff of moving every fromDirs[i]
+// to nodeNameTo:toPaths[i].
+func addChangeMountPathPlan(plan *DryRunPlan, pvs *v1.PersistentVolumeList, nodeNameFrom, nodeNameTo string, fromDirs, toPaths []string) error {
+	oldPVs := make(map[string]*v1.PersistentVolume)
+	newPVs := make(map[string]*v1.PersistentVolume)
+	names := make([]string, 0, len(fromDirs))
+	for i, fromDir := range fromDirs {
+		pv := getPVByNodeMountPath(nil, pvs, nodeNameFrom, fromDir)
+		if pv == nil {
+			return fmt.Errorf("%s:%s is not a quota path of any pv", nodeNameFrom, fromDir)
+		}
+		if _, exist := newPVs[pv.Name]; exist == false {
+			oldPVs[pv.Name] = pv
+			newPVs[pv.Name] = pv.DeepCopy()
+			names = append(names, pv.Name)
+		}
+		if err := changeMountPath(newPVs[pv.Name], nodeNameFrom, nodeNameTo, fromDir, toPaths[i]); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		plan.UpdatePV(oldPVs[name], newPVs[name])
+	}
 	return nil
 }
 
@@ -645,7 +1405,7 @@ func getMovePodLogReader(clientset *kubernetes.Clientset, pod *v1.Pod) io.ReadCl
 	}
 	return readCloser
 }
-func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string, moveForce bool, moveImage string, movetimeout int) error {
+func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string, moveForce bool, moveImage string, movetimeout, stallTimeout int, dryRun bool) error {
 	pvs, errGetPVs := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
 	if errGetPVs != nil {
 		return fmt.Errorf("get pvs err:%v", errGetPVs)
@@ -658,6 +1418,12 @@ func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string,
 	if errPods != nil {
 		return fmt.Errorf("get pods err:%v", errPods)
 	}
+	if dryRun {
+		if err := CheckCanMove(clientset, node, node, pvs, []string{fromDir}, []string{toDir}); err != nil {
+			return err
+		}
+		return printMoveNodePlan(pvs, allPods, nodeName, fromDir, toDir, moveImage, movetimeout)
+	}
 	var step int = 1
 	// step 1
 	fmt.Printf("(Step %d) Start check quota path is moveable:", step)
@@ -741,7 +1507,7 @@ func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string,
 	fmt.Printf("(Step %d) Start create pod to move:", step)
 	var tmpPod *v1.Pod
 	var errCreateTmpPod error
-	if errCreateTmpPod, tmpPod = CreateTmpPod(clientset, nodeName, podName, fromDir, toDir, moveImage); errCreateTmpPod != nil {
+	if errCreateTmpPod, tmpPod = CreateTmpPod(clientset, nodeName, podName, fromDir, toDir, moveImage, movetimeout); errCreateTmpPod != nil {
 		fmt.Printf(" Fail\n")
 		fmt.Errorf("create pod:%s err:%v\n", podName, errCreateTmpPod)
 		return errCreateTmpPod
@@ -760,9 +1526,16 @@ func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string,
 
 	// step 7
 	moveSize := GetQuotaPathUsedSize(pvs, nodeName, fromDir)
-	timeOut := calcSizeShouldMoveTime(moveSize, movetimeout)
-	fmt.Printf("(Step %d) Start move size=%s , timeOut=%ds:", step, strings.Trim(convertIntToString(moveSize), " "), timeOut)
-	if err := WaitPodQuit(clientset, []*v1.Pod{tmpPod}, timeOut); err != nil {
+	fmt.Printf("(Step %d) Start move size=%s , stallTimeout=%ds:", step, strings.Trim(convertIntToString(moveSize), " "), stallTimeout)
+	progress := newMoveProgress(moveSize)
+	stopRead := make(chan struct{}, 0)
+	followMovePodProgress(clientset, tmpPod, progress, parseScpProgress, stopRead)
+	var stateLen int
+	err = waitMoveProgress(progress, stallTimeout, func() (bool, error) {
+		return isMovePodQuit(clientset, tmpPod)
+	}, nil, &stateLen)
+	close(stopRead)
+	if err != nil {
 		fmt.Printf(" Fail\n")
 		fmt.Errorf("wait move pod:%s err:%v\n", podName, err)
 		return err
@@ -799,6 +1572,30 @@ func moveNode(clientset *kubernetes.Clientset, nodeName, fromDir, toDir string,
 	return nil
 }
 
+func printMoveNodePlan(pvs *v1.PersistentVolumeList, allPods *v1.PodList, nodeName, fromDir, toDir, moveImage string, movetimeout int) error {
+	plan := NewDryRunPlan()
+	toPath := path.Join(toDir, path.Base(fromDir))
+	fromDirQuotaSize, _, _ := GetNodeQuotaPathQuotaSize(pvs, nodeName, fromDir)
+	tmpPV := newTmpPV(fmt.Sprintf("move-%s-tmp-pv", nodeName), nodeName, []string{toPath}, fromDirQuotaSize)
+	plan.CreatePV(tmpPV)
+	plan.SetNodeScheduleable([]string{nodeName}, true)
+	pods, err := GetQuotaPathUsePods(allPods, pvs, nodeName, fromDir)
+	if err != nil {
+		return fmt.Errorf("getQuotaPathUsePods err:%v", err)
+	}
+	plan.DeletePods(pods)
+	tmpPod := newTmpPod(nodeName, fmt.Sprintf("move-%s-tmp-pod", nodeName), fromDir, toDir, moveImage, movetimeout)
+	plan.CreatePod(tmpPod)
+	if err := addChangeMountPathPlan(plan, pvs, nodeName, nodeName, []string{fromDir}, []string{toPath}); err != nil {
+		return err
+	}
+	plan.SetNodeScheduleable([]string{nodeName}, false)
+	plan.DeletePods([]*v1.Pod{tmpPod})
+	plan.DeletePV(tmpPV.Name)
+	plan.Print()
+	return nil
+}
+
 func deletePV(clientset *kubernetes.Clientset, pv *v1.PersistentVolume) error {
 	if pv != nil {
 		err := clientset.Core().PersistentVolumes().Delete(pv.Name, &metav1.DeleteOptions{})
@@ -807,10 +1604,15 @@ func deletePV(clientset *kubernetes.Clientset, pv *v1.PersistentVolume) error {
 	return nil
 }
 func changePVMountPath(clientset *kubernetes.Clientset, pv *v1.PersistentVolume, nodeNameFrom, nodeNameTo, fromDir, toDir string) error {
-	curPv, err := clientset.Core().PersistentVolumes().Get(pv.Name, metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
+	_, err := mutatePV(clientset, pv.Name, func(curPv *v1.PersistentVolume) (bool, error) {
+		return true, changeMountPath(curPv, nodeNameFrom, nodeNameTo, fromDir, toDir)
+	})
+	return err
+}
+
+// changeMountPath moves the fromDir record of pv from nodeNameFrom to nodeNameTo:toDir,
+// only the pv annotation is changed.
+func changeMountPath(curPv *v1.PersistentVolume, nodeNameFrom, nodeNameTo, fromDir, toDir string) error {
 	if algorithm.IsCommonHostPathPV(curPv) == false {
 		return fmt.Errorf("pv:%s is not hostpath pv", curPv.Name)
 	}
@@ -862,7 +1664,7 @@ func changePVMountPath(clientset *kubernetes.Clientset, pv *v1.PersistentVolume,
 		return err
 	}
 	curPv.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
-	return updatePV(clientset, curPv)
+	return nil
 }
 func getPVByNodeMountPath(clientset *kubernetes.Clientset, pvs *v1.PersistentVolumeList, nodeName, qutapath string) *v1.PersistentVolume {
 	for _, pv := range pvs.Items {
@@ -1043,26 +1845,18 @@ func GetQuotaPathUsePods(pods *v1.PodList, pvs *v1.PersistentVolumeList, nodeNam
 }
 func SetNodeScheduleable(clientset *kubernetes.Clientset, nodeNames []string, unschedulable bool) ([]string, error) {
 	changed := make([]string, 0, len(nodeNames))
-	tryCount := 3
 	for _, nodeName := range nodeNames {
-		for i := 1; i <= tryCount; i++ {
-			node, errGetNode := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
-			if errGetNode != nil {
-				return changed, errGetNode
-			}
-			if node.Spec.Unschedulable != unschedulable {
-				node.Spec.Unschedulable = unschedulable
-				_, errUpdate := clientset.Core().Nodes().Update(node)
-				if errUpdate != nil {
-					if i == tryCount {
-						return changed, errUpdate
-					}
-					time.Sleep(100 * time.Microsecond)
-					continue
-				}
-				changed = append(changed, nodeName)
-				break
-			}
+		isChanged := false
+		_, err := mutateNode(clientset, nodeName, func(node *v1.Node) (bool, error) {
+			isChanged = node.Spec.Unschedulable != unschedulable
+			node.Spec.Unschedulable = unschedulable
+			return isChanged, nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		if isChanged {
+			changed = append(changed, nodeName)
 		}
 	}
 	return changed, nil
@@ -1094,15 +1888,6 @@ func WaitPodQuit(clientset *kubernetes.Clientset, pods []*v1.Pod, timeOut int) e
 	return fmt.Errorf("wait pod quit timeout")
 }
 
-func calcSizeShouldMoveTime(size int64, movetimeout int) int {
-	/*size = size / (1024 * 1024) // MB
-	ret := size / 40            // 40MB/s
-	if ret < 10 {
-		ret = 10
-	}
-	return int(ret)*/
-	return movetimeout
-}
 func GetQuotaPathsUsedSize(pvs *v1.PersistentVolumeList, nodeName string, quotapaths []string) int64 {
 	var ret int64
 	for _, path := range quotapaths {
@@ -1112,6 +1897,13 @@ func GetQuotaPathsUsedSize(pvs *v1.PersistentVolumeList, nodeName string, quotap
 }
 
 func GetQuotaPathUsedSize(pvs *v1.PersistentVolumeList, nodeName, qutapath string) int64 {
+	if info := getQuotaPathMountInfo(pvs, nodeName, qutapath); info != nil {
+		return info.VolumeCurrentSize
+	}
+	return 0
+}
+
+func getQuotaPathMountInfo(pvs *v1.PersistentVolumeList, nodeName, qutapath string) *xfshostpath.MountInfo {
 	for _, pv := range pvs.Items {
 		if algorithm.IsCommonHostPathPV(&pv) == false {
 			continue
@@ -1129,17 +1921,24 @@ func GetQuotaPathUsedSize(pvs *v1.PersistentVolumeList, nodeName, qutapath strin
 
 		for _, item := range mountList {
 			if item.NodeName == nodeName {
-				for _, mountInfo := range item.MountInfos {
-					if path.Clean(mountInfo.HostPath) == path.Clean(qutapath) {
-						return mountInfo.VolumeCurrentSize
+				for i := range item.MountInfos {
+					if path.Clean(item.MountInfos[i].HostPath) == path.Clean(qutapath) {
+						return &item.MountInfos[i]
 					}
 				}
 			}
 		}
 	}
-	return 0
+	return nil
 }
 func CreateTmpPodMove(clientset *kubernetes.Clientset, nodeName, podName, serverip string, fromDirs, toDirs []string, image string, memlimit int, alwayspullmoveimage bool) (error, *v1.Pod) {
+	pod := newTmpPodMove(nodeName, podName, serverip, fromDirs, toDirs, image, memlimit, alwayspullmoveimage)
+	WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
+	createPod, err := clientset.Core().Pods(pod.Namespace).Create(pod)
+	return err, createPod
+}
+
+func newTmpPodMove(nodeName, podName, serverip string, fromDirs, toDirs []string, image string, memlimit int, alwayspullmoveimage bool) *v1.Pod {
 	volumes := make([]v1.Volume, 0, len(toDirs))
 	volumeMounts := make([]v1.VolumeMount, 0, len(toDirs))
 	for i, toDir := range toDirs {
@@ -1179,7 +1978,7 @@ func CreateTmpPodMove(clientset *kubernetes.Clientset, nodeName, podName, server
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
-			Namespace: metav1.NamespaceSystem,
+			Namespace: helperPodNamespace(),
 		},
 		Spec: v1.PodSpec{
 			NodeName:      nodeName,
@@ -1201,12 +2000,17 @@ func CreateTmpPodMove(clientset *kubernetes.Clientset, nodeName, podName, server
 			},
 		},
 	}
+	return applyHelperPodTemplate(pod)
+}
+
+func CreateTmpPodFrom(clientset *kubernetes.Clientset, nodeName, podName, fromDir string, image string, memlimit int, alwayspullmoveimage bool) (error, *v1.Pod) {
+	pod := newTmpPodFrom(nodeName, podName, fromDir, image, memlimit, alwayspullmoveimage)
 	WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
-	createPod, err := clientset.Core().Pods(metav1.NamespaceSystem).Create(pod)
+	createPod, err := clientset.Core().Pods(pod.Namespace).Create(pod)
 	return err, createPod
 }
 
-func CreateTmpPodFrom(clientset *kubernetes.Clientset, nodeName, podName, fromDir string, image string, memlimit int, alwayspullmoveimage bool) (error, *v1.Pod) {
+func newTmpPodFrom(nodeName, podName, fromDir string, image string, memlimit int, alwayspullmoveimage bool) *v1.Pod {
 	fromDir = path.Clean(fromDir)
 	imagePolicy := v1.PullIfNotPresent
 	if alwayspullmoveimage {
@@ -1215,7 +2019,7 @@ func CreateTmpPodFrom(clientset *kubernetes.Clientset, nodeName, podName, fromDi
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
-			Namespace: metav1.NamespaceSystem,
+			Namespace: helperPodNamespace(),
 		},
 		Spec: v1.PodSpec{
 			NodeName:      nodeName,
@@ -1241,6 +2045,7 @@ func CreateTmpPodFrom(clientset *kubernetes.Clientset, nodeName, podName, fromDi
 						{
 							Name:      "fromdir",
 							MountPath: "/fromdir",
+							ReadOnly:  true,
 						},
 					},
 					Resources: v1.ResourceRequirements{
@@ -1251,21 +2056,28 @@ func CreateTmpPodFrom(clientset *kubernetes.Clientset, nodeName, podName, fromDi
 			},
 		},
 	}
+	return applyHelperPodTemplate(pod)
+}
+
+func CreateTmpPod(clientset *kubernetes.Clientset, nodeName, podName, fromDir, toDir string, image string, timeout int) (error, *v1.Pod) {
+	pod := newTmpPod(nodeName, podName, fromDir, toDir, image, timeout)
 	WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
-	createPod, err := clientset.Core().Pods(metav1.NamespaceSystem).Create(pod)
+	createPod, err := clientset.Core().Pods(pod.Namespace).Create(pod)
 	return err, createPod
 }
 
-func CreateTmpPod(clientset *kubernetes.Clientset, nodeName, podName, fromDir, toDir string, image string) (error, *v1.Pod) {
-	timeout := int64(100)
+// newTmpPod returns the pod which moves fromDir to toDir of the same node and
+// prints the moved size every second like the move pods of a node to node move.
+func newTmpPod(nodeName, podName, fromDir, toDir string, image string, timeout int) *v1.Pod {
+	deadline := int64(timeout)
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
-			Namespace: metav1.NamespaceSystem,
+			Namespace: helperPodNamespace(),
 		},
 		Spec: v1.PodSpec{
 			NodeName:              nodeName,
-			ActiveDeadlineSeconds: &timeout,
+			ActiveDeadlineSeconds: &deadline,
 			RestartPolicy:         v1.RestartPolicyNever,
 			Volumes: []v1.Volume{
 				{
@@ -1291,8 +2103,9 @@ func CreateTmpPod(clientset *kubernetes.Clientset, nodeName, podName, fromDir, t
 					Image:           image,
 					ImagePullPolicy: v1.PullIfNotPresent,
 					Command:         []string{"/bin/sh"},
-					Args: []string{"-c", fmt.Sprintf("mv  /fromdir/%s /todir/",
-						path.Base(fromDir))},
+					Args: []string{"-c", fmt.Sprintf("mv /fromdir/%s /todir/ & pid=$!; while kill -0 $pid 2>/dev/null; do "+
+						"s=$(du -b --max-depth=0 /todir/%s 2>/dev/null | awk '{print $1}'); echo \"Has moved ${s:-0} B\"; sleep 1; done; wait $pid",
+						path.Base(fromDir), path.Base(fromDir))},
 					//Args: []string{"-c", "sleep 10000000"},
 					VolumeMounts: []v1.VolumeMount{
 						{
@@ -1308,12 +2121,18 @@ func CreateTmpPod(clientset *kubernetes.Clientset, nodeName, podName, fromDir, t
 			},
 		},
 	}
-	WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
-	createPod, err := clientset.Core().Pods(metav1.NamespaceSystem).Create(pod)
-	return err, createPod
+	return applyHelperPodTemplate(pod)
 }
 
 func CreateTmpPV(clientset *kubernetes.Clientset, pvName, nodeName string, toDirs []string, quotaSize int64) (error, *v1.PersistentVolume) {
+	pv := newTmpPV(pvName, nodeName, toDirs, quotaSize)
+	clientset.Core().PersistentVolumes().Delete(pv.Name, nil)
+	createPv, err := clientset.Core().PersistentVolumes().Create(pv)
+
+	return err, createPv
+}
+
+func newTmpPV(pvName, nodeName string, toDirs []string, quotaSize int64) *v1.PersistentVolume {
 	pv := NewTmpHostPathPV(pvName)
 	var ml xfshostpath.MountInfoList
 	for _, toDir := range toDirs {
@@ -1337,11 +2156,7 @@ func CreateTmpPV(clientset *kubernetes.Clientset, pvName, nodeName string, toDir
 		xfs.PVHostPathMountPolicyAnn:  xfs.PVHostPathKeep,
 		xfs.PVHostPathQuotaForOnePod:  "true",
 	}
-
-	clientset.Core().PersistentVolumes().Delete(pv.Name, nil)
-	createPv, err := clientset.Core().PersistentVolumes().Create(pv)
-
-	return err, createPv
+	return pv
 }
 
 func CheckCanMove(clientset *kubernetes.Clientset, nodeFrom, nodeTo *v1.Node, pvs *v1.PersistentVolumeList, fromDirs, toDirs []string) error {
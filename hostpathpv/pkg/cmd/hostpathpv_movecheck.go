@@ -0,0 +1,173 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The last step of a node to node move waits until the application is back:
+// the pods recreated by their controllers are scheduled to the to node and
+// ready, and the csi sync worker has recorded them in the mount info of the
+// moved quota paths. Pods without a controller are not recreated, a move of
+// only them is not checked.
+
+// podsComeBack returns whether the deleted pods of op are recreated by a
+// controller.
+func (op *MoveOperation) podsComeBack() bool {
+	if len(op.ScaledWorkloads) > 0 {
+		return true
+	}
+	for _, ref := range op.DeletedPods {
+		if ref.Owner != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// waitMovedPodsBack waits up to timeout seconds until every moved quota path
+// of op is used by a ready pod on the to node. It fails at once if a pod of a
+// pv only for one pod is scheduled to a node without its mount info, or if a
+// pod is crash-looping.
+func waitMovedPodsBack(clientset *kubernetes.Clientset, op *MoveOperation, timeout int) error {
+	deleted := make(map[string]bool)
+	for _, ref := range op.DeletedPods {
+		deleted[ref.UID] = true
+	}
+	for i := 0; ; i++ {
+		waiting, err := checkMovedPodsBack(clientset, op, deleted)
+		if err != nil || waiting == "" {
+			return err
+		}
+		if i >= timeout {
+			return fmt.Errorf("timeout, %s", waiting)
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// checkMovedPodsBack returns what is waited for, or an empty string if every
+// moved quota path is used by a ready pod on the to node.
+func checkMovedPodsBack(clientset *kubernetes.Clientset, op *MoveOperation, deleted map[string]bool) (string, error) {
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("list pvs err:%v", err)
+	}
+	waiting := ""
+	for i, fromDir := range op.FromDirs {
+		toPath := path.Join(op.ToDirs[i], path.Base(fromDir))
+		pv := getPVByNodeMountPath(clientset, pvs, op.ToNode, toPath)
+		if pv == nil {
+			return "", fmt.Errorf("%s:%s is not a mount path of any pv", op.ToNode, toPath)
+		}
+		if pv.Spec.ClaimRef == nil {
+			return "", fmt.Errorf("pv %s is not bound", pv.Name)
+		}
+		mountList, err := algorithm.GetHostPathPVMountInfoList(pv)
+		if err != nil {
+			return "", fmt.Errorf("pv %s mount info err:%v", pv.Name, err)
+		}
+		// the pods of a pv which is not only for one pod can run on any node,
+		// a new quota path is made for them there.
+		pvType := getPVType(pv)
+		onePod := pvType == KeepTrue || pvType == CSIKeepTrue
+		mountNodes := make([]string, 0, len(mountList))
+		var podInfo string
+		for _, item := range mountList {
+			mountNodes = append(mountNodes, item.NodeName)
+			for _, info := range item.MountInfos {
+				if item.NodeName == op.ToNode && path.Clean(info.HostPath) == toPath && info.PodInfo != nil {
+					podInfo = info.PodInfo.Info
+				}
+			}
+		}
+		pods, err := clientset.Core().Pods(pv.Spec.ClaimRef.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return "", fmt.Errorf("list pods of %s err:%v", pv.Spec.ClaimRef.Namespace, err)
+		}
+		var ready *v1.Pod
+		pathWaiting := fmt.Sprintf("%s:%s is not used by a pod yet", op.ToNode, toPath)
+		for j := range pods.Items {
+			pod := &pods.Items[j]
+			if deleted[string(pod.UID)] || pod.DeletionTimestamp != nil || isPodTerminated(pod) || podUsesClaim(pod, pv.Spec.ClaimRef.Name) == false {
+				continue
+			}
+			name := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+			if pod.Spec.NodeName == "" {
+				pathWaiting = fmt.Sprintf("pod %s is not scheduled%s", name, getPodUnschedulableMessage(pod))
+				continue
+			}
+			if onePod && stringsContain(mountNodes, pod.Spec.NodeName) == false {
+				return "", fmt.Errorf("pod %s of pv %s is on node %s which has no mount path of the pv", name, pv.Name, pod.Spec.NodeName)
+			}
+			if reason := getPodCrashReason(pod); reason != "" {
+				return "", fmt.Errorf("pod %s on node %s is %s", name, pod.Spec.NodeName, reason)
+			}
+			if pod.Spec.NodeName == op.ToNode && podInfo == fmt.Sprintf("%s:%s:%s", pod.Namespace, pod.Name, pod.UID) {
+				if isPodReady(pod) {
+					ready = pod
+				} else {
+					pathWaiting = fmt.Sprintf("pod %s on node %s is not ready", name, op.ToNode)
+				}
+			}
+		}
+		if ready == nil && waiting == "" {
+			waiting = pathWaiting
+		}
+	}
+	return waiting, nil
+}
+
+func podUsesClaim(pod *v1.Pod, claimName string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claimName {
+			return true
+		}
+	}
+	return false
+}
+
+func getPodUnschedulableMessage(pod *v1.Pod) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodScheduled && c.Status == v1.ConditionFalse && c.Message != "" {
+			return ": " + c.Message
+		}
+	}
+	return ""
+}
+
+// getPodCrashReason returns why a container of pod keeps failing, or an empty
+// string.
+func getPodCrashReason(pod *v1.Pod) string {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting == nil {
+			continue
+		}
+		if status.State.Waiting.Reason == "CrashLoopBackOff" {
+			return fmt.Sprintf("crash-looping in container %s, %d restarts", status.Name, status.RestartCount)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// evacuateDisk disables the quota disk of nodeDisk (NODE:DISKPATH) and moves
+// every keep quota path on it to the other enabled disks of the node by
+// moveNode, one by one.
+func evacuateDisk(clientset *kubernetes.Clientset, nodeDisk string, moveForce bool, moveImage string, movetimeout, stallTimeout int, dryRun bool, out io.Writer) error {
+	nodeName, disks, err := checkMoveNodeToNodePath(nodeDisk)
+	if err != nil {
+		return err
+	}
+	if len(disks) != 1 {
+		return fmt.Errorf("%s should be one NODE:DISKPATH", nodeDisk)
+	}
+	diskPath := path.Clean(disks[0])
+
+	node, err := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get node %s err:%v", nodeName, err)
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	allPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+
+	moves, err := planEvacuateDisk(node, pvs, allPods, diskPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Move disk %s:%s:\n", nodeName, diskPath)
+	if len(moves) == 0 {
+		fmt.Fprintf(out, "Disk has no keep quota path\n")
+	} else {
+		printMovePlan(moves, out)
+	}
+
+	if dryRun {
+		if err := disableNode(clientset, nodeName, diskPath, true, true); err != nil {
+			return err
+		}
+		for _, move := range moves {
+			if err := printMoveNodePlan(pvs, allPods, nodeName, move.fromDirs[0], move.toDirs[0], moveImage, movetimeout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if moveForce == false {
+		fmt.Printf("Are you sure to disable %s:%s and move its quota paths (y/n):", nodeName, diskPath)
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
+		}
+	}
+	if err := disableNode(clientset, nodeName, diskPath, true, false); err != nil {
+		return fmt.Errorf("disable %s:%s err:%v", nodeName, diskPath, err)
+	}
+	fmt.Fprintf(out, "Disk %s:%s is disabled\n", nodeName, diskPath)
+	if len(moves) == 0 {
+		return nil
+	}
+
+	for i, move := range moves {
+		fmt.Fprintf(out, "\nMove %d/%d %s:%s to %s:\n", i+1, len(moves), nodeName, move.fromDirs[0], move.toDirs[0])
+		start := time.Now()
+		move.err = moveNode(clientset, nodeName, move.fromDirs[0], move.toDirs[0], true, moveImage, movetimeout, stallTimeout, false)
+		move.duration = time.Since(start)
+		if move.err != nil {
+			fmt.Fprintf(out, "move %s err:%v\n", move.fromDirs[0], move.err)
+		}
+	}
+	fmt.Fprintln(out)
+	printMoveReport(moves, out)
+	fmt.Fprintf(out, "Disk %s:%s is kept disabled\n", nodeName, diskPath)
+	for _, move := range moves {
+		if move.err != nil {
+			return fmt.Errorf("not all quota paths of %s:%s are moved", nodeName, diskPath)
+		}
+	}
+	return nil
+}
+
+// planEvacuateDisk plans a move for every keep quota path of diskPath. The
+// biggest quota path is placed first, every quota path goes to the enabled
+// disk of the node with the least free quota where it fits.
+func planEvacuateDisk(node *v1.Node, pvs *v1.PersistentVolumeList, allPods *v1.PodList, diskPath string) ([]*plannedMove, error) {
+	disableList := getNodeQuotadiskDisableList(node)
+	isQuotaDisk := false
+	targets := make([]*moveDisk, 0)
+	for _, disk := range getNodeQuotaInfos(node, pvs).diskInfos {
+		if path.Clean(disk.path) == diskPath {
+			isQuotaDisk = true
+			continue
+		}
+		if disk.disabled || stringsContain(disableList, path.Clean(disk.path)) || stringsContain(disableList, disk.path) {
+			continue
+		}
+		targets = append(targets, &moveDisk{
+			path: path.Clean(disk.path),
+			free: disk.capacity - disk.keep - disk.none - disk.share,
+		})
+	}
+	if isQuotaDisk == false {
+		return nil, fmt.Errorf("%s is not a quota disk of %s", diskPath, node.Name)
+	}
+
+	moves := make([]*plannedMove, 0)
+	for _, p := range getNodeKeepQuotaPaths(pvs, node.Name, diskPath) {
+		quota, _, _ := GetNodeQuotaPathQuotaSize(pvs, node.Name, p)
+		move := &plannedMove{fromNode: node.Name, fromDirs: []string{p}, quotas: []int64{quota}, toNode: node.Name}
+		pods, err := GetQuotaPathUsePods(allPods, pvs, node.Name, p)
+		if err != nil {
+			return nil, fmt.Errorf("get pods of %s err:%v", p, err)
+		}
+		for _, pod := range pods {
+			move.pods = append(move.pods, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+		}
+		moves = append(moves, move)
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].quotas[0] > moves[j].quotas[0] })
+
+	for _, move := range moves {
+		var best *moveDisk
+		for _, disk := range targets {
+			if disk.free >= move.quotas[0] && (best == nil || disk.free < best.free) {
+				best = disk
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("no other enabled disk of %s has %s free quota for %s", node.Name,
+				strings.Trim(convertIntToString(move.quotas[0]), " "), move.fromDirs[0])
+		}
+		best.free -= move.quotas[0]
+		move.toDirs = []string{best.path}
+	}
+	return moves, nil
+}
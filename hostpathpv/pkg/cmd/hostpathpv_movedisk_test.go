@@ -0,0 +1,154 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	"github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestQuotaNode(t *testing.T, name string, disks xfsquotamanager.NodeDiskQuotaInfoList, disableList string) *v1.Node {
+	buf, err := json.Marshal(disks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{xfs.NodeDiskQuotaInfoAnn: string(buf)},
+		},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}
+	if disableList != "" {
+		node.Annotations[xfs.NodeDiskQuotaDisableListAnn] = disableList
+	}
+	return node
+}
+
+// newTestKeepPV returns a keep quota pv with a quota path of every quota on nodeName.
+func newTestKeepPV(t *testing.T, name, nodeName string, hostPaths []string, quotas []int64) v1.PersistentVolume {
+	item := xfshostpath.HostPathPVMountInfo{NodeName: nodeName}
+	for i, hostPath := range hostPaths {
+		item.MountInfos = append(item.MountInfos, xfshostpath.MountInfo{HostPath: hostPath, VolumeQuotaSize: quotas[i]})
+	}
+	buf, err := json.Marshal(xfshostpath.HostPathPVMountInfoList{item})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pv := NewTmpHostPathPV(name)
+	pv.Annotations = map[string]string{
+		xfs.PVHostPathMountPolicyAnn:  xfs.PVHostPathKeep,
+		xfs.PVHostPathQuotaForOnePod:  "true",
+		xfs.PVVolumeHostPathMountNode: string(buf),
+	}
+	return *pv
+}
+
+func TestPlanEvacuateDisk(t *testing.T) {
+	disks := xfsquotamanager.NodeDiskQuotaInfoList{
+		{MountPath: testDiskPath(1), Allocable: 1000},
+		{MountPath: testDiskPath(2), Allocable: 1000},
+		{MountPath: testDiskPath(3), Allocable: 500},
+		{MountPath: testDiskPath(4), Allocable: 1000, Disabled: true},
+	}
+	// disk2 has 400 free quota, disk3 500
+	pvs := &v1.PersistentVolumeList{Items: []v1.PersistentVolume{
+		newTestKeepPV(t, "pv1", "node1", []string{testDiskPath(1) + "/p1", testDiskPath(1) + "/p3"}, []int64{400, 100}),
+		newTestKeepPV(t, "pv2", "node1", []string{testDiskPath(1) + "/p2", testDiskPath(2) + "/q1"}, []int64{300, 600}),
+		newTestKeepPV(t, "pv3", "node2", []string{testDiskPath(1) + "/r1"}, []int64{900}),
+	}}
+	bigPVs := &v1.PersistentVolumeList{Items: []v1.PersistentVolume{
+		newTestKeepPV(t, "pv1", "node1", []string{testDiskPath(1) + "/p1"}, []int64{1100}),
+	}}
+
+	tests := []struct {
+		name        string
+		pvs         *v1.PersistentVolumeList
+		diskPath    string
+		disableList string
+		// moves are the from and to dirs of the planned moves
+		moves []string
+		err   string
+	}{
+		{
+			name:     "biggest first to the least free disk where it fits",
+			pvs:      pvs,
+			diskPath: testDiskPath(1),
+			moves: []string{
+				testDiskPath(1) + "/p1>" + testDiskPath(2),
+				testDiskPath(1) + "/p2>" + testDiskPath(3),
+				testDiskPath(1) + "/p3>" + testDiskPath(3),
+			},
+		},
+		{
+			name:        "disks of the disable list are no targets",
+			pvs:         pvs,
+			diskPath:    testDiskPath(1),
+			disableList: testDiskPath(3),
+			err:         "no other enabled disk",
+		},
+		{
+			name:     "a path which fits no disk",
+			pvs:      bigPVs,
+			diskPath: testDiskPath(1),
+			err:      "no other enabled disk",
+		},
+		{
+			name:     "an empty disk",
+			pvs:      pvs,
+			diskPath: testDiskPath(3),
+			moves:    []string{},
+		},
+		{
+			name:     "not a quota disk",
+			pvs:      pvs,
+			diskPath: "/xfs/disk9",
+			err:      "is not a quota disk",
+		},
+	}
+	for _, test := range tests {
+		node := newTestQuotaNode(t, "node1", disks, test.disableList)
+		moves, err := planEvacuateDisk(node, test.pvs, &v1.PodList{}, test.diskPath)
+		if test.err != "" {
+			if err == nil || strings.Contains(err.Error(), test.err) == false {
+				t.Errorf("%s: err %v, want %q", test.name, err, test.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: err %v", test.name, err)
+			continue
+		}
+		got := make([]string, 0, len(moves))
+		for _, move := range moves {
+			if move.fromNode != "node1" || move.toNode != "node1" {
+				t.Errorf("%s: move from %s to %s, want node1", test.name, move.fromNode, move.toNode)
+			}
+			got = append(got, fmt.Sprintf("%s>%s", move.fromDirs[0], move.toDirs[0]))
+		}
+		if reflect.DeepEqual(got, test.moves) == false {
+			t.Errorf("%s: moves %v, want %v", test.name, got, test.moves)
+		}
+	}
+}
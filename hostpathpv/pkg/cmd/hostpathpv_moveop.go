@@ -0,0 +1,358 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// A node to node move records its plan and completed steps in a configmap so
+// that it can be resumed or rolled back after the command is interrupted.
+
+const (
+	moveOperationNamespace  = metav1.NamespaceSystem
+	moveOperationLabel      = "hostpathpv-operation"
+	moveOperationDataKey    = "operation"
+	moveOperationNamePrefix = "hostpathpv-move-"
+)
+
+// MoveOperation is the persisted state of a node to node move.
+type MoveOperation struct {
+	ID                  string              `json:"id"`
+	StartTime           string              `json:"startTime"`
+	FromNode            string              `json:"fromNode"`
+	ToNode              string              `json:"toNode"`
+	FromDirs            []string            `json:"fromDirs"`
+	ToDirs              []string            `json:"toDirs"`
+	MoveImage           string              `json:"moveImage"`
+	MoveTimeout         int                 `json:"moveTimeout"`
+	StallTimeout        int                 `json:"stallTimeout,omitempty"`
+	TmpPVKeepWait       int                 `json:"tmpPVKeepWait"`
+	MovePodMemLimit     int                 `json:"movePodMemLimit"`
+	AlwaysPullMoveImage bool                `json:"alwaysPullMoveImage"`
+	Verify              bool                `json:"verify,omitempty"`
+	PreSync             bool                `json:"preSync,omitempty"`
+	PreSyncMaxDelta     int                 `json:"preSyncMaxDelta,omitempty"`
+	PreSyncMaxPasses    int                 `json:"preSyncMaxPasses,omitempty"`
+	Tuning              MoveTuning          `json:"tuning"`
+	Mover               string              `json:"mover,omitempty"`
+	Transport           string              `json:"transport,omitempty"`
+	TmpPVName           string              `json:"tmpPVName"`
+	FromPodName         string              `json:"fromPodName"`
+	ToPodName           string              `json:"toPodName"`
+	Fence               string              `json:"fence,omitempty"`
+	HelperPod           *v1.PodTemplateSpec `json:"helperPod,omitempty"`
+	Placement           string              `json:"placement,omitempty"`
+	WaitPods            bool                `json:"waitPods,omitempty"`
+	KeepSource          bool                `json:"keepSource,omitempty"`
+	UnscheduledNodes    []string            `json:"unscheduledNodes,omitempty"`
+	DeletedPods         []MovePodRef        `json:"deletedPods,omitempty"`
+	ScaleDown           bool                `json:"scaleDown,omitempty"`
+	ReadyTimeout        int                 `json:"readyTimeout,omitempty"`
+	ScaledWorkloads     []WorkloadRef       `json:"scaledWorkloads,omitempty"`
+	CompletedStep       int                 `json:"completedStep"`
+
+	// quiet is set when several moves run at the same time, see stepPrintf.
+	quiet bool
+}
+
+// moveOptions are the flags of how node to node moves copy, they are shared by
+// the commands which move quota paths.
+type moveOptions struct {
+	moveImage           string
+	moveTimeout         int
+	stallTimeout        int
+	tmpPVKeepWait       int
+	movePodMemLimit     int
+	alwaysPullMoveImage bool
+	verify              bool
+	// preSyncMaxPasses is 0 if there is no pre-sync.
+	preSyncMaxPasses int
+	preSyncMaxDelta  int
+	tuning           MoveTuning
+	mover            string
+	transport        string
+	scaleDown        bool
+	readyTimeout     int
+	fence            string
+	placement        string
+	waitPods         bool
+	keepSource       bool
+}
+
+func addMoveOptionsFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("alwayspullmoveimage", false, "Move pod pull images alwasy")
+	cmd.Flags().Int("movetimeout", 100000, "Timeout of the move pods of a move on one node and of the verify")
+	cmd.Flags().Int("movestalltimeout", defaultMoveStallTimeout, "Seconds a copy, a same node move or a pre-sync pass is waited for without any data moved before it is stopped")
+	cmd.Flags().Int("movepodmemlimit", 1024, "Move pod memory MB")
+	cmd.Flags().Int("tmppvkeepwait", 60, "Wait time at create tmp pv")
+	cmd.Flags().String("moveimage", default_move_busyboximage, "Image create to move dir")
+	cmd.Flags().Bool("verify", false, "Compare the md5 sum and size of every moved file and the copied usage with the pv before changing the pv mount path, only for node to node move")
+	cmd.Flags().Bool("presync", false, "Copy from a read only mount while the pods are running and delete the pods only for the final sync, only for node to node move, --mover=ssh needs rsync in the move image")
+	cmd.Flags().Int("presyncmaxdelta", 1024, "Pre-sync passes are repeated until one transfers less than this MB")
+	cmd.Flags().Int("presyncmaxpasses", 5, "Max pre-sync passes")
+	addMoveTuningFlags(cmd)
+	cmd.Flags().String("transport", moveTransportImage, "How node to node moves transfer, image copies between the pods of the move image by --mover, exec streams tar from the from pod to the move pod through this command and needs only sh and tar in the move image, busybox if --moveimage is not given, and no --presync")
+	cmd.Flags().String("mover", moverNative, "How node to node moves copy, native is the hostpathpv-mover of the move image with a per move credential, ssh is scp or rsync over ssh with per move keys")
+	addScaleDownFlags(cmd)
+	addHelperPodFlags(cmd)
+	cmd.Flags().Bool("waitpods", true, "Wait --readytimeout seconds at the end of a node to node move until the pods recreated by their controllers are ready on the to node and use the moved quota paths, a crash-looping pod fails at once")
+	cmd.Flags().Bool("keep-source", false, "Record the from dirs left on the from node by a node to node move, list them by move sources and delete them by move cleanup-source ID")
+	cmd.Flags().String("placement", movePlacementBlock, "Whether a node to node move is stopped (block), only warned about (warn) or not checked (ignore) if the node selector, affinity, tolerations or resource requests of its pods do not allow the to node")
+	cmd.Flags().String("fence", moveFenceNode, "How node to node moves keep the deleted pods from the nodes while the data is copied, node cordons both nodes so that no other pod is scheduled to them either, none needs --scaledown and leaves the nodes as they are")
+}
+
+func addScaleDownFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("scaledown", false, "Scale the Deployment or ReplicaSet of the pods to 0, and their StatefulSet down to the lowest ordinal of the pods, instead of deleting the pods, and back when the pv is changed")
+	cmd.Flags().Int("readytimeout", 600, "Seconds to wait for the stopped pods to be ready again")
+}
+
+func getMoveOptions(cmd *cobra.Command) (moveOptions, error) {
+	opts := moveOptions{
+		moveImage:           GetFlagString(cmd, "moveimage"),
+		moveTimeout:         GetFlagInt(cmd, "movetimeout"),
+		stallTimeout:        GetFlagInt(cmd, "movestalltimeout"),
+		tmpPVKeepWait:       GetFlagInt(cmd, "tmppvkeepwait"),
+		movePodMemLimit:     GetFlagInt(cmd, "movepodmemlimit"),
+		alwaysPullMoveImage: GetFlagBool(cmd, "alwayspullmoveimage"),
+		verify:              GetFlagBool(cmd, "verify"),
+		preSyncMaxDelta:     GetFlagInt(cmd, "presyncmaxdelta"),
+		mover:               GetFlagString(cmd, "mover"),
+		transport:           GetFlagString(cmd, "transport"),
+		scaleDown:           GetFlagBool(cmd, "scaledown"),
+		readyTimeout:        GetFlagInt(cmd, "readytimeout"),
+		fence:               GetFlagString(cmd, "fence"),
+		placement:           GetFlagString(cmd, "placement"),
+		waitPods:            GetFlagBool(cmd, "waitpods"),
+		keepSource:          GetFlagBool(cmd, "keep-source"),
+	}
+	if err := setHelperPodTemplate(cmd); err != nil {
+		return opts, err
+	}
+	var err error
+	if opts.tuning, err = getMoveTuning(cmd); err != nil {
+		return opts, err
+	}
+	if opts.stallTimeout <= 0 {
+		return opts, fmt.Errorf("--movestalltimeout should be > 0")
+	}
+	if opts.mover != moverNative && opts.mover != moverSSH {
+		return opts, fmt.Errorf("--mover should be %s or %s", moverNative, moverSSH)
+	}
+	if opts.transport != moveTransportImage && opts.transport != moveTransportExec {
+		return opts, fmt.Errorf("--transport should be %s or %s", moveTransportImage, moveTransportExec)
+	}
+	if err := checkMoveFence(opts.fence, opts.scaleDown); err != nil {
+		return opts, err
+	}
+	if err := checkMovePlacementMode(opts.placement); err != nil {
+		return opts, err
+	}
+	if opts.transport == moveTransportExec && cmd.Flags().Changed("moveimage") == false {
+		opts.moveImage = default_move_execimage
+	}
+	if GetFlagBool(cmd, "presync") {
+		if opts.transport == moveTransportExec {
+			return opts, fmt.Errorf("--presync is not supported by --transport=%s", moveTransportExec)
+		}
+		if opts.preSyncMaxPasses = GetFlagInt(cmd, "presyncmaxpasses"); opts.preSyncMaxPasses <= 0 {
+			return opts, fmt.Errorf("--presyncmaxpasses should be > 0")
+		}
+	}
+	return opts, nil
+}
+
+func (opts moveOptions) newMoveOperation(fromNodeName, toNodeName string, fromDirs, toDirs []string) *MoveOperation {
+	op := newMoveOperation(fromNodeName, toNodeName, fromDirs, toDirs, opts.moveImage, opts.moveTimeout, opts.tmpPVKeepWait,
+		opts.movePodMemLimit, opts.alwaysPullMoveImage)
+	op.StallTimeout = opts.stallTimeout
+	op.Verify = opts.verify
+	op.PreSync = opts.preSyncMaxPasses > 0
+	op.PreSyncMaxDelta = opts.preSyncMaxDelta
+	op.PreSyncMaxPasses = opts.preSyncMaxPasses
+	op.Tuning = opts.tuning
+	op.Mover = opts.mover
+	op.Transport = opts.transport
+	op.ScaleDown = opts.scaleDown
+	op.ReadyTimeout = opts.readyTimeout
+	op.Fence = opts.fence
+	op.HelperPod = helperPodTemplate
+	op.Placement = opts.placement
+	op.WaitPods = opts.waitPods
+	op.KeepSource = opts.keepSource
+	return op
+}
+
+// MovePodRef is a pod deleted by the move.
+type MovePodRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	// Owner is the controller of the pod which recreates it, KIND/NAME.
+	Owner string `json:"owner,omitempty"`
+}
+
+func newMoveOperation(fromNodeName, toNodeName string, fromDirs, toDirs []string, moveImage string,
+	movetimeout, tmppvkeepwait, movepodmemlimit int, alwayspullmoveimage bool) *MoveOperation {
+	ids := append([]string{fromNodeName, toNodeName}, fromDirs...)
+	ids = append(ids, toDirs...)
+	return &MoveOperation{
+		ID:                  getHashStr(ids, 10),
+		StartTime:           time.Now().Format(time.RFC3339),
+		FromNode:            fromNodeName,
+		ToNode:              toNodeName,
+		FromDirs:            fromDirs,
+		ToDirs:              toDirs,
+		MoveImage:           moveImage,
+		MoveTimeout:         movetimeout,
+		TmpPVKeepWait:       tmppvkeepwait,
+		MovePodMemLimit:     movepodmemlimit,
+		AlwaysPullMoveImage: alwayspullmoveimage,
+		TmpPVName:           getMoveTmpPVName(toNodeName, fromDirs, toDirs),
+		FromPodName:         getMoveFromPodName(fromNodeName, fromDirs),
+		ToPodName:           getMoveToPodName(toNodeName, fromDirs, toDirs),
+	}
+}
+
+func (op *MoveOperation) deletedPods() []*v1.Pod {
+	ret := make([]*v1.Pod, 0, len(op.DeletedPods))
+	for _, ref := range op.DeletedPods {
+		ret = append(ret, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}})
+	}
+	return ret
+}
+
+func (op *MoveOperation) tmpPods() []*v1.Pod {
+	verifyToPodName := getMoveVerifyPodName(op.ToNode, getMoveVerifyToDirs(op.FromDirs, op.ToDirs))
+	return []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: helperPodNamespace(), Name: op.ToPodName}, Spec: v1.PodSpec{NodeName: op.ToNode}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: helperPodNamespace(), Name: op.FromPodName}, Spec: v1.PodSpec{NodeName: op.FromNode}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: helperPodNamespace(), Name: getMoveVerifyPodName(op.FromNode, op.FromDirs)}, Spec: v1.PodSpec{NodeName: op.FromNode}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: helperPodNamespace(), Name: verifyToPodName}, Spec: v1.PodSpec{NodeName: op.ToNode}},
+	}
+}
+
+func getMoveOperationConfigMapName(id string) string {
+	return moveOperationNamePrefix + id
+}
+
+// getMoveOperation returns nil and no error if the move does not exist.
+func getMoveOperation(clientset *kubernetes.Clientset, id string) (*MoveOperation, error) {
+	cm, err := clientset.Core().ConfigMaps(moveOperationNamespace).Get(getMoveOperationConfigMapName(id), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get move %s err:%v", id, err)
+	}
+	op := &MoveOperation{}
+	if err := json.Unmarshal([]byte(cm.Data[moveOperationDataKey]), op); err != nil {
+		return nil, fmt.Errorf("move %s state is broken: %v", id, err)
+	}
+	return op, nil
+}
+
+func saveMoveOperation(clientset *kubernetes.Clientset, op *MoveOperation) error {
+	buf, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	name := getMoveOperationConfigMapName(op.ID)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		cm, err := clientset.Core().ConfigMaps(moveOperationNamespace).Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = clientset.Core().ConfigMaps(moveOperationNamespace).Create(&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: moveOperationNamespace,
+					Labels:    map[string]string{"app": "kubectlhostpathpv", moveOperationLabel: "move"},
+				},
+				Data: map[string]string{moveOperationDataKey: string(buf)},
+			})
+			return err
+		} else if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[moveOperationDataKey] = string(buf)
+		_, err = clientset.Core().ConfigMaps(moveOperationNamespace).Update(cm)
+		return err
+	})
+}
+
+func deleteMoveOperation(clientset *kubernetes.Clientset, id string) error {
+	err := clientset.Core().ConfigMaps(moveOperationNamespace).Delete(getMoveOperationConfigMapName(id), &metav1.DeleteOptions{})
+	if err != nil && errors.IsNotFound(err) == false {
+		return err
+	}
+	return nil
+}
+
+func (op *MoveOperation) logPrefix() string {
+	if op.quiet {
+		return fmt.Sprintf("[%s] ", op.ID)
+	}
+	return ""
+}
+
+// stepPrintf is stepPrintf of op. A quiet op prints every step as one line with
+// the move id when the step ends, so the lines of several moves do not mix.
+func (op *MoveOperation) stepPrintf(statueChan <-chan string, format string, a ...interface{}) {
+	if op.quiet == false {
+		stepPrintf(statueChan, format, a...)
+		return
+	}
+	buf := op.logPrefix() + fmt.Sprintf(format, a...)
+	go func() {
+		for statue := range statueChan {
+			if _, err := strconv.Atoi(statue); err != nil {
+				printFunChan <- func() {
+					fmt.Printf("%s %s\n", buf, statue)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// printProgress is printTimeDelay of op, a quiet op does not print its progress.
+func (op *MoveOperation) printProgress(strChan <-chan string, stop <-chan struct{}) {
+	if op.quiet == false {
+		printTimeDelay(strChan, stop)
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-strChan:
+			}
+		}
+	}()
+}
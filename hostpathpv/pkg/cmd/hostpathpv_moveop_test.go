@@ -0,0 +1,88 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestMoveOperationSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed int
+		// resume is the completed step the move is continued after
+		resume   int
+		canAbort bool
+	}{
+		{name: "checked", completed: moveStepCheck, resume: moveStepCheck, canAbort: true},
+		{name: "pods deleted", completed: moveStepWaitPodsDeleted, resume: moveStepWaitPodsDeleted, canAbort: true},
+		{name: "from pod running", completed: moveStepWaitFromPod, resume: moveStepWaitPodsDeleted, canAbort: true},
+		{name: "move pod running", completed: moveStepWaitMovePod, resume: moveStepWaitPodsDeleted, canAbort: true},
+		{name: "copied", completed: moveStepWaitMove, resume: moveStepWaitMove, canAbort: true},
+		{name: "verified", completed: moveStepVerify, resume: moveStepVerify, canAbort: true},
+		{name: "mount paths changed", completed: moveStepChangeMountPath, resume: moveStepChangeMountPath},
+		{name: "waiting the pods", completed: moveStepRestoreWorkloads, resume: moveStepRestoreWorkloads},
+	}
+	for _, test := range tests {
+		op := newMoveOperation("node1", "node2", []string{"/xfs/disk1/dir1"}, []string{"/xfs/disk2"}, "image", 100, 10, 1024, false)
+		op.CompletedStep = test.completed
+		if step := op.getResumeStep(); step != test.resume {
+			t.Errorf("%s: resumed after step %d, want %d", test.name, step, test.resume)
+		}
+		if op.canAbort() != test.canAbort {
+			t.Errorf("%s: can abort %t, want %t", test.name, op.canAbort(), test.canAbort)
+		}
+		hint := op.getContinueHint("move ")
+		if strings.Contains(hint, "move --resume="+op.ID) == false ||
+			strings.Contains(hint, "move --abort="+op.ID) != test.canAbort {
+			t.Errorf("%s: hint %q", test.name, hint)
+		}
+	}
+}
+
+func TestGetMoveRollback(t *testing.T) {
+	op := newMoveOperation("node1", "node2", []string{"/xfs/disk1/dir1", "/xfs/disk1/dir2", "/xfs/disk1/dir3"},
+		[]string{"/xfs/disk2", "/xfs/disk2", "/xfs/disk3"}, "image", 100, 10, 1024, false)
+	pvs := &v1.PersistentVolumeList{Items: []v1.PersistentVolume{
+		// dir1 is changed to the to node, dir2 is not
+		newTestKeepPV(t, "pv1", "node2", []string{"/xfs/disk2/dir1"}, []int64{100}),
+		newTestKeepPV(t, "pv2", "node1", []string{"/xfs/disk1/dir2"}, []int64{100}),
+		// the to path of dir3 is the quota path of another pv
+		newTestKeepPV(t, "pv3", "node2", []string{"/xfs/disk3/dir3"}, []int64{100}),
+		newTestKeepPV(t, "pv4", "node1", []string{"/xfs/disk1/dir3"}, []int64{100}),
+	}}
+
+	rb := getMoveRollback(nil, pvs, op)
+	if reflect.DeepEqual(rb.changedFrom, []string{"/xfs/disk1/dir1"}) == false ||
+		reflect.DeepEqual(rb.changedTo, []string{"/xfs/disk2/dir1"}) == false {
+		t.Errorf("changed %v to %v, want dir1 only", rb.changedFrom, rb.changedTo)
+	}
+	got := make([]string, 0, len(rb.copyPods))
+	for _, pod := range rb.copyPods {
+		if pod.Spec.NodeName != "node2" {
+			t.Errorf("copy pod %s is on %s, want node2", pod.Name, pod.Spec.NodeName)
+		}
+		got = append(got, pod.Name)
+	}
+	want := []string{getCleanupSourcePodName(op.ID, 0), getCleanupSourcePodName(op.ID, 1)}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("copy pods %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,409 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// The commands which move many quota paths at once plan one node to node move
+// for the keep quota paths of every pod, pick the to disks by the free quota of
+// getNodeQuotaInfos and run the moves one by one or several at the same time.
+
+// plannedMove is one node to node move of a plan.
+type plannedMove struct {
+	pods     []string
+	fromNode string
+	fromDirs []string
+	quotas   []int64
+	toNode   string
+	// toDirs are the to disks of fromDirs.
+	toDirs []string
+
+	op       *MoveOperation
+	err      error
+	duration time.Duration
+}
+
+func (move *plannedMove) quota() int64 {
+	var ret int64
+	for _, quota := range move.quotas {
+		ret += quota
+	}
+	return ret
+}
+
+func (move *plannedMove) podsStr() string {
+	if len(move.pods) == 0 {
+		return "<none>"
+	}
+	return strings.Join(move.pods, ",")
+}
+
+// moveDisk is a quota disk a planned move can go to.
+type moveDisk struct {
+	path string
+	free int64
+}
+
+// getNodeKeepQuotaPaths returns the keep quota paths of nodeName under the
+// disk diskPath, all disks if it is empty.
+func getNodeKeepQuotaPaths(pvs *v1.PersistentVolumeList, nodeName, diskPath string) []string {
+	ret := make([]string, 0)
+	for _, pv := range pvs.Items {
+		if algorithm.IsCommonHostPathPV(&pv) == false {
+			continue
+		}
+		if pv.Annotations == nil || pv.Annotations[xfs.PVVolumeHostPathMountNode] == "" {
+			continue
+		}
+		pvType := getPVType(&pv)
+		if pvType != KeepTrue && pvType != KeepFalse && pvType != CSIKeepTrue && pvType != CSIKeepFalse {
+			continue
+		}
+		mountList := xfshostpath.HostPathPVMountInfoList{}
+		if err := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+			continue
+		}
+		for _, item := range mountList {
+			if item.NodeName != nodeName {
+				continue
+			}
+			for _, mountInfo := range item.MountInfos {
+				if diskPath == "" || path.Dir(path.Clean(mountInfo.HostPath)) == path.Clean(diskPath) {
+					ret = append(ret, path.Clean(mountInfo.HostPath))
+				}
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// groupMovePaths splits the quota paths of nodeName into moves, the keep
+// quota paths of a pod are moved together as checkMovePathsIsBelongOnePod
+// requires.
+func groupMovePaths(paths []string, allPods *v1.PodList, pvs *v1.PersistentVolumeList, nodeName string) ([]*plannedMove, error) {
+	moves := make([]*plannedMove, 0)
+	grouped := make(map[string]bool)
+	for _, p := range paths {
+		if grouped[p] {
+			continue
+		}
+		move := &plannedMove{fromNode: nodeName, fromDirs: []string{p}}
+		pods, err := GetQuotaPathUsePods(allPods, pvs, nodeName, p)
+		if err != nil {
+			return nil, fmt.Errorf("get pods of %s err:%v", p, err)
+		}
+		if len(pods) > 0 {
+			keepPaths, _ := getPodHostPaths(pods[0].Namespace, pods[0].Name, nodeName, pvs)
+			move.fromDirs = move.fromDirs[:0]
+			for _, kp := range keepPaths {
+				move.fromDirs = append(move.fromDirs, path.Clean(kp))
+			}
+			sort.Strings(move.fromDirs)
+			for _, pod := range pods {
+				move.pods = append(move.pods, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+			}
+		}
+		if err := checkMovePathsIsBelongOnePod(move.fromDirs, allPods, pvs, nodeName); err != nil {
+			return nil, fmt.Errorf("can not move %v of %s: %v", move.fromDirs, move.podsStr(), err)
+		}
+		for _, dir := range move.fromDirs {
+			if grouped[dir] {
+				return nil, fmt.Errorf("%s of %s is moved by another pod too", dir, move.podsStr())
+			}
+			grouped[dir] = true
+			quota, _, _ := GetNodeQuotaPathQuotaSize(pvs, nodeName, dir)
+			move.quotas = append(move.quotas, quota)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// getMoveTargets returns the not disabled quota disks of every node which can
+// be moved to with their free quota. If toNodes is empty all the ready and
+// scheduleable nodes but the excluded ones are the targets.
+func getMoveTargets(nodes *v1.NodeList, pvs *v1.PersistentVolumeList, toNodes []string, exclude map[string]bool) (map[string][]*moveDisk, error) {
+	ret := make(map[string][]*moveDisk)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if len(toNodes) > 0 && stringsContain(toNodes, node.Name) == false {
+			continue
+		} else if len(toNodes) == 0 && (exclude[node.Name] || node.Spec.Unschedulable) {
+			continue
+		}
+		if getNodeReadyStatus(node) != "Ready" {
+			if len(toNodes) > 0 {
+				return nil, fmt.Errorf("to node %s is not ready", node.Name)
+			}
+			continue
+		}
+		info := getNodeQuotaInfos(node, pvs)
+		for _, disk := range info.diskInfos {
+			if disk.disabled {
+				continue
+			}
+			ret[node.Name] = append(ret[node.Name], &moveDisk{
+				path: path.Clean(disk.path),
+				free: disk.capacity - disk.keep - disk.none - disk.share,
+			})
+		}
+	}
+	for _, name := range toNodes {
+		if _, exist := ret[name]; exist == false {
+			return nil, fmt.Errorf("to node %s is not found or has no quota disk", name)
+		}
+	}
+	return ret, nil
+}
+
+func stringsContain(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// placeMove picks the to node and disks of move and takes their free quota.
+// Of the nodes where all the quota paths fit the one with the most free quota
+// is used, every quota path goes to the disk with the most free quota left.
+func placeMove(move *plannedMove, targets map[string][]*moveDisk) error {
+	order := make([]int, len(move.fromDirs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return move.quotas[order[i]] > move.quotas[order[j]] })
+
+	bestNode, bestFree := "", int64(-1)
+	var bestDirs []string
+	for nodeName, disks := range targets {
+		if nodeName == move.fromNode {
+			continue
+		}
+		free := make([]int64, len(disks))
+		var total int64
+		for i, disk := range disks {
+			free[i] = disk.free
+			total += disk.free
+		}
+		toDirs := make([]string, len(move.fromDirs))
+		fit := true
+		for _, i := range order {
+			best := -1
+			for j := range disks {
+				if free[j] >= move.quotas[i] && (best < 0 || free[j] > free[best]) {
+					best = j
+				}
+			}
+			if best < 0 {
+				fit = false
+				break
+			}
+			free[best] -= move.quotas[i]
+			toDirs[i] = disks[best].path
+		}
+		if fit && (total > bestFree || (total == bestFree && nodeName < bestNode)) {
+			bestNode, bestFree, bestDirs = nodeName, total, toDirs
+		}
+	}
+	if bestNode == "" {
+		return fmt.Errorf("no node has %s free quota for %v of %s", strings.Trim(convertIntToString(move.quota()), " "),
+			move.fromDirs, move.podsStr())
+	}
+	move.toNode, move.toDirs = bestNode, bestDirs
+	for i, toDir := range bestDirs {
+		for _, disk := range targets[bestNode] {
+			if disk.path == toDir {
+				disk.free -= move.quotas[i]
+			}
+		}
+	}
+	return nil
+}
+
+func printMovePlan(moves []*plannedMove, out io.Writer) {
+	displayer := NewDisplayer("  ", "", "Pods", "From", "Path", "Quota", "To", "Disk")
+	for _, move := range moves {
+		for i, dir := range move.fromDirs {
+			displayer.AddLine(move.podsStr(), move.fromNode, dir, strings.Trim(convertIntToString(move.quotas[i]), " "), move.toNode, move.toDirs[i])
+		}
+	}
+	displayer.Fprint(out, true)
+}
+
+func printMoveReport(moves []*plannedMove, out io.Writer) {
+	displayer := NewDisplayer("  ", "", "Move", "Pods", "From", "To", "Quota", "Time", "Result")
+	var failed int
+	for _, move := range moves {
+		id, result := "-", "Success"
+		if move.op != nil {
+			id = move.op.ID
+		}
+		if move.err != nil {
+			failed++
+			result = fmt.Sprintf("Fail: %v", move.err)
+		}
+		displayer.AddLine(id, move.podsStr(), fmt.Sprintf("%s:%s", move.fromNode, strings.Join(move.fromDirs, ",")),
+			fmt.Sprintf("%s:%s", move.toNode, strings.Join(move.toDirs, ",")), strings.Trim(convertIntToString(move.quota()), " "),
+			move.duration.Round(time.Second).String(), strings.TrimSpace(result))
+	}
+	fmt.Fprintf(out, "\n")
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "Moves: %d, Failed: %d\n", len(moves), failed)
+}
+
+// runPlannedMoves runs moves, at most parallel at the same time. Nodes which
+// are unscheduleable already can be in several running moves, any other node
+// only in one, because a move sets its nodes scheduleable again when it ends.
+// A failed move does not stop the others.
+func runPlannedMoves(clientset *kubernetes.Clientset, config *rest.Config, moves []*plannedMove, opts moveOptions, parallel int) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes err:%v", err)
+	}
+	shared := make(map[string]bool)
+	for _, node := range nodes.Items {
+		shared[node.Name] = node.Spec.Unschedulable
+	}
+	if parallel > 1 {
+		cleanDeferFunList = make([]cleanDeferFun, 0, 10)
+		defer runCleanDeferFun()
+		signalChan := make(chan os.Signal, 1)
+		go handleSignal(signalChan)
+		signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGINT)
+	}
+
+	var lock sync.Mutex
+	cond := sync.NewCond(&lock)
+	busy := make(map[string]bool)
+	started := make([]bool, len(moves))
+	nodesOf := func(move *plannedMove) []string {
+		ret := make([]string, 0, 2)
+		for _, name := range []string{move.fromNode, move.toNode} {
+			if shared[name] == false {
+				ret = append(ret, name)
+			}
+		}
+		return ret
+	}
+	next := func() *plannedMove {
+		lock.Lock()
+		defer lock.Unlock()
+		for {
+			left := false
+		moveLoop:
+			for i, move := range moves {
+				if started[i] {
+					continue
+				}
+				left = true
+				for _, name := range nodesOf(move) {
+					if busy[name] {
+						continue moveLoop
+					}
+				}
+				started[i] = true
+				for _, name := range nodesOf(move) {
+					busy[name] = true
+				}
+				return move
+			}
+			if left == false {
+				return nil
+			}
+			cond.Wait()
+		}
+	}
+	done := func(move *plannedMove) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, name := range nodesOf(move) {
+			busy[name] = false
+		}
+		cond.Broadcast()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for move := next(); move != nil; move = next() {
+				start := time.Now()
+				move.err = runPlannedMove(clientset, config, move, opts, parallel > 1)
+				move.duration = time.Since(start)
+				if move.err != nil && parallel > 1 {
+					fmt.Printf("[%s] move err: %v\n", move.op.ID, move.err)
+				} else if move.err != nil {
+					fmt.Printf("\nmove err: %v\n", move.err)
+				}
+				done(move)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func runPlannedMove(clientset *kubernetes.Clientset, config *rest.Config, move *plannedMove, opts moveOptions, quiet bool) error {
+	move.op = opts.newMoveOperation(move.fromNode, move.toNode, move.fromDirs, move.toDirs)
+	move.op.quiet = quiet
+	if exist, err := getMoveOperation(clientset, move.op.ID); err != nil {
+		return err
+	} else if exist != nil {
+		return fmt.Errorf("move %s of these hostpaths is not finished, %s", exist.ID, exist.getContinueHint("move "))
+	}
+	fmt.Printf("\nMove id: %s, %s:%s -> %s:%s\n", move.op.ID, move.fromNode, strings.Join(move.fromDirs, ","), move.toNode, strings.Join(move.toDirs, ","))
+	return runMoveOperation(clientset, config, move.op)
+}
+
+// printPlannedMovesDryRun prints the changes of every move of moves.
+func printPlannedMovesDryRun(pvs *v1.PersistentVolumeList, allPods *v1.PodList, moves []*plannedMove, opts moveOptions) error {
+	for _, move := range moves {
+		op := opts.newMoveOperation(move.fromNode, move.toNode, move.fromDirs, move.toDirs)
+		fmt.Printf("\nMove id: %s, %s:%s -> %s:%s\n", op.ID, move.fromNode, strings.Join(move.fromDirs, ","), move.toNode, strings.Join(move.toDirs, ","))
+		if err := printMoveNodeToNodePlan(pvs, allPods, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
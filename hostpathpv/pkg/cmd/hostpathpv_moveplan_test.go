@@ -0,0 +1,136 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestTargets returns the move targets of frees, the disks of a node are
+// /xfs/disk1, /xfs/disk2 ... in the order of their free quota.
+func newTestTargets(frees map[string][]int64) map[string][]*moveDisk {
+	ret := make(map[string][]*moveDisk)
+	for nodeName, disks := range frees {
+		for i, free := range disks {
+			ret[nodeName] = append(ret[nodeName], &moveDisk{path: testDiskPath(i + 1), free: free})
+		}
+	}
+	return ret
+}
+
+func testDiskPath(i int) string {
+	return fmt.Sprintf("/xfs/disk%d", i)
+}
+
+func getTestTargetsFree(targets map[string][]*moveDisk) map[string][]int64 {
+	ret := make(map[string][]int64)
+	for nodeName, disks := range targets {
+		for _, disk := range disks {
+			ret[nodeName] = append(ret[nodeName], disk.free)
+		}
+	}
+	return ret
+}
+
+func TestPlaceMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		fromNode string
+		quotas   []int64
+		frees    map[string][]int64
+		toNode   string
+		toDirs   []string
+		after    map[string][]int64
+		err      string
+	}{
+		{
+			name:     "node with the most free quota, biggest path to the freest disk",
+			fromNode: "node1",
+			quotas:   []int64{40, 60},
+			frees:    map[string][]int64{"node2": {100}, "node3": {50, 80}},
+			toNode:   "node3",
+			toDirs:   []string{testDiskPath(1), testDiskPath(2)},
+			after:    map[string][]int64{"node2": {100}, "node3": {10, 20}},
+		},
+		{
+			name:     "the from node is no target",
+			fromNode: "node3",
+			quotas:   []int64{10},
+			frees:    map[string][]int64{"node2": {100}, "node3": {500}},
+			toNode:   "node2",
+			toDirs:   []string{testDiskPath(1)},
+			after:    map[string][]int64{"node2": {90}, "node3": {500}},
+		},
+		{
+			name:     "a path does not fit any disk of the freest node",
+			fromNode: "node1",
+			quotas:   []int64{90},
+			frees:    map[string][]int64{"node2": {100}, "node3": {50, 80}},
+			toNode:   "node2",
+			toDirs:   []string{testDiskPath(1)},
+			after:    map[string][]int64{"node2": {10}, "node3": {50, 80}},
+		},
+		{
+			name:     "the paths of a move may go to different disks",
+			fromNode: "node1",
+			quotas:   []int64{70, 70},
+			frees:    map[string][]int64{"node2": {100}, "node3": {70, 70}},
+			toNode:   "node3",
+			toDirs:   []string{testDiskPath(1), testDiskPath(2)},
+			after:    map[string][]int64{"node2": {100}, "node3": {0, 0}},
+		},
+		{
+			name:     "equal free quota picks the first node by name",
+			fromNode: "node1",
+			quotas:   []int64{10},
+			frees:    map[string][]int64{"node3": {100}, "node2": {100}},
+			toNode:   "node2",
+			toDirs:   []string{testDiskPath(1)},
+			after:    map[string][]int64{"node2": {90}, "node3": {100}},
+		},
+		{
+			name:     "no node fits",
+			fromNode: "node1",
+			quotas:   []int64{60, 60},
+			frees:    map[string][]int64{"node2": {100}, "node3": {50, 80}},
+			after:    map[string][]int64{"node2": {100}, "node3": {50, 80}},
+			err:      "no node has",
+		},
+	}
+	for _, test := range tests {
+		move := &plannedMove{fromNode: test.fromNode, quotas: test.quotas}
+		for i := range test.quotas {
+			move.fromDirs = append(move.fromDirs, fmt.Sprintf("/xfs/disk9/path%d", i))
+		}
+		targets := newTestTargets(test.frees)
+		err := placeMove(move, targets)
+		if test.err != "" {
+			if err == nil || strings.Contains(err.Error(), test.err) == false {
+				t.Errorf("%s: err %v, want %q", test.name, err, test.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: err %v", test.name, err)
+		} else if move.toNode != test.toNode || reflect.DeepEqual(move.toDirs, test.toDirs) == false {
+			t.Errorf("%s: placed on %s %v, want %s %v", test.name, move.toNode, move.toDirs, test.toNode, test.toDirs)
+		}
+		if got := getTestTargetsFree(targets); reflect.DeepEqual(got, test.after) == false {
+			t.Errorf("%s: free quota %v, want %v", test.name, got, test.after)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+const HostPathMovePlanKind = "HostPathPVMovePlan"
+
+// MovePlanFile is the content of a move plan file.
+type MovePlanFile struct {
+	Kind  string         `json:"kind"`
+	Time  string         `json:"time"`
+	Moves []MovePlanItem `json:"moves"`
+}
+
+// MovePlanItem is one node to node move of a plan file. The quota paths are
+// the keep quota paths of Pod (NAMESPACE/NAME) on its node or Node, the quota
+// paths of PV on Node, or From (NODE:PATH1,PATH2) like move --from. To is
+// NODE:DISK1,DISK2 like move --to, NODE:DISK for all quota paths, or only
+// NODE to pick the disks.
+type MovePlanItem struct {
+	Pod  string `json:"pod,omitempty"`
+	PV   string `json:"pv,omitempty"`
+	Node string `json:"node,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// writeMovePlanFile saves moves to filename, - means out.
+func writeMovePlanFile(moves []*plannedMove, filename string, out io.Writer) error {
+	plan := MovePlanFile{
+		Kind:  HostPathMovePlanKind,
+		Time:  time.Now().Format(time.RFC3339),
+		Moves: make([]MovePlanItem, 0, len(moves)),
+	}
+	for _, move := range moves {
+		plan.Moves = append(plan.Moves, MovePlanItem{
+			From: fmt.Sprintf("%s:%s", move.fromNode, strings.Join(move.fromDirs, ",")),
+			To:   fmt.Sprintf("%s:%s", move.toNode, strings.Join(move.toDirs, ",")),
+		})
+	}
+	buf, err := yaml.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	if filename == "-" {
+		_, err = out.Write(buf)
+		return err
+	}
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "save %d moves to %s ok\n", len(plan.Moves), filename)
+	return nil
+}
+
+func readMovePlanFile(filename string) (*MovePlanFile, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	plan := &MovePlanFile{}
+	if err := yaml.Unmarshal(buf, plan); err != nil {
+		return nil, fmt.Errorf("parse %s err:%v", filename, err)
+	}
+	if plan.Kind != HostPathMovePlanKind {
+		return nil, fmt.Errorf("%s is not a hostpath move plan file", filename)
+	}
+	return plan, nil
+}
+
+// getPodMovePaths returns the node and the keep quota paths of the pod
+// NAMESPACE/NAME, on nodeName if it is not empty.
+func getPodMovePaths(allPods *v1.PodList, pvs *v1.PersistentVolumeList, pod, nodeName string) (string, []string, error) {
+	strs := strings.Split(pod, "/")
+	if len(strs) != 2 || strs[0] == "" || strs[1] == "" {
+		return "", nil, fmt.Errorf("pod %s should be NAMESPACE/NAME", pod)
+	}
+	if nodeName == "" {
+		for _, p := range allPods.Items {
+			if p.Namespace == strs[0] && p.Name == strs[1] {
+				nodeName = p.Spec.NodeName
+			}
+		}
+		if nodeName == "" {
+			return "", nil, fmt.Errorf("pod %s is not found or not scheduled, its node is required", pod)
+		}
+	}
+	keepPaths, _ := getPodHostPaths(strs[0], strs[1], nodeName, pvs)
+	if len(keepPaths) == 0 {
+		return "", nil, fmt.Errorf("pod %s has no keep quota path on %s", pod, nodeName)
+	}
+	paths := make([]string, 0, len(keepPaths))
+	for _, p := range keepPaths {
+		paths = append(paths, path.Clean(p))
+	}
+	sort.Strings(paths)
+	return nodeName, paths, nil
+}
+
+// getPVMovePaths returns the node and the quota paths of the pv pvName, on
+// nodeName if it is not empty, else on its only mount node.
+func getPVMovePaths(pvs *v1.PersistentVolumeList, pvName, nodeName string) (string, []string, error) {
+	for _, pv := range pvs.Items {
+		if pv.Name != pvName {
+			continue
+		}
+		if algorithm.IsCommonHostPathPV(&pv) == false {
+			return "", nil, fmt.Errorf("pv %s is not a hostpath pv", pvName)
+		}
+		mountList := xfshostpath.HostPathPVMountInfoList{}
+		if pv.Annotations != nil && pv.Annotations[xfs.PVVolumeHostPathMountNode] != "" {
+			if err := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+				return "", nil, fmt.Errorf("pv %s mount info err:%v", pvName, err)
+			}
+		}
+		if nodeName == "" {
+			if len(mountList) != 1 {
+				return "", nil, fmt.Errorf("pv %s is mounted on %d nodes, its node is required", pvName, len(mountList))
+			}
+			nodeName = mountList[0].NodeName
+		}
+		paths := make([]string, 0)
+		for _, item := range mountList {
+			if item.NodeName != nodeName {
+				continue
+			}
+			for _, mountInfo := range item.MountInfos {
+				paths = append(paths, path.Clean(mountInfo.HostPath))
+			}
+		}
+		if len(paths) == 0 {
+			return "", nil, fmt.Errorf("pv %s has no quota path on %s", pvName, nodeName)
+		}
+		sort.Strings(paths)
+		return nodeName, paths, nil
+	}
+	return "", nil, fmt.Errorf("pv %s is not found", pvName)
+}
+
+// resolveMovePlanItem returns the move of item, the to disks are empty if
+// To is only a node.
+func resolveMovePlanItem(item MovePlanItem, allPods *v1.PodList, pvs *v1.PersistentVolumeList) (*plannedMove, error) {
+	var set int
+	for _, str := range []string{item.Pod, item.PV, item.From} {
+		if str != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("one of pod, pv and from is required")
+	}
+	move := &plannedMove{}
+	var err error
+	switch {
+	case item.Pod != "":
+		move.fromNode, move.fromDirs, err = getPodMovePaths(allPods, pvs, item.Pod, item.Node)
+	case item.PV != "":
+		move.fromNode, move.fromDirs, err = getPVMovePaths(pvs, item.PV, item.Node)
+	default:
+		move.fromNode, move.fromDirs, err = checkMoveNodeToNodePath(item.From)
+		if err == nil && len(move.fromDirs) == 0 {
+			err = fmt.Errorf("from %s has no path", item.From)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(item.To, ":") {
+		if move.toNode, move.toDirs, err = checkMoveNodeToNodePath(item.To); err != nil {
+			return nil, err
+		}
+		if move.toDirs, err = expandMoveToDirs(move.fromDirs, move.toDirs); err != nil {
+			return nil, err
+		}
+	} else {
+		move.toNode = item.To
+	}
+	if move.toNode == "" {
+		return nil, fmt.Errorf("to is required")
+	}
+	if err := checkMovePathsIsBelongOnePod(move.fromDirs, allPods, pvs, move.fromNode); err != nil {
+		return nil, err
+	}
+	if pods, err := GetQuotaPathUsePods(allPods, pvs, move.fromNode, move.fromDirs[0]); err == nil {
+		for _, pod := range pods {
+			move.pods = append(move.pods, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+		}
+	}
+	for _, dir := range move.fromDirs {
+		quota, _, _ := GetNodeQuotaPathQuotaSize(pvs, move.fromNode, dir)
+		move.quotas = append(move.quotas, quota)
+	}
+	return move, nil
+}
+
+// newMoveReservePV returns a pv which keeps quota at toPath of nodeName, it
+// is only added to the pv list so that getNodeQuotaInfos counts the quota
+// taken by the moves validated before.
+func newMoveReservePV(index int, nodeName, toPath string, quota int64) v1.PersistentVolume {
+	pv := newTmpPV(fmt.Sprintf("move-plan-reserve-%d", index), nodeName, []string{toPath}, quota)
+	mountList := xfshostpath.HostPathPVMountInfoList{
+		xfshostpath.HostPathPVMountInfo{
+			NodeName:   nodeName,
+			MountInfos: xfshostpath.MountInfoList{{HostPath: toPath, VolumeQuotaSize: quota}},
+		},
+	}
+	buf, _ := json.Marshal(mountList)
+	pv.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
+	return *pv
+}
+
+// planMovePlanFile resolves the moves of plan and validates them by
+// CheckCanMove and checkMovePlacement one after another, the quota taken by a
+// move is not free for the ones after it. The quota freed by a move is not
+// used, so the moves can run in any order.
+func planMovePlanFile(clientset *kubernetes.Clientset, plan *MovePlanFile, pvs *v1.PersistentVolumeList, allPods *v1.PodList,
+	placement string) ([]*plannedMove, error) {
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes err:%v", err)
+	}
+	getNode := func(name string) *v1.Node {
+		for i := range nodes.Items {
+			if nodes.Items[i].Name == name {
+				return &nodes.Items[i]
+			}
+		}
+		return nil
+	}
+	fail := func(i int, err error) error {
+		if len(plan.Moves) == 1 {
+			return err
+		}
+		return fmt.Errorf("move %d: %v", i+1, err)
+	}
+	reserved := pvs.DeepCopy()
+	moves := make([]*plannedMove, 0, len(plan.Moves))
+	moving := make(map[string]int)
+	for i, item := range plan.Moves {
+		move, err := resolveMovePlanItem(item, allPods, pvs)
+		if err != nil {
+			return nil, fail(i, err)
+		}
+		nodeFrom, nodeTo := getNode(move.fromNode), getNode(move.toNode)
+		if nodeFrom == nil || nodeTo == nil {
+			return nil, fail(i, fmt.Errorf("node %s or %s is not found", move.fromNode, move.toNode))
+		}
+		for _, dir := range move.fromDirs {
+			key := move.fromNode + ":" + dir
+			if j, exist := moving[key]; exist {
+				return nil, fail(i, fmt.Errorf("%s is moved by move %d too", key, j))
+			}
+			moving[key] = i + 1
+		}
+		if len(move.toDirs) == 0 {
+			if move.toNode == move.fromNode {
+				return nil, fail(i, fmt.Errorf("the to disks are required to move on node %s", move.toNode))
+			}
+			targets, err := getMoveTargets(&v1.NodeList{Items: []v1.Node{*nodeTo}}, reserved, []string{move.toNode}, nil)
+			if err != nil {
+				return nil, fail(i, err)
+			}
+			if err := placeMove(move, targets); err != nil {
+				return nil, fail(i, err)
+			}
+		}
+		for j := range move.fromDirs {
+			if err := CheckCanMove(clientset, nodeFrom, nodeTo, reserved, move.fromDirs[j:j+1], move.toDirs[j:j+1]); err != nil {
+				return nil, fail(i, err)
+			}
+			reserved.Items = append(reserved.Items, newMoveReservePV(len(reserved.Items), move.toNode,
+				path.Join(move.toDirs[j], path.Base(move.fromDirs[j])), move.quotas[j]))
+		}
+		if err := checkMovePlacement(clientset, placement, nodeFrom, nodeTo, nodes, pvs, allPods, move.fromDirs); err != nil {
+			return nil, fail(i, err)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// moveByPlanFile validates all moves of the plan file filename first, then
+// runs them, at most parallel at the same time.
+func moveByPlanFile(clientset *kubernetes.Clientset, config *rest.Config, filename string, opts moveOptions, parallel int,
+	force, dryRun bool, out io.Writer) error {
+	plan, err := readMovePlanFile(filename)
+	if err != nil {
+		return err
+	}
+	if len(plan.Moves) == 0 {
+		fmt.Fprintf(out, "%s has no move\n", filename)
+		return nil
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	allPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+	moves, err := planMovePlanFile(clientset, plan, pvs, allPods, opts.placement)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Move plan %s:\n", filename)
+	printMovePlan(moves, out)
+
+	if dryRun {
+		return printPlannedMovesDryRun(pvs, allPods, moves, opts)
+	}
+	if force == false {
+		fmt.Printf("Are you sure to run the %d moves (y/n):", len(moves))
+		var ans byte
+		fmt.Scanf("%c", &ans)
+		if ans != 'y' && ans != 'Y' {
+			return nil
+		}
+	}
+	if err := runPlannedMoves(clientset, config, moves, opts, parallel); err != nil {
+		return err
+	}
+	printMoveReport(moves, out)
+	for _, move := range moves {
+		if move.err != nil {
+			return fmt.Errorf("not all moves of %s are done", filename)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// movePodOrPV moves the keep quota paths of a pod or the quota paths of a pv
+// on nodeName to toNode by moveNodeToNode. The to disks are picked like a
+// plan file move if toDisks is empty.
+func movePodOrPV(clientset *kubernetes.Clientset, config *rest.Config, item MovePlanItem, toDisks []string, moveForce bool,
+	opts moveOptions, dryRun bool, out io.Writer) error {
+	if len(toDisks) > 0 {
+		item.To = fmt.Sprintf("%s:%s", item.To, strings.Join(toDisks, ","))
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	allPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+	moves, err := planMovePlanFile(clientset, &MovePlanFile{Moves: []MovePlanItem{item}}, pvs, allPods, opts.placement)
+	if err != nil {
+		return err
+	}
+	move := moves[0]
+	printMovePlan(moves, out)
+	return moveNodeToNode(clientset, config, fmt.Sprintf("%s:%s", move.fromNode, strings.Join(move.fromDirs, ",")),
+		fmt.Sprintf("%s:%s", move.toNode, strings.Join(move.toDirs, ",")), moveForce, opts, dryRun)
+}
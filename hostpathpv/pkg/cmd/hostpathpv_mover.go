@@ -0,0 +1,327 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"path"
+	"time"
+
+	"github.com/Rhealb/kubectl-plugins/hostpathpv/pkg/mover"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// With the native mover the from pod runs hostpathpv-mover send and the move
+// pod runs hostpathpv-mover receive, they only accept each other by the
+// credential in a secret created for the move. The receiver prints json
+// events which are shown as the move progress.
+//
+// With the ssh mover the secret has a host key of the sshd of the from pod and
+// a client key of the move pod instead, so the image has no key of its own and
+// the move pod only trusts the from pod of the same move.
+
+const (
+	moverNative = "native"
+	moverSSH    = "ssh"
+
+	moverPort          = 8873
+	moverCredentialDir = "/etc/hostpathpv-mover"
+	// the credential is deleted with the move pods, this only limits a leaked one.
+	moverCredentialValidFor = 7 * 24 * time.Hour
+
+	sshHostKeyFile        = "ssh_host_rsa_key"
+	sshClientKeyFile      = "id_rsa"
+	sshAuthorizedKeysFile = "authorized_keys"
+	sshKnownHostsFile     = "known_hosts"
+	sshKeyBits            = 2048
+)
+
+func getMoveCredentialName(fromNodeName string, fromDirs []string) string {
+	return fmt.Sprintf("move-%s-tmp-credential-%s", fromNodeName, getHashStr(fromDirs, 5))
+}
+
+func (op *MoveOperation) isNativeMover() bool {
+	return op.Mover == moverNative && op.isExecTransport() == false
+}
+
+// moverName is how op copies, moves saved before --mover have no Mover and
+// are ssh ones.
+func (op *MoveOperation) moverName() string {
+	if op.isExecTransport() {
+		return moveTransportExec
+	} else if op.Mover == "" {
+		return moverSSH
+	}
+	return op.Mover
+}
+
+func (op *MoveOperation) isSSHMover() bool {
+	return op.moverName() == moverSSH
+}
+
+func (op *MoveOperation) credentialName() string {
+	return getMoveCredentialName(op.FromNode, op.FromDirs)
+}
+
+// newMoverCredential returns the secret data of the native mover credential.
+func newMoverCredential() (map[string][]byte, error) {
+	certPEM, keyPEM, err := mover.NewCredential(moverCredentialValidFor)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		mover.CredentialCertFile: certPEM,
+		mover.CredentialKeyFile:  keyPEM,
+	}, nil
+}
+
+// newSSHCredential returns the secret data of the ssh mover credential, the
+// known hosts match the host key for any address as the from pod ip is not
+// known before it runs.
+func newSSHCredential() (map[string][]byte, error) {
+	hostKey, err := rsa.GenerateKey(rand.Reader, sshKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := rsa.GenerateKey(rand.Reader, sshKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		sshHostKeyFile:        encodeSSHPrivateKey(hostKey),
+		sshClientKeyFile:      encodeSSHPrivateKey(clientKey),
+		sshAuthorizedKeysFile: []byte(encodeSSHPublicKey(&clientKey.PublicKey) + "\n"),
+		sshKnownHostsFile:     []byte("* " + encodeSSHPublicKey(&hostKey.PublicKey) + "\n"),
+	}, nil
+}
+
+func encodeSSHPrivateKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// encodeSSHPublicKey returns the authorized_keys line of key, the wire format
+// of RFC 4253 6.6 in base64.
+func encodeSSHPublicKey(key *rsa.PublicKey) string {
+	var buf []byte
+	writeString := func(b []byte) {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+		buf = append(append(buf, l[:]...), b...)
+	}
+	// an mpint has a leading zero byte if its high bit is set
+	writeMPInt := func(n *big.Int) {
+		b := n.Bytes()
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		writeString(b)
+	}
+	writeString([]byte("ssh-rsa"))
+	writeMPInt(big.NewInt(int64(key.E)))
+	writeMPInt(key.N)
+	return "ssh-rsa " + base64.StdEncoding.EncodeToString(buf)
+}
+
+// createMoveCredential creates the secret name of the native or the ssh mover.
+func createMoveCredential(clientset *kubernetes.Clientset, name string, ssh bool) error {
+	newCredential := newMoverCredential
+	if ssh {
+		newCredential = newSSHCredential
+	}
+	data, err := newCredential()
+	if err != nil {
+		return err
+	}
+	if err := deleteMoveCredential(clientset, name); err != nil {
+		return err
+	}
+	_, err = clientset.Core().Secrets(helperPodNamespace()).Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: helperPodNamespace(),
+			Labels:    map[string]string{"app": "kubectlhostpathpv"},
+		},
+		Data: data,
+	})
+	return err
+}
+
+func deleteMoveCredential(clientset *kubernetes.Clientset, name string) error {
+	err := clientset.Core().Secrets(helperPodNamespace()).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && IsNotFound(err) == false {
+		return err
+	}
+	return nil
+}
+
+// deleteMoveTmpPods deletes the tmp pods of op and the credential they use.
+func deleteMoveTmpPods(clientset *kubernetes.Clientset, op *MoveOperation) error {
+	if err := WaitPodsDeleted(clientset, "", op.tmpPods(), true); err != nil {
+		return err
+	}
+	if op.isNativeMover() || op.isSSHMover() {
+		return deleteMoveCredential(clientset, op.credentialName())
+	}
+	return nil
+}
+
+func addMoverCredentialVolume(pod *v1.Pod, credentialName string, mode int32) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: "credential",
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{SecretName: credentialName, DefaultMode: &mode},
+		},
+	})
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      "credential",
+		MountPath: moverCredentialDir,
+		ReadOnly:  true,
+	})
+}
+
+// nativeMoverFrom makes the from pod serve its disk by hostpathpv-mover.
+func nativeMoverFrom(pod *v1.Pod, credentialName string, tuning MoveTuning) {
+	addMoverCredentialVolume(pod, credentialName, 0644)
+	pod.Spec.Containers[0].Args = []string{"-c", fmt.Sprintf("%shostpathpv-mover send --root=/fromdir --listen=:%d --credential=%s --bwlimit=%d",
+		tuning.ioNicePrefix(), moverPort, moverCredentialDir, tuning.BWLimit)}
+}
+
+// nativeMoverTo makes the move pod copy fromDirs from serverip by hostpathpv-mover.
+func nativeMoverTo(pod *v1.Pod, credentialName, serverip string, fromDirs []string, tuning MoveTuning) {
+	addMoverCredentialVolume(pod, credentialName, 0644)
+	cmd := fmt.Sprintf("%shostpathpv-mover receive --server=%s:%d --credential=%s --parallel=%d",
+		tuning.ioNicePrefix(), serverip, moverPort, moverCredentialDir, tuning.Parallel)
+	if tuning.Compress {
+		cmd += " --compress"
+	}
+	for i, fromDir := range fromDirs {
+		fromDir = path.Clean(fromDir)
+		remote := path.Join(path.Base(path.Dir(fromDir)), path.Base(fromDir))
+		cmd += fmt.Sprintf(" %s=/todir-%d/%s", remote, i, path.Base(fromDir))
+	}
+	pod.Spec.Containers[0].Args = []string{"-c", cmd}
+}
+
+// sshMoverFrom makes the from pod serve its disk by sshd with the host key of
+// the credential, the copy reads of the from disk inherit the io priority.
+func sshMoverFrom(pod *v1.Pod, credentialName string, tuning MoveTuning) {
+	// ssh refuses keys which others can read
+	addMoverCredentialVolume(pod, credentialName, 0400)
+	pod.Spec.Containers[0].Args = []string{"-c", fmt.Sprintf("%s/usr/sbin/sshd -D -h %s/%s -o AuthorizedKeysFile=%s/%s -o StrictModes=no",
+		tuning.ioNicePrefix(), moverCredentialDir, sshHostKeyFile, moverCredentialDir, sshAuthorizedKeysFile)}
+}
+
+// sshMoverTo makes scp and rsync of the move pod log in with the client key
+// of the credential and only accept its host key.
+func sshMoverTo(pod *v1.Pod, credentialName string) {
+	addMoverCredentialVolume(pod, credentialName, 0400)
+	config := fmt.Sprintf("Host *\\n  IdentityFile %s/%s\\n  IdentitiesOnly yes\\n  UserKnownHostsFile %s/%s\\n  StrictHostKeyChecking yes\\n",
+		moverCredentialDir, sshClientKeyFile, moverCredentialDir, sshKnownHostsFile)
+	pod.Spec.Containers[0].Args = []string{"-c", fmt.Sprintf("mkdir -p ~/.ssh && printf '%s' > ~/.ssh/config && %s", config, pod.Spec.Containers[0].Args[1])}
+}
+
+// newMoveFromPod returns the from pod of op which serves the from dirs.
+func newMoveFromPod(op *MoveOperation) *v1.Pod {
+	pod := newTmpPodFrom(op.FromNode, op.FromPodName, op.FromDirs[0], op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage)
+	if op.isExecTransport() {
+		newTmpPodExec(pod)
+	} else if op.isNativeMover() {
+		nativeMoverFrom(pod, op.credentialName(), op.Tuning)
+	} else {
+		sshMoverFrom(pod, op.credentialName(), op.Tuning)
+	}
+	return pod
+}
+
+// newMoveToPod returns the move pod of op which copies from serverip, sync is
+// whether an existing copy of the from dirs is updated in place.
+func newMoveToPod(op *MoveOperation, serverip string, sync bool, totalSize int64) *v1.Pod {
+	if op.isExecTransport() {
+		return newTmpPodExec(newTmpPodMove(op.ToNode, op.ToPodName, serverip, op.FromDirs, op.ToDirs, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage))
+	} else if op.isNativeMover() {
+		pod := newTmpPodMove(op.ToNode, op.ToPodName, serverip, op.FromDirs, op.ToDirs, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage)
+		nativeMoverTo(pod, op.credentialName(), serverip, op.FromDirs, op.Tuning)
+		return pod
+	}
+	var pod *v1.Pod
+	if sync {
+		pod = newTmpPodSync(op.ToNode, op.ToPodName, serverip, op.FromDirs, op.ToDirs, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage, op.Tuning)
+	} else {
+		pod = newTmpPodMove(op.ToNode, op.ToPodName, serverip, op.FromDirs, op.ToDirs, op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage)
+		tuneTmpPodMove(pod, serverip, op.FromDirs, op.Tuning, totalSize)
+	}
+	sshMoverTo(pod, op.credentialName())
+	return pod
+}
+
+// createMoveFromPod creates the credential of a native or ssh move and the
+// from pod.
+func createMoveFromPod(clientset *kubernetes.Clientset, op *MoveOperation) (*v1.Pod, error) {
+	if op.isNativeMover() || op.isSSHMover() {
+		if err := createMoveCredential(clientset, op.credentialName(), op.isSSHMover()); err != nil {
+			return nil, fmt.Errorf("create credential:%s err:%v", op.credentialName(), err)
+		}
+	}
+	err, pod := createTmpPod(clientset, newMoveFromPod(op))
+	if err != nil {
+		return nil, fmt.Errorf("create pod:%s err:%v", op.FromPodName, err)
+	}
+	return pod, nil
+}
+
+func parseMoverEvent(line []byte) (mover.Event, bool) {
+	e := mover.Event{}
+	if err := json.Unmarshal(line, &e); err != nil || e.Event == "" {
+		return e, false
+	}
+	return e, true
+}
+
+// getMoverResult returns the done event of the quit move pod, or the error of
+// its error event.
+func getMoverResult(clientset *kubernetes.Clientset, pod *v1.Pod) (mover.Event, error) {
+	req := clientset.Core().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: pod.Spec.Containers[0].Name})
+	reader, err := req.Stream()
+	if err != nil {
+		return mover.Event{}, fmt.Errorf("get pod %s log err:%v", pod.Name, err)
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		e, ok := parseMoverEvent(scanner.Bytes())
+		if ok && e.Event == mover.EventDone {
+			return e, nil
+		} else if ok && e.Event == mover.EventError {
+			return e, fmt.Errorf("mover err:%s", e.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return mover.Event{}, fmt.Errorf("read pod %s log err:%v", pod.Name, err)
+	}
+	return mover.Event{}, fmt.Errorf("pod %s has not reported the result", pod.Name)
+}
@@ -0,0 +1,93 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// readSSHString reads a string of the ssh wire format from buf.
+func readSSHString(t *testing.T, buf []byte) ([]byte, []byte) {
+	if len(buf) < 4 {
+		t.Fatalf("short buffer %d", len(buf))
+	}
+	l := binary.BigEndian.Uint32(buf)
+	if uint32(len(buf)-4) < l {
+		t.Fatalf("string of %d bytes in %d", l, len(buf)-4)
+	}
+	return buf[4 : 4+l], buf[4+l:]
+}
+
+func TestNewSSHCredential(t *testing.T) {
+	data, err := newSSHCredential()
+	if err != nil {
+		t.Fatalf("new ssh credential err:%v", err)
+	}
+	keys := make(map[string]*rsa.PrivateKey)
+	for _, file := range []string{sshHostKeyFile, sshClientKeyFile} {
+		block, _ := pem.Decode(data[file])
+		if block == nil {
+			t.Fatalf("%s is not pem", file)
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s err:%v", file, err)
+		}
+		keys[file] = key
+	}
+	if keys[sshHostKeyFile].N.Cmp(keys[sshClientKeyFile].N) == 0 {
+		t.Fatalf("host and client key are the same")
+	}
+
+	tests := []struct {
+		file   string
+		prefix string
+		key    *rsa.PrivateKey
+	}{
+		{file: sshAuthorizedKeysFile, prefix: "ssh-rsa ", key: keys[sshClientKeyFile]},
+		{file: sshKnownHostsFile, prefix: "* ssh-rsa ", key: keys[sshHostKeyFile]},
+	}
+	for _, test := range tests {
+		line := strings.TrimSuffix(string(data[test.file]), "\n")
+		if strings.HasPrefix(line, test.prefix) == false {
+			t.Fatalf("%s is %q, want prefix %q", test.file, line, test.prefix)
+		}
+		blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, test.prefix))
+		if err != nil {
+			t.Fatalf("%s err:%v", test.file, err)
+		}
+		name, rest := readSSHString(t, blob)
+		e, rest := readSSHString(t, rest)
+		n, rest := readSSHString(t, rest)
+		if string(name) != "ssh-rsa" || len(rest) != 0 {
+			t.Fatalf("%s has key type %q and %d trailing bytes", test.file, name, len(rest))
+		}
+		// a positive mpint never has its high bit set
+		if n[0]&0x80 != 0 || e[0]&0x80 != 0 {
+			t.Errorf("%s has a negative mpint", test.file)
+		}
+		if new(big.Int).SetBytes(e).Int64() != int64(test.key.E) || new(big.Int).SetBytes(n).Cmp(test.key.N) != 0 {
+			t.Errorf("%s is not the public key of its private key", test.file)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rhealb/kubectl-plugins/hostpathpv/pkg/mover"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The copy of a node to node move has no fixed timeout, the size recorded in
+// the pv can be stale and a big copy takes as long as it takes. The moved bytes
+// are followed in the progress of the move pod, or counted by this command for
+// --transport=exec, and the copy is stopped only when they have not grown for
+// the stall timeout of the move. The eta is from their moving average rate.
+
+const (
+	defaultMoveStallTimeout = 600
+	// moveRateWindow is the time the moving average rate is computed over.
+	moveRateWindow = 30 * time.Second
+)
+
+// stallTimeout returns the stall timeout of op, moves saved before there was
+// one get the default.
+func (op *MoveOperation) stallTimeout() int {
+	if op.StallTimeout <= 0 {
+		return defaultMoveStallTimeout
+	}
+	return op.StallTimeout
+}
+
+type moveSample struct {
+	time  time.Time
+	bytes int64
+}
+
+// moveProgress is the moved bytes of a copy.
+type moveProgress struct {
+	lock sync.Mutex
+	// label is shown before the progress, e.g. the pass of a pre-sync.
+	label      string
+	total      int64
+	bytes      int64
+	lastChange time.Time
+	samples    []moveSample
+}
+
+// newMoveProgress starts a copy of total bytes, the stall time starts now.
+func newMoveProgress(total int64) *moveProgress {
+	return &moveProgress{total: total, lastChange: time.Now()}
+}
+
+// update records the moved bytes and the total bytes reported with them, 0 if
+// none is. The moved bytes never go back, e.g. when a log is read again.
+func (p *moveProgress) update(bytes, total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	if total > p.total {
+		p.total = total
+	}
+	if bytes > p.bytes {
+		p.bytes = bytes
+		p.lastChange = now
+	}
+	p.samples = append(p.samples, moveSample{time: now, bytes: p.bytes})
+	for len(p.samples) > 2 && now.Sub(p.samples[1].time) >= moveRateWindow {
+		p.samples = p.samples[1:]
+	}
+}
+
+// rate returns the bytes per second over the last moveRateWindow, p is locked.
+func (p *moveProgress) rate() int64 {
+	if len(p.samples) < 2 {
+		return 0
+	}
+	first, last := p.samples[0], p.samples[len(p.samples)-1]
+	seconds := last.time.Sub(first.time).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return int64(float64(last.bytes-first.bytes) / seconds)
+}
+
+// stalledFor returns how long the moved bytes have not grown.
+func (p *moveProgress) stalledFor() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return time.Since(p.lastChange)
+}
+
+func (p *moveProgress) String() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	rate := p.rate()
+	ret := "Has moved " + strings.Trim(convertIntToString(p.bytes), " ")
+	if p.total > 0 {
+		ret += "/" + strings.Trim(convertIntToString(p.total), " ")
+	}
+	ret += fmt.Sprintf(" (%s/s)", strings.Trim(convertIntToString(rate), " "))
+	if rate > 0 && p.total > p.bytes {
+		ret += fmt.Sprintf(", eta %ds", (p.total-p.bytes)/rate)
+	}
+	if p.label != "" {
+		ret = p.label + ", " + ret
+	}
+	return "[ " + ret + " ]"
+}
+
+// waitMoveProgress waits until quit returns true or an error. It fails if the
+// moved bytes of p have not grown for stallTimeout seconds. The progress is
+// sent to strChan every second, stateLen is the length of the last one sent.
+func waitMoveProgress(p *moveProgress, stallTimeout int, quit func() (bool, error), strChan chan<- string, stateLen *int) error {
+	for {
+		done, err := quit()
+		if err != nil || done {
+			return err
+		}
+		// a sample now lets the rate go down while nothing is reported
+		p.update(0, 0)
+		if stalled := p.stalledFor(); stalled >= time.Duration(stallTimeout)*time.Second {
+			p.lock.Lock()
+			bytes := p.bytes
+			p.lock.Unlock()
+			return fmt.Errorf("stalled, nothing moved for %ds after %s", int(stalled.Seconds()), strings.Trim(convertIntToString(bytes), " "))
+		}
+		str := p.String()
+		select {
+		case strChan <- str:
+			*stateLen = len(str)
+		default:
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// isMovePodQuit returns whether pod has succeeded or is gone, and an error if
+// it has failed.
+func isMovePodQuit(clientset *kubernetes.Clientset, pod *v1.Pod) (bool, error) {
+	curPod, err := clientset.Core().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	if err != nil {
+		if IsPodNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	switch curPod.Status.Phase {
+	case v1.PodSucceeded:
+		return true, nil
+	case v1.PodFailed:
+		return false, fmt.Errorf("pod:%s is failed", pod.Name)
+	}
+	return false, nil
+}
+
+// followMovePodProgress updates p from the progress lines of the log of pod
+// until stop is closed, parse returns the moved and total bytes of a line. The
+// log is followed again if it breaks.
+func followMovePodProgress(clientset *kubernetes.Clientset, pod *v1.Pod, p *moveProgress,
+	parse func(line []byte) (int64, int64, bool), stop <-chan struct{}) {
+	go func() {
+		for {
+			if reader := getMovePodLogReader(clientset, pod); reader != nil {
+				closed := make(chan struct{})
+				go func() {
+					select {
+					case <-stop:
+					case <-closed:
+					}
+					reader.Close()
+				}()
+				scanner := bufio.NewScanner(reader)
+				for scanner.Scan() {
+					if bytes, total, ok := parse(scanner.Bytes()); ok {
+						p.update(bytes, total)
+					}
+				}
+				close(closed)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(1 * time.Second):
+			}
+		}
+	}()
+}
+
+// progressParser returns the parser of the progress of the move pod of op, sync
+// is whether it is a sync pod.
+func (op *MoveOperation) progressParser(sync bool) func(line []byte) (int64, int64, bool) {
+	if op.isNativeMover() {
+		return parseMoverProgress
+	} else if sync {
+		return newSyncProgressParser()
+	}
+	return parseScpProgress
+}
+
+// parseMoverProgress parses a progress event of the native mover.
+func parseMoverProgress(line []byte) (int64, int64, bool) {
+	e, ok := parseMoverEvent(line)
+	if ok == false || e.Event != mover.EventProgress {
+		return 0, 0, false
+	}
+	return e.Bytes, e.TotalBytes, true
+}
+
+// parseScpProgress parses a "Has moved 1.25 GB (...)" line of the scp or rsync
+// move pod, the bytes are as exact as the printed size.
+func parseScpProgress(line []byte) (int64, int64, bool) {
+	str := string(line)
+	i := strings.Index(str, "Has moved ")
+	if i < 0 {
+		return 0, 0, false
+	}
+	var size float64
+	var unit string
+	if n, _ := fmt.Sscanf(str[i+len("Has moved "):], "%f %s", &size, &unit); n != 2 {
+		return 0, 0, false
+	}
+	switch unit {
+	case "GB":
+		size *= 1024 * 1024 * 1024
+	case "MB":
+		size *= 1024 * 1024
+	case "KB":
+		size *= 1024
+	case "B":
+	default:
+		return 0, 0, false
+	}
+	return int64(size), 0, true
+}
@@ -0,0 +1,175 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The image entrypoint.sh copies all dirs in parallel with no limit. When any
+// tuning flag is set the move pod runs the script of getTunedMoveScript
+// instead, it prints the same progress lines with an eta added.
+
+// MoveTuning limits the resources a move takes from the nodes.
+type MoveTuning struct {
+	// BWLimit is the bandwidth cap of the whole move in MB/s, 0 is no limit.
+	BWLimit int `json:"bwLimit,omitempty"`
+	// Parallel is the max dirs copied at the same time, 0 is all.
+	Parallel int  `json:"parallel,omitempty"`
+	Compress bool `json:"compress,omitempty"`
+	// IONice is the best effort io priority 0-7 of the copy, -1 is not set.
+	IONice int `json:"ioNice"`
+}
+
+func addMoveTuningFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("movebwlimit", 0, "Bandwidth cap of the whole move in MB/s, 0 is no limit")
+	cmd.Flags().Int("moveparallel", 0, "Max dirs copied at the same time, 0 is all")
+	cmd.Flags().Bool("movecompress", false, "Compress the data in transfer")
+	cmd.Flags().Int("moveionice", -1, "Best effort io priority 0(high)-7(low) of the copy on both nodes, -1 is not set")
+}
+
+func getMoveTuning(cmd *cobra.Command) (MoveTuning, error) {
+	tuning := MoveTuning{
+		BWLimit:  GetFlagInt(cmd, "movebwlimit"),
+		Parallel: GetFlagInt(cmd, "moveparallel"),
+		Compress: GetFlagBool(cmd, "movecompress"),
+		IONice:   GetFlagInt(cmd, "moveionice"),
+	}
+	if tuning.BWLimit < 0 || tuning.Parallel < 0 {
+		return tuning, fmt.Errorf("--movebwlimit and --moveparallel should be >= 0")
+	}
+	if tuning.IONice < -1 || tuning.IONice > 7 {
+		return tuning, fmt.Errorf("--moveionice should be in -1 to 7")
+	}
+	return tuning, nil
+}
+
+func (tuning MoveTuning) isSet() bool {
+	return tuning.BWLimit > 0 || tuning.Parallel > 0 || tuning.Compress || tuning.IONice >= 0
+}
+
+func (tuning MoveTuning) String() string {
+	strs := make([]string, 0, 4)
+	if tuning.BWLimit > 0 {
+		strs = append(strs, fmt.Sprintf("bwlimit=%dMB/s", tuning.BWLimit))
+	}
+	if tuning.Parallel > 0 {
+		strs = append(strs, fmt.Sprintf("parallel=%d", tuning.Parallel))
+	}
+	if tuning.Compress {
+		strs = append(strs, "compress")
+	}
+	if tuning.IONice >= 0 {
+		strs = append(strs, fmt.Sprintf("ionice=%d", tuning.IONice))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// parallel returns the number of transfers running at the same time.
+func (tuning MoveTuning) parallel(dirNum int) int {
+	if tuning.Parallel > 0 && tuning.Parallel < dirNum {
+		return tuning.Parallel
+	}
+	return dirNum
+}
+
+// ioNicePrefix is the command prefix to run a copy with the io priority.
+func (tuning MoveTuning) ioNicePrefix() string {
+	if tuning.IONice < 0 {
+		return ""
+	}
+	return fmt.Sprintf("ionice -c2 -n%d ", tuning.IONice)
+}
+
+// copyOptions splits the bandwidth cap over the parallel transfers, --bwlimit is in KB/s.
+func (tuning MoveTuning) copyOptions(dirNum int) string {
+	opts := "-ra"
+	if tuning.BWLimit > 0 {
+		opts += fmt.Sprintf(" --bwlimit=%d", tuning.BWLimit*1024/tuning.parallel(dirNum))
+	}
+	if tuning.Compress {
+		opts += " -z"
+	}
+	return opts
+}
+
+// rsyncOptions is for the one by one rsync of pre-sync, --bwlimit is in KB/s.
+func (tuning MoveTuning) rsyncOptions() string {
+	opts := "-a --delete --stats"
+	if tuning.BWLimit > 0 {
+		opts += fmt.Sprintf(" --bwlimit=%d", tuning.BWLimit*1024)
+	}
+	if tuning.Compress {
+		opts += " -z"
+	}
+	return opts
+}
+
+// estimateMoveTime returns the seconds to move size bytes at the bandwidth cap, 0 if there is no cap.
+func (tuning MoveTuning) estimateMoveTime(size int64) int64 {
+	if tuning.BWLimit <= 0 {
+		return 0
+	}
+	return size / (int64(tuning.BWLimit) * 1024 * 1024)
+}
+
+// getTunedMoveScript copies fromDirs of serverip to the /todir-N of the move
+// pod like entrypoint.sh and prints the progress with an eta to totalSize.
+func getTunedMoveScript(serverip string, fromDirs []string, tuning MoveTuning, totalSize int64) string {
+	dests := make([]string, 0, len(fromDirs))
+	cmd := "fh() { awk -v s=$1 'BEGIN{if (s>=1073741824) printf \"%.2f GB\", s/1073741824; " +
+		"else if (s>=1048576) printf \"%.2f MB\", s/1048576; else if (s>=1024) printf \"%.2f KB\", s/1024; else printf \"%d B\", s}'; }; "
+	cmd += "echo -n > /fail.txt; echo -n > /result.txt; "
+	cmd += fmt.Sprintf("cp1() { %srsync %s $2 /todir-$1/ 1>/dev/null 2>/dev/null || echo true > /fail.txt; echo stop >> /result.txt; }; ",
+		tuning.ioNicePrefix(), tuning.copyOptions(len(fromDirs)))
+	cmd += "{ "
+	for i, fromDir := range fromDirs {
+		fromDir = path.Clean(fromDir)
+		tmp := path.Join(path.Base(path.Dir(fromDir)), path.Base(fromDir))
+		cmd += fmt.Sprintf("while [ $(jobs -rp | wc -l) -ge %d ]; do sleep 1; done; ", tuning.parallel(len(fromDirs)))
+		cmd += fmt.Sprintf("cp1 %d %s:/fromdir/%s & ", i, serverip, tmp)
+		dests = append(dests, fmt.Sprintf("/todir-%d/%s", i, path.Base(fromDir)))
+	}
+	cmd += "wait; } & "
+	cmd += "last=0; while true; do sum=0; "
+	cmd += fmt.Sprintf("for d in %s; do s=$(du -b --max-depth=0 $d 2>/dev/null | awk '{print $1}'); (( sum = sum + ${s:-0} )); done; ",
+		strings.Join(dests, " "))
+	cmd += fmt.Sprintf("(( diff = sum - last )); last=$sum; (( rem = %d - sum )); eta=\"\"; ", totalSize)
+	cmd += "if [ $diff -gt 0 ] && [ $rem -gt 0 ]; then eta=\", eta $(( rem / diff ))s\"; fi; "
+	cmd += "echo \"Has moved $(fh $sum) ($(fh $diff)/s)$eta\"; "
+	cmd += fmt.Sprintf("if [ $(grep -c stop /result.txt) -ge %d ]; then break; fi; sleep 1; done; ", len(fromDirs))
+	cmd += "wait; if [ \"$(cat /fail.txt)\" == \"true\" ]; then echo \"scp fail\"; exit 1; fi; echo \"scp success\""
+	return cmd
+}
+
+// tuneTmpPodMove replaces the image entrypoint.sh of the move pod if any tuning is set.
+func tuneTmpPodMove(pod *v1.Pod, serverip string, fromDirs []string, tuning MoveTuning, totalSize int64) {
+	if tuning.isSet() {
+		pod.Spec.Containers[0].Args = []string{"-c", getTunedMoveScript(serverip, fromDirs, tuning, totalSize)}
+	}
+}
+
+func createTmpPod(clientset *kubernetes.Clientset, pod *v1.Pod) (error, *v1.Pod) {
+	WaitPodsDeleted(clientset, pod.Spec.NodeName, []*v1.Pod{pod}, true)
+	createPod, err := clientset.Core().Pods(pod.Namespace).Create(pod)
+	return err, createPod
+}
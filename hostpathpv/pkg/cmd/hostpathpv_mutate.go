@@ -0,0 +1,118 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// The csi plugin rewrites the pv mount info annotation every few seconds, so
+// every change is applied to a freshly read object and updated with its
+// resourceVersion. On conflict the object is read again and the change is
+// re-applied, so that neither our change nor the plugin's usage numbers are lost.
+
+// PVMutateFunc changes pv in place and reports whether it is changed.
+type PVMutateFunc func(pv *v1.PersistentVolume) (changed bool, err error)
+
+// NodeMutateFunc changes node in place and reports whether it is changed.
+type NodeMutateFunc func(node *v1.Node) (changed bool, err error)
+
+// MountListMutateFunc returns the changed mount info list of a pv.
+type MountListMutateFunc func(list xfshostpath.HostPathPVMountInfoList) (xfshostpath.HostPathPVMountInfoList, bool, error)
+
+// mutatePV applies mutate to the current pv and updates it, it returns the
+// updated pv or the current one if nothing is changed.
+func mutatePV(clientset *kubernetes.Clientset, pvName string, mutate PVMutateFunc) (*v1.PersistentVolume, error) {
+	var ret *v1.PersistentVolume
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		pv, err := clientset.Core().PersistentVolumes().Get(pvName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed, err := mutate(pv)
+		if err != nil {
+			return err
+		}
+		if changed == false {
+			ret = pv
+			return nil
+		}
+		ret, err = clientset.Core().PersistentVolumes().Update(pv)
+		return err
+	})
+	return ret, err
+}
+
+// mutateNode applies mutate to the current node and updates it, it returns the
+// updated node or the current one if nothing is changed.
+func mutateNode(clientset *kubernetes.Clientset, nodeName string, mutate NodeMutateFunc) (*v1.Node, error) {
+	var ret *v1.Node
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		node, err := clientset.Core().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed, err := mutate(node)
+		if err != nil {
+			return err
+		}
+		if changed == false {
+			ret = node
+			return nil
+		}
+		ret, err = clientset.Core().Nodes().Update(node)
+		return err
+	})
+	return ret, err
+}
+
+// mutatePVMountList applies mutate to the freshly decoded mount info list of pv.
+func mutatePVMountList(clientset *kubernetes.Clientset, pvName string, mutate MountListMutateFunc) (*v1.PersistentVolume, error) {
+	return mutatePV(clientset, pvName, func(pv *v1.PersistentVolume) (bool, error) {
+		return mutateMountList(pv, mutate)
+	})
+}
+
+func mutateMountList(pv *v1.PersistentVolume, mutate MountListMutateFunc) (bool, error) {
+	mountList := xfshostpath.HostPathPVMountInfoList{}
+	if pv.Annotations != nil && pv.Annotations[xfs.PVVolumeHostPathMountNode] != "" {
+		if err := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+			return false, fmt.Errorf("pv %s annotation %s err:%v", pv.Name, xfs.PVVolumeHostPathMountNode, err)
+		}
+	}
+	newList, changed, err := mutate(mountList)
+	if err != nil || changed == false {
+		return false, err
+	}
+	buf, err := json.Marshal(newList)
+	if err != nil {
+		return false, err
+	}
+	if pv.Annotations == nil {
+		pv.Annotations = make(map[string]string)
+	}
+	pv.Annotations[xfs.PVVolumeHostPathMountNode] = string(buf)
+	return true, nil
+}
@@ -0,0 +1,331 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+)
+
+// After a node to node move the pods of the quota paths can only run on the to
+// node, if they can not be scheduled there the data is stranded. Before the
+// move the node selector, the required node affinity, the tolerations, the
+// required pod anti-affinity and the resource requests of the pods are checked
+// against the to node. --placement decides if a move which does not fit is
+// stopped, only warned about or not checked.
+
+const (
+	movePlacementBlock  = "block"
+	movePlacementWarn   = "warn"
+	movePlacementIgnore = "ignore"
+)
+
+func checkMovePlacementMode(mode string) error {
+	if mode != movePlacementBlock && mode != movePlacementWarn && mode != movePlacementIgnore {
+		return fmt.Errorf("--placement should be %s, %s or %s", movePlacementBlock, movePlacementWarn, movePlacementIgnore)
+	}
+	return nil
+}
+
+// placement returns the placement check of op, moves saved before there was a
+// placement check block.
+func (op *MoveOperation) placement() string {
+	if op.Placement == "" {
+		return movePlacementBlock
+	}
+	return op.Placement
+}
+
+// checkMovePlacement checks the pods using fromDirs of nodeFrom against
+// nodeTo as mode decides.
+func checkMovePlacement(clientset *kubernetes.Clientset, mode string, nodeFrom, nodeTo *v1.Node, nodes *v1.NodeList,
+	pvs *v1.PersistentVolumeList, allPods *v1.PodList, fromDirs []string) error {
+	if mode == movePlacementIgnore || nodeFrom.Name == nodeTo.Name {
+		return nil
+	}
+	pods, err := GetQuotaPathUsePods(allPods, pvs, nodeFrom.Name, fromDirs[0])
+	if err != nil {
+		return fmt.Errorf("getQuotaPathUsePods err:%v", err)
+	}
+	if nodes == nil {
+		if nodes, err = clientset.Core().Nodes().List(metav1.ListOptions{}); err != nil {
+			return fmt.Errorf("list nodes err:%v", err)
+		}
+	}
+	reasons := getPodsPlacementReasons(pods, nodeTo, nodes, allPods)
+	if len(reasons) == 0 {
+		return nil
+	}
+	if mode == movePlacementWarn {
+		for _, reason := range reasons {
+			fmt.Printf("\nWarning: %s", reason)
+		}
+		fmt.Printf("\n")
+		return nil
+	}
+	return fmt.Errorf("the pods can not be scheduled to %s: %s", nodeTo.Name, strings.Join(reasons, "; "))
+}
+
+// getPodsPlacementReasons returns why pods, moved together, can not be
+// scheduled to node.
+func getPodsPlacementReasons(pods []*v1.Pod, node *v1.Node, nodes *v1.NodeList, allPods *v1.PodList) []string {
+	moved := make(map[string]bool)
+	for _, pod := range pods {
+		moved[pod.Namespace+"/"+pod.Name] = true
+	}
+	nodeLabels := make(map[string]map[string]string)
+	for i := range nodes.Items {
+		nodeLabels[nodes.Items[i].Name] = nodes.Items[i].Labels
+	}
+	nodeLabels[node.Name] = node.Labels
+
+	// the pods which stay where they are and the moved pods on node
+	others := make([]*v1.Pod, 0)
+	for i := range allPods.Items {
+		pod := &allPods.Items[i]
+		if pod.Spec.NodeName == "" || isPodTerminated(pod) || moved[pod.Namespace+"/"+pod.Name] {
+			continue
+		}
+		others = append(others, pod)
+	}
+
+	reasons := make([]string, 0)
+	if node.Spec.Unschedulable {
+		reasons = append(reasons, fmt.Sprintf("node %s is unschedulable", node.Name))
+	}
+	for _, pod := range pods {
+		prefix := fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name)
+		for _, reason := range getPodNodeReasons(pod, node) {
+			reasons = append(reasons, prefix+": "+reason)
+		}
+		siblings := append([]*v1.Pod{}, others...)
+		for _, p := range pods {
+			if p != pod {
+				sibling := p.DeepCopy()
+				sibling.Spec.NodeName = node.Name
+				siblings = append(siblings, sibling)
+			}
+		}
+		for _, reason := range getPodAntiAffinityReasons(pod, node, siblings, nodeLabels) {
+			reasons = append(reasons, prefix+": "+reason)
+		}
+	}
+	reasons = append(reasons, getPodsResourceReasons(pods, node, others)...)
+	return reasons
+}
+
+// getPodNodeReasons checks the node selector, the required node affinity and
+// the tolerations of pod.
+func getPodNodeReasons(pod *v1.Pod, node *v1.Node) []string {
+	reasons := make([]string, 0)
+	keys := make([]string, 0, len(pod.Spec.NodeSelector))
+	for k := range pod.Spec.NodeSelector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, exist := node.Labels[k]; exist == false || v != pod.Spec.NodeSelector[k] {
+			reasons = append(reasons, fmt.Sprintf("node selector %s=%s does not match node %s", k, pod.Spec.NodeSelector[k], node.Name))
+		}
+	}
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil &&
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		matched := false
+		for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			if nodeSelectorTermMatches(term, node) {
+				matched = true
+				break
+			}
+		}
+		if matched == false {
+			reasons = append(reasons, fmt.Sprintf("required node affinity does not match node %s", node.Name))
+		}
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if tolerated == false {
+			reasons = append(reasons, fmt.Sprintf("taint %s of node %s is not tolerated", taint.ToString(), node.Name))
+		}
+	}
+	return reasons
+}
+
+// nodeSelectorTermMatches returns whether node matches all requirements of
+// term, a term without requirements matches no node.
+func nodeSelectorTermMatches(term v1.NodeSelectorTerm, node *v1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	operators := map[v1.NodeSelectorOperator]selection.Operator{
+		v1.NodeSelectorOpIn:           selection.In,
+		v1.NodeSelectorOpNotIn:        selection.NotIn,
+		v1.NodeSelectorOpExists:       selection.Exists,
+		v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+		v1.NodeSelectorOpGt:           selection.GreaterThan,
+		v1.NodeSelectorOpLt:           selection.LessThan,
+	}
+	for _, expr := range term.MatchExpressions {
+		op, exist := operators[expr.Operator]
+		if exist == false {
+			return false
+		}
+		r, err := labels.NewRequirement(expr.Key, op, expr.Values)
+		if err != nil || r.Matches(labels.Set(node.Labels)) == false {
+			return false
+		}
+	}
+	for _, field := range term.MatchFields {
+		if field.Key != "metadata.name" {
+			return false
+		}
+		in := stringsContain(field.Values, node.Name)
+		if (field.Operator == v1.NodeSelectorOpIn && in == false) || (field.Operator == v1.NodeSelectorOpNotIn && in) ||
+			(field.Operator != v1.NodeSelectorOpIn && field.Operator != v1.NodeSelectorOpNotIn) {
+			return false
+		}
+	}
+	return true
+}
+
+// getPodAntiAffinityReasons checks the required pod anti-affinity of pod
+// against the pods in the same topology on node, and theirs against pod.
+func getPodAntiAffinityReasons(pod *v1.Pod, node *v1.Node, pods []*v1.Pod, nodeLabels map[string]map[string]string) []string {
+	reasons := make([]string, 0)
+	sameTopology := func(other *v1.Pod, topologyKey string) bool {
+		value, exist := node.Labels[topologyKey]
+		otherValue, otherExist := nodeLabels[other.Spec.NodeName][topologyKey]
+		return exist && otherExist && value == otherValue
+	}
+	for _, other := range pods {
+		if pod.Spec.Affinity != nil && pod.Spec.Affinity.PodAntiAffinity != nil {
+			for _, term := range pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if sameTopology(other, term.TopologyKey) && podAffinityTermMatches(term, pod, other) {
+					reasons = append(reasons, fmt.Sprintf("anti-affinity with pod %s/%s on node %s by %s",
+						other.Namespace, other.Name, other.Spec.NodeName, term.TopologyKey))
+				}
+			}
+		}
+		if other.Spec.Affinity != nil && other.Spec.Affinity.PodAntiAffinity != nil {
+			for _, term := range other.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if sameTopology(other, term.TopologyKey) && podAffinityTermMatches(term, other, pod) {
+					reasons = append(reasons, fmt.Sprintf("anti-affinity of pod %s/%s on node %s by %s",
+						other.Namespace, other.Name, other.Spec.NodeName, term.TopologyKey))
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+// podAffinityTermMatches returns whether term of owner selects pod.
+func podAffinityTermMatches(term v1.PodAffinityTerm, owner, pod *v1.Pod) bool {
+	namespaces := term.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{owner.Namespace}
+	}
+	if stringsContain(namespaces, pod.Namespace) == false {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(pod.Labels))
+}
+
+// getPodsResourceReasons checks the cpu, memory and pod number requested by
+// pods together with the pods already on node against its allocatable.
+func getPodsResourceReasons(pods []*v1.Pod, node *v1.Node, others []*v1.Pod) []string {
+	used := v1.ResourceList{}
+	podNum := int64(0)
+	for _, pod := range others {
+		if pod.Spec.NodeName == node.Name {
+			addResourceList(used, getPodRequests(pod))
+			podNum++
+		}
+	}
+	need := v1.ResourceList{}
+	for _, pod := range pods {
+		addResourceList(need, getPodRequests(pod))
+	}
+	reasons := make([]string, 0)
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		allocatable, exist := node.Status.Allocatable[name]
+		requested := need[name]
+		if exist == false || requested.IsZero() {
+			continue
+		}
+		free := allocatable.DeepCopy()
+		free.Sub(used[name])
+		if free.Cmp(requested) < 0 {
+			reasons = append(reasons, fmt.Sprintf("insufficient %s on node %s, %s requested but %s of %s allocatable is free",
+				name, node.Name, requested.String(), free.String(), allocatable.String()))
+		}
+	}
+	if allocatable, exist := node.Status.Allocatable[v1.ResourcePods]; exist && podNum+int64(len(pods)) > allocatable.Value() {
+		reasons = append(reasons, fmt.Sprintf("node %s has %d of max %d pods", node.Name, podNum, allocatable.Value()))
+	}
+	return reasons
+}
+
+// getPodRequests returns the requests of the containers of pod, or of an init
+// container if it requests more.
+func getPodRequests(pod *v1.Pod) v1.ResourceList {
+	ret := v1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		addResourceList(ret, c.Resources.Requests)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, quantity := range c.Resources.Requests {
+			if value, exist := ret[name]; exist == false || quantity.Cmp(value) > 0 {
+				ret[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return ret
+}
+
+func addResourceList(list, add v1.ResourceList) {
+	for name, quantity := range add {
+		if value, exist := list[name]; exist {
+			value.Add(quantity)
+			list[name] = value
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func isPodTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
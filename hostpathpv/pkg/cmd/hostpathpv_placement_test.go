@@ -0,0 +1,277 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestPlacementNode(name string, labels map[string]string, taints ...v1.Taint) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       v1.NodeSpec{Taints: taints},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+			v1.ResourcePods:   resource.MustParse("3"),
+		}},
+	}
+}
+
+func newTestPlacementPod(name, nodeName, cpu string, labels map[string]string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+		Spec:       v1.PodSpec{NodeName: nodeName, Containers: []v1.Container{{Name: "c"}}},
+	}
+	if cpu != "" {
+		pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)}
+	}
+	return pod
+}
+
+func newTestAntiAffinity(app, topologyKey string) *v1.Affinity {
+	return &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			TopologyKey:   topologyKey,
+		}},
+	}}
+}
+
+func newTestNodeAffinity(terms ...v1.NodeSelectorTerm) *v1.Affinity {
+	return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms},
+	}}
+}
+
+func TestGetPodsPlacementReasons(t *testing.T) {
+	zoneLabels := func(name, zone string) map[string]string {
+		return map[string]string{"kubernetes.io/hostname": name, "zone": zone, "disk": "ssd"}
+	}
+	noSchedule := v1.Taint{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoSchedule}
+	preferNoSchedule := v1.Taint{Key: "spare", Effect: v1.TaintEffectPreferNoSchedule}
+
+	tests := []struct {
+		name string
+		// the pods are moved from node1 to node, others are already running
+		pods   []*v1.Pod
+		node   *v1.Node
+		others []*v1.Pod
+		// reasons are parts of the expected reasons, in order
+		reasons []string
+	}{
+		{
+			name: "a pod which fits",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "1", nil)},
+			node: newTestPlacementNode("node2", zoneLabels("node2", "a"), preferNoSchedule),
+		},
+		{
+			name: "unschedulable node",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "", nil)},
+			node: func() *v1.Node {
+				node := newTestPlacementNode("node2", nil)
+				node.Spec.Unschedulable = true
+				return node
+			}(),
+			reasons: []string{"node node2 is unschedulable"},
+		},
+		{
+			name: "node selector",
+			pods: func() []*v1.Pod {
+				pod := newTestPlacementPod("web-0", "node1", "", nil)
+				pod.Spec.NodeSelector = map[string]string{"disk": "hdd", "zone": "a"}
+				return []*v1.Pod{pod}
+			}(),
+			node:    newTestPlacementNode("node2", zoneLabels("node2", "a")),
+			reasons: []string{"pod default/web-0: node selector disk=hdd does not match node node2"},
+		},
+		{
+			name: "required node affinity matches one term",
+			pods: func() []*v1.Pod {
+				pod := newTestPlacementPod("web-0", "node1", "", nil)
+				pod.Spec.Affinity = newTestNodeAffinity(
+					v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{
+						{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"b"}}}},
+					v1.NodeSelectorTerm{MatchFields: []v1.NodeSelectorRequirement{
+						{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"node2"}}}},
+				)
+				return []*v1.Pod{pod}
+			}(),
+			node: newTestPlacementNode("node2", zoneLabels("node2", "a")),
+		},
+		{
+			name: "required node affinity",
+			pods: func() []*v1.Pod {
+				pod := newTestPlacementPod("web-0", "node1", "", nil)
+				pod.Spec.Affinity = newTestNodeAffinity(
+					v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{
+						{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"b"}},
+						{Key: "disk", Operator: v1.NodeSelectorOpExists}}},
+					// a term without requirements matches no node
+					v1.NodeSelectorTerm{},
+				)
+				return []*v1.Pod{pod}
+			}(),
+			node:    newTestPlacementNode("node2", zoneLabels("node2", "a")),
+			reasons: []string{"pod default/web-0: required node affinity does not match node node2"},
+		},
+		{
+			name:    "untolerated taint",
+			pods:    []*v1.Pod{newTestPlacementPod("web-0", "node1", "", nil)},
+			node:    newTestPlacementNode("node2", nil, noSchedule, preferNoSchedule),
+			reasons: []string{"pod default/web-0: taint dedicated=db:NoSchedule of node node2 is not tolerated"},
+		},
+		{
+			name: "tolerated taint",
+			pods: func() []*v1.Pod {
+				pod := newTestPlacementPod("web-0", "node1", "", nil)
+				pod.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+				return []*v1.Pod{pod}
+			}(),
+			node: newTestPlacementNode("node2", nil, noSchedule),
+		},
+		{
+			name: "anti-affinity of the moved pod",
+			pods: func() []*v1.Pod {
+				pod := newTestPlacementPod("web-0", "node1", "", map[string]string{"app": "web"})
+				pod.Spec.Affinity = newTestAntiAffinity("web", "zone")
+				return []*v1.Pod{pod}
+			}(),
+			node: newTestPlacementNode("node2", zoneLabels("node2", "a")),
+			others: []*v1.Pod{
+				newTestPlacementPod("web-1", "node3", "", map[string]string{"app": "web"}),
+				newTestPlacementPod("web-2", "node4", "", map[string]string{"app": "web"}),
+			},
+			reasons: []string{"pod default/web-0: anti-affinity with pod default/web-1 on node node3 by zone"},
+		},
+		{
+			name: "anti-affinity of a running pod",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "", map[string]string{"app": "web"})},
+			node: newTestPlacementNode("node2", zoneLabels("node2", "a")),
+			others: func() []*v1.Pod {
+				pod := newTestPlacementPod("db-0", "node2", "", map[string]string{"app": "db"})
+				pod.Spec.Affinity = newTestAntiAffinity("web", "kubernetes.io/hostname")
+				return []*v1.Pod{pod}
+			}(),
+			reasons: []string{"pod default/web-0: anti-affinity of pod default/db-0 on node node2 by kubernetes.io/hostname"},
+		},
+		{
+			name: "anti-affinity between the moved pods",
+			pods: func() []*v1.Pod {
+				pods := make([]*v1.Pod, 0)
+				for _, name := range []string{"web-0", "web-1"} {
+					pod := newTestPlacementPod(name, "node1", "", map[string]string{"app": "web"})
+					pod.Spec.Affinity = newTestAntiAffinity("web", "kubernetes.io/hostname")
+					pods = append(pods, pod)
+				}
+				return pods
+			}(),
+			node: newTestPlacementNode("node2", zoneLabels("node2", "a")),
+			reasons: []string{
+				"pod default/web-0: anti-affinity with pod default/web-1 on node node2",
+				"pod default/web-0: anti-affinity of pod default/web-1 on node node2",
+				"pod default/web-1: anti-affinity with pod default/web-0 on node node2",
+				"pod default/web-1: anti-affinity of pod default/web-0 on node node2",
+			},
+		},
+		{
+			name: "insufficient cpu with the pods on the node",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "1500m", nil)},
+			node: newTestPlacementNode("node2", nil),
+			others: []*v1.Pod{
+				newTestPlacementPod("db-0", "node2", "1", nil),
+				newTestPlacementPod("db-1", "node3", "1", nil),
+			},
+			reasons: []string{"insufficient cpu on node node2, 1500m requested but 1 of 2 allocatable is free"},
+		},
+		{
+			name: "terminated pods take no resources",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "1500m", nil)},
+			node: newTestPlacementNode("node2", nil),
+			others: func() []*v1.Pod {
+				pod := newTestPlacementPod("job-0", "node2", "1", nil)
+				pod.Status.Phase = v1.PodSucceeded
+				return []*v1.Pod{pod}
+			}(),
+		},
+		{
+			name: "max pods",
+			pods: []*v1.Pod{newTestPlacementPod("web-0", "node1", "", nil), newTestPlacementPod("web-1", "node1", "", nil)},
+			node: newTestPlacementNode("node2", nil),
+			others: []*v1.Pod{
+				newTestPlacementPod("db-0", "node2", "", nil),
+				newTestPlacementPod("db-1", "node2", "", nil),
+			},
+			reasons: []string{"node node2 has 2 of max 3 pods"},
+		},
+	}
+	for _, test := range tests {
+		nodes := &v1.NodeList{Items: []v1.Node{
+			*newTestPlacementNode("node1", zoneLabels("node1", "a")),
+			*newTestPlacementNode("node3", zoneLabels("node3", "a")),
+			*newTestPlacementNode("node4", zoneLabels("node4", "b")),
+		}}
+		allPods := &v1.PodList{}
+		for _, pod := range append(append([]*v1.Pod{}, test.pods...), test.others...) {
+			allPods.Items = append(allPods.Items, *pod)
+		}
+		reasons := getPodsPlacementReasons(test.pods, test.node, nodes, allPods)
+		if len(reasons) != len(test.reasons) {
+			t.Errorf("%s: reasons %q, want %q", test.name, reasons, test.reasons)
+			continue
+		}
+		for i, reason := range reasons {
+			if strings.Contains(reason, test.reasons[i]) == false {
+				t.Errorf("%s: reason %q, want %q", test.name, reason, test.reasons[i])
+			}
+		}
+	}
+}
+
+func TestGetPodRequests(t *testing.T) {
+	pod := newTestPlacementPod("web-0", "node1", "500m", nil)
+	pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: "sidecar", Resources: v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("1Gi")}}})
+	pod.Spec.InitContainers = []v1.Container{{Name: "init", Resources: v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("512Mi")}}}}
+
+	// the init container requests more cpu than the containers together but
+	// less memory
+	requests := getPodRequests(pod)
+	cpu, memory := requests[v1.ResourceCPU], requests[v1.ResourceMemory]
+	if cpu.String() != "1" || memory.String() != "1Gi" {
+		t.Errorf("requests cpu %s memory %s, want 1 and 1Gi", cpu.String(), memory.String())
+	}
+}
+
+func TestCheckMovePlacementMode(t *testing.T) {
+	for _, mode := range []string{movePlacementBlock, movePlacementWarn, movePlacementIgnore} {
+		if err := checkMovePlacementMode(mode); err != nil {
+			t.Errorf("%s: err %v", mode, err)
+		}
+	}
+	if err := checkMovePlacementMode("strict"); err == nil {
+		t.Errorf("strict: no err")
+	}
+	if mode := (&MoveOperation{}).placement(); mode != movePlacementBlock {
+		t.Errorf("placement of an old move is %s, want %s", mode, movePlacementBlock)
+	}
+}
@@ -0,0 +1,175 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// With pre-sync the quota paths are copied by rsync while the pods using them
+// are still running, the from pod mounts the disk read only. The passes are
+// repeated until one transfers less than the max delta, then the pods are
+// deleted and the final rsync only copies what is changed since the last pass.
+// rsync must be installed in the move image. Like the copy, a pass is stopped
+// only when nothing is moved for the stall timeout of the move.
+
+const (
+	syncTransferredPrefix = "sync transferred "
+	syncDirPrefix         = "sync dir "
+)
+
+func getSyncScript(serverip string, fromDirs []string, tuning MoveTuning) string {
+	cmd := "sum=0; "
+	for i, fromDir := range fromDirs {
+		fromDir = path.Clean(fromDir)
+		tmp := path.Join(path.Base(path.Dir(fromDir)), path.Base(fromDir))
+		// the progress of every dir starts at 0, so it is printed after the dir
+		cmd += fmt.Sprintf("echo \"%s%d\"; ", syncDirPrefix, i)
+		cmd += fmt.Sprintf("%srsync %s --info=progress2 %s:/fromdir/%s /todir-%d/ | tr '\\r' '\\n' | tee /tmp/sync.out; rc=${PIPESTATUS[0]}; ",
+			tuning.ioNicePrefix(), tuning.rsyncOptions(), serverip, tmp, i)
+		// exit code 24 is files vanished during the copy, which is expected
+		// when the pods are running.
+		cmd += "if [ $rc -ne 0 ] && [ $rc -ne 24 ]; then echo \"rsync fail\"; exit 1; fi; "
+		cmd += "n=$(grep 'Total transferred file size' /tmp/sync.out | tr -dc 0-9); (( sum = sum + n )); "
+		cmd += fmt.Sprintf("echo \"Has moved %d/%d dirs, $sum bytes transferred\"; ", i+1, len(fromDirs))
+	}
+	return cmd + "echo \"" + syncTransferredPrefix + "$sum\""
+}
+
+func CreateTmpPodSync(clientset *kubernetes.Clientset, nodeName, podName, serverip string, fromDirs, toDirs []string, image string, memlimit int, alwayspullmoveimage bool, tuning MoveTuning) (error, *v1.Pod) {
+	return createTmpPod(clientset, newTmpPodSync(nodeName, podName, serverip, fromDirs, toDirs, image, memlimit, alwayspullmoveimage, tuning))
+}
+
+// newTmpPodSync returns a move pod which copies by rsync instead of scp.
+func newTmpPodSync(nodeName, podName, serverip string, fromDirs, toDirs []string, image string, memlimit int, alwayspullmoveimage bool, tuning MoveTuning) *v1.Pod {
+	pod := newTmpPodMove(nodeName, podName, serverip, fromDirs, toDirs, image, memlimit, alwayspullmoveimage)
+	pod.Spec.Containers[0].Args = []string{"-c", getSyncScript(serverip, fromDirs, tuning)}
+	return pod
+}
+
+// getSyncPodTransferred returns the bytes transferred by the quit sync pod.
+func getSyncPodTransferred(clientset *kubernetes.Clientset, pod *v1.Pod) (int64, error) {
+	req := clientset.Core().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: pod.Spec.Containers[0].Name})
+	reader, err := req.Stream()
+	if err != nil {
+		return 0, fmt.Errorf("get pod %s log err:%v", pod.Name, err)
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, syncTransferredPrefix) {
+			return strconv.ParseInt(strings.TrimPrefix(line, syncTransferredPrefix), 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read pod %s log err:%v", pod.Name, err)
+	}
+	return 0, fmt.Errorf("pod %s has not reported the transferred size", pod.Name)
+}
+
+// newSyncProgressParser returns a parser of the rsync --info=progress2 lines
+// of a sync pod, the bytes are of all dirs. A line read again when the log is
+// followed again does not count twice.
+func newSyncProgressParser() func(line []byte) (int64, int64, bool) {
+	dir := 0
+	dirBytes := make(map[int]int64)
+	return func(line []byte) (int64, int64, bool) {
+		str := string(line)
+		if strings.HasPrefix(str, syncDirPrefix) {
+			if i, err := strconv.Atoi(strings.TrimPrefix(str, syncDirPrefix)); err == nil {
+				dir = i
+			}
+			return 0, 0, false
+		}
+		// e.g. "  1,234,567  12%  1.23MB/s  0:00:10 (xfr#3, to-chk=10/100)"
+		fields := strings.Fields(str)
+		if len(fields) < 2 || strings.HasSuffix(fields[1], "%") == false {
+			return 0, 0, false
+		}
+		bytes, err := strconv.ParseInt(strings.Replace(fields[0], ",", "", -1), 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		if bytes > dirBytes[dir] {
+			dirBytes[dir] = bytes
+		}
+		var sum int64
+		for _, b := range dirBytes {
+			sum += b
+		}
+		return sum, 0, true
+	}
+}
+
+// preSyncMove runs rsync passes of op while the pods are running and sends the
+// progress of every pass to strChan, stateLen is the length of the last one
+// sent. The tmp pods are deleted when it returns.
+func preSyncMove(clientset *kubernetes.Clientset, op *MoveOperation, strChan chan<- string, stateLen *int) error {
+	defer deleteMoveTmpPods(clientset, op)
+	podFrom, err := createMoveFromPod(clientset, op)
+	if err != nil {
+		return err
+	}
+	pods, err := WaitPodRunning(clientset, op.FromNode, []*v1.Pod{podFrom})
+	if err != nil || len(pods) != 1 {
+		return fmt.Errorf("wait from pod [%s] to running err:%v", op.FromPodName, err)
+	}
+	serverip := pods[0].Status.PodIP
+	maxDelta := int64(op.PreSyncMaxDelta) * 1024 * 1024
+	for pass := 1; ; pass++ {
+		err, podSync := createTmpPod(clientset, newMoveToPod(op, serverip, true, 0))
+		if err != nil {
+			return fmt.Errorf("create pod sync err:%v", err)
+		}
+		progress := newMoveProgress(0)
+		progress.label = fmt.Sprintf("pass %d/%d", pass, op.PreSyncMaxPasses)
+		stop := make(chan struct{}, 0)
+		followMovePodProgress(clientset, podSync, progress, op.progressParser(true), stop)
+		err = waitMoveProgress(progress, op.stallTimeout(), func() (bool, error) {
+			return isMovePodQuit(clientset, podSync)
+		}, strChan, stateLen)
+		close(stop)
+		var transferred int64
+		if op.isNativeMover() {
+			result, moverErr := getMoverResult(clientset, podSync)
+			if err != nil && moverErr != nil {
+				err = fmt.Errorf("%v, %v", err, moverErr)
+			} else if err == nil {
+				err = moverErr
+			}
+			transferred = result.Transferred
+		} else if err == nil {
+			transferred, err = getSyncPodTransferred(clientset, podSync)
+		}
+		if err != nil {
+			return fmt.Errorf("wait sync pod:%s err:%v", op.ToPodName, err)
+		}
+		str := fmt.Sprintf("[ pass %d/%d transferred %s ]", pass, op.PreSyncMaxPasses, strings.Trim(convertIntToString(transferred), " "))
+		strChan <- str
+		*stateLen = len(str)
+		if transferred <= maxDelta || pass >= op.PreSyncMaxPasses {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,47 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestSyncProgressParser(t *testing.T) {
+	parse := newSyncProgressParser()
+	tests := []struct {
+		line  string
+		bytes int64
+		ok    bool
+	}{
+		{line: "sync dir 0", ok: false},
+		{line: "         32,768   0%    0.00kB/s    0:00:00 (xfr#1, to-chk=9/10)", bytes: 32768, ok: true},
+		{line: "      1,048,576  50%    1.00MB/s    0:00:01 (xfr#2, to-chk=8/10)", bytes: 1048576, ok: true},
+		{line: "Has moved 1/2 dirs, 1048576 bytes transferred", ok: false},
+		{line: "Total transferred file size: 1,048,576 bytes", ok: false},
+		// the next dir starts at 0 again
+		{line: "sync dir 1", ok: false},
+		{line: "          4,096   1%    0.00kB/s    0:00:00 (xfr#1, to-chk=1/2)", bytes: 1048576 + 4096, ok: true},
+		// a line of the first dir read again does not count twice
+		{line: "sync dir 0", ok: false},
+		{line: "         32,768   0%    0.00kB/s    0:00:00 (xfr#1, to-chk=9/10)", bytes: 1048576 + 4096, ok: true},
+	}
+	for _, test := range tests {
+		bytes, _, ok := parse([]byte(test.line))
+		if ok != test.ok || (ok && bytes != test.bytes) {
+			t.Errorf("%q: got %d %v, want %d %v", test.line, bytes, ok, test.bytes, test.ok)
+		}
+	}
+}
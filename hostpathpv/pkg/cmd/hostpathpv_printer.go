@@ -0,0 +1,377 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	QuotaKindPod  = "Pod"
+	QuotaKindNode = "Node"
+	QuotaKindPV   = "PersistentVolume"
+
+	QuotaKindAnomaly = "Anomaly"
+)
+
+// QuotaList is the machine readable result of get and describe.
+// Items are *PodQuota, *NodeQuota, *PVQuota or *Anomaly.
+type QuotaList struct {
+	Kind  string        `json:"kind"`
+	Items []interface{} `json:"items"`
+}
+
+func NewQuotaList() *QuotaList {
+	return &QuotaList{Kind: "List", Items: make([]interface{}, 0)}
+}
+
+type PodQuota struct {
+	Kind          string      `json:"kind"`
+	Namespace     string      `json:"namespace"`
+	Name          string      `json:"name"`
+	Status        string      `json:"status"`
+	HostPathPVNum int         `json:"hostPathPVNum"`
+	Quota         int64       `json:"quota"`
+	Used          int64       `json:"used"`
+	Keep          int64       `json:"keep"`
+	None          int64       `json:"none"`
+	Share         int64       `json:"share"`
+	PodIP         string      `json:"podIP"`
+	HostIP        string      `json:"hostIP"`
+	NodeName      string      `json:"nodeName"`
+	Paths         []PathQuota `json:"paths,omitempty"`
+}
+
+type NodeQuota struct {
+	Kind           string      `json:"kind"`
+	Name           string      `json:"name"`
+	Status         string      `json:"status"`
+	DiskNum        int         `json:"diskNum"`
+	DiskDisableNum int         `json:"diskDisableNum"`
+	PathNum        int         `json:"pathNum"`
+	Capacity       int64       `json:"capacity"`
+	Quota          int64       `json:"quota"`
+	Used           int64       `json:"used"`
+	Keep           int64       `json:"keep"`
+	None           int64       `json:"none"`
+	Share          int64       `json:"share"`
+	Disks          []DiskQuota `json:"disks,omitempty"`
+}
+
+type DiskQuota struct {
+	Path     string      `json:"path"`
+	Disabled bool        `json:"disabled"`
+	PathNum  int         `json:"pathNum"`
+	Capacity int64       `json:"capacity"`
+	Quota    int64       `json:"quota"`
+	Used     int64       `json:"used"`
+	Keep     int64       `json:"keep"`
+	None     int64       `json:"none"`
+	Share    int64       `json:"share"`
+	Paths    []PathQuota `json:"paths,omitempty"`
+}
+
+type PVQuota struct {
+	Kind       string        `json:"kind"`
+	Name       string        `json:"name"`
+	Status     string        `json:"status"`
+	Type       string        `json:"type"`
+	NodeNum    int           `json:"nodeNum"`
+	PathNum    int           `json:"pathNum"`
+	Capacity   int64         `json:"capacity"`
+	Quota      int64         `json:"quota"`
+	Used       int64         `json:"used"`
+	MountNodes []string      `json:"mountNodes"`
+	Mounts     []PVNodeQuota `json:"mounts,omitempty"`
+}
+
+type PVNodeQuota struct {
+	NodeName string      `json:"nodeName"`
+	Paths    []PathQuota `json:"paths"`
+}
+
+// PathQuota is one quota path row as shown by describe.
+type PathQuota struct {
+	PV        string `json:"pv,omitempty"`
+	Type      string `json:"type,omitempty"`
+	NodeName  string `json:"nodeName,omitempty"`
+	HostPath  string `json:"hostPath"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	PodPath   string `json:"podPath,omitempty"`
+	Quota     int64  `json:"quota"`
+	Used      int64  `json:"used"`
+	FileNum   int64  `json:"fileNum"`
+}
+
+// ResultPrinter renders a QuotaList.
+type ResultPrinter interface {
+	PrintResult(list *QuotaList, out io.Writer) error
+}
+
+func AddOutputFlag(cmd *cobra.Command, formats string) {
+	cmd.Flags().StringP("output", "o", "", "Output format. One of: "+formats)
+}
+
+// NewResultPrinter returns the printer for -o. An empty format means the human readable
+// table, which the caller may print on its own.
+func NewResultPrinter(format string) (ResultPrinter, error) {
+	name, arg := format, ""
+	if i := strings.Index(format, "="); i >= 0 {
+		name, arg = format[:i], format[i+1:]
+	}
+	switch name {
+	case "":
+		return &TablePrinter{}, nil
+	case "wide":
+		return &TablePrinter{Wide: true}, nil
+	case "json":
+		return &JSONPrinter{}, nil
+	case "yaml":
+		return &YAMLPrinter{}, nil
+	case "jsonpath":
+		if arg == "" {
+			return nil, fmt.Errorf("jsonpath template format specified but no template given")
+		}
+		// missing keys print nothing as in kubectl
+		p := NewJSONPath("output").AllowMissingKeys(true)
+		if err := p.Parse(arg); err != nil {
+			return nil, fmt.Errorf("error parsing jsonpath %s, %v", arg, err)
+		}
+		return &JSONPathPrinter{path: p}, nil
+	case "custom-columns":
+		if arg == "" {
+			return nil, fmt.Errorf("custom-columns format specified but no custom columns given")
+		}
+		return NewCustomColumnsPrinter(arg)
+	}
+	return nil, fmt.Errorf("output format %q not supported, allowed formats are: json, yaml, wide, jsonpath=..., custom-columns=...", format)
+}
+
+type JSONPrinter struct{}
+
+func (p *JSONPrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	buf, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", buf)
+	return err
+}
+
+type YAMLPrinter struct{}
+
+func (p *YAMLPrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	buf, err := yaml.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(buf)
+	return err
+}
+
+type JSONPathPrinter struct {
+	path *JSONPath
+}
+
+func (p *JSONPathPrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	return p.path.Execute(out, list)
+}
+
+type customColumn struct {
+	header string
+	path   *JSONPath
+}
+
+// CustomColumnsPrinter prints one line per list item, e.g. NAME:.name,QUOTA:.quota
+type CustomColumnsPrinter struct {
+	columns []customColumn
+}
+
+func NewCustomColumnsPrinter(spec string) (*CustomColumnsPrinter, error) {
+	p := &CustomColumnsPrinter{}
+	for _, part := range strings.Split(spec, ",") {
+		strs := strings.SplitN(part, ":", 2)
+		if len(strs) != 2 || strs[0] == "" || strs[1] == "" {
+			return nil, fmt.Errorf("unexpected custom-columns spec: %s, expected <header>:<json-path-expr>", part)
+		}
+		expr := strs[1]
+		if !strings.HasPrefix(expr, "{") {
+			expr = "{" + expr + "}"
+		}
+		// a missing value is shown as <none>
+		path := NewJSONPath(strs[0]).AllowMissingKeys(true)
+		if err := path.Parse(expr); err != nil {
+			return nil, err
+		}
+		p.columns = append(p.columns, customColumn{header: strs[0], path: path})
+	}
+	return p, nil
+}
+
+func (p *CustomColumnsPrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	titles := make([]string, 0, len(p.columns))
+	for _, c := range p.columns {
+		titles = append(titles, c.header)
+	}
+	displayer := NewDisplayer("   ", "", titles...)
+	for _, item := range list.Items {
+		line := make([]string, 0, len(p.columns))
+		for _, c := range p.columns {
+			results, err := c.path.FindResults(item)
+			if err != nil {
+				return err
+			}
+			strs := make([]string, 0, len(results))
+			for _, r := range results {
+				strs = append(strs, jsonValueString(r))
+			}
+			if len(strs) == 0 {
+				strs = append(strs, "<none>")
+			}
+			line = append(line, strings.Join(strs, ","))
+		}
+		displayer.AddLine(line...)
+	}
+	displayer.Fprint(out, false)
+	return nil
+}
+
+// TablePrinter prints the get tables, grouped by kind, with the summary line of each table.
+type TablePrinter struct {
+	Wide bool
+}
+
+func (p *TablePrinter) PrintResult(list *QuotaList, out io.Writer) error {
+	var pods []*PodQuota
+	var nodes []*NodeQuota
+	var pvs []*PVQuota
+	for _, item := range list.Items {
+		switch t := item.(type) {
+		case *PodQuota:
+			pods = append(pods, t)
+		case *NodeQuota:
+			nodes = append(nodes, t)
+		case *PVQuota:
+			pvs = append(pvs, t)
+		}
+	}
+	if len(pods) > 0 {
+		p.printPods(pods, out)
+	}
+	if len(nodes) > 0 {
+		p.printNodes(nodes, out)
+	}
+	if len(pvs) > 0 {
+		p.printPVs(pvs, out)
+	}
+	return nil
+}
+
+func (p *TablePrinter) printPods(pods []*PodQuota, out io.Writer) {
+	titles := []string{"Name", "Status", "HostPathPVNum", "Quota", "Used", "Keep", "None", "Share", "IP", "Node"}
+	if p.Wide {
+		titles = append(titles, "NodeName")
+	}
+	displayer := NewDisplayer("  ", "", titles...)
+	var sumQuota, sumUsed, sumKeep, sumNone, sumShare int64
+	for _, pod := range pods {
+		line := []string{pod.Namespace + "/" + pod.Name, pod.Status, strconv.Itoa(pod.HostPathPVNum), convertIntToString(pod.Quota),
+			convertIntToString(pod.Used), convertIntToString(pod.Keep), convertIntToString(pod.None), convertIntToString(pod.Share), pod.PodIP, pod.HostIP}
+		if p.Wide {
+			line = append(line, pod.NodeName)
+		}
+		displayer.AddLine(line...)
+		sumQuota += pod.Quota
+		sumUsed += pod.Used
+		sumKeep += pod.Keep
+		sumNone += pod.None
+		sumShare += pod.Share
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "AllQuota: %s, AllUsed: %s, AllKeep: %s, AllNone: %s, AllShare: %s\n\n",
+		convertIntToString(sumQuota), convertIntToString(sumUsed), convertIntToString(sumKeep),
+		convertIntToString(sumNone), convertIntToString(sumShare))
+}
+
+func (p *TablePrinter) printNodes(nodes []*NodeQuota, out io.Writer) {
+	titles := []string{"Name", "Status", "DiskNum", "Capacity", "Quota", "Used", "Keep", "None", "Share"}
+	if p.Wide {
+		titles = append(titles, "PathNum", "Free")
+	}
+	displayer := NewDisplayer("   ", "", titles...)
+	var allCapacity, allQuota, allUsed, allKeep, allNone, allShare int64
+	for _, node := range nodes {
+		line := []string{node.Name, node.Status, fmt.Sprintf("(%d/%d)", node.DiskNum-node.DiskDisableNum, node.DiskNum),
+			convertIntToString(node.Capacity),
+			convertIntToString(node.Quota) + getPercentStr(node.Quota, node.Capacity),
+			convertIntToString(node.Used) + getPercentStr(node.Used, node.Capacity),
+			convertIntToString(node.Keep) + getPercentStr(node.Keep, node.Capacity),
+			convertIntToString(node.None) + getPercentStr(node.None, node.Capacity),
+			convertIntToString(node.Share) + getPercentStr(node.Share, node.Capacity)}
+		if p.Wide {
+			line = append(line, strconv.Itoa(node.PathNum), convertIntToString(node.Capacity-node.Quota))
+		}
+		displayer.AddLine(line...)
+		allCapacity += node.Capacity
+		allQuota += node.Quota
+		allUsed += node.Used
+		allKeep += node.Keep
+		allNone += node.None
+		allShare += node.Share
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "AllCapacity: %s, AllQuota: %s, AllUsed: %s, AllKeep: %s, AllNone: %s, AllShare: %s\n\n",
+		convertIntToString(allCapacity), convertIntToString(allQuota)+getPercentStr(allQuota, allCapacity),
+		convertIntToString(allUsed)+getPercentStr(allUsed, allCapacity),
+		convertIntToString(allKeep)+getPercentStr(allKeep, allCapacity),
+		convertIntToString(allNone)+getPercentStr(allNone, allCapacity),
+		convertIntToString(allShare)+getPercentStr(allShare, allCapacity))
+}
+
+func (p *TablePrinter) printPVs(pvs []*PVQuota, out io.Writer) {
+	titles := []string{"Name", "Status", "NodeNum", "PathNum", "Capacity", "Type", "Quota", "Used"}
+	if p.Wide {
+		titles = append(titles, "MountNodes")
+	}
+	displayer := NewDisplayer("   ", "", titles...)
+	var sumQuota, sumUsed int64
+	var sumPaths, sumPVs int
+	for _, pv := range pvs {
+		line := []string{pv.Name, pv.Status, strconv.Itoa(pv.NodeNum), strconv.Itoa(pv.PathNum),
+			convertIntToString(pv.Capacity), pv.Type, convertIntToString(pv.Quota), convertIntToString(pv.Used)}
+		if p.Wide {
+			line = append(line, strings.Join(pv.MountNodes, ","))
+		}
+		displayer.AddLine(line...)
+		if pv.NodeNum > 0 {
+			sumPVs++
+		}
+		sumPaths += pv.PathNum
+		sumQuota += pv.Quota
+		sumUsed += pv.Used
+	}
+	displayer.Fprint(out, true)
+	fmt.Fprintf(out, "NumPVs: %d, NumPaths: %d, AllUsed: %s, AllQuota: %s\n\n",
+		sumPVs, sumPaths, convertIntToString(sumUsed), convertIntToString(sumQuota))
+}
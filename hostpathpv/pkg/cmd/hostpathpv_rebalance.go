@@ -0,0 +1,346 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+)
+
+var (
+	rebalance_long = templates.LongDesc(`
+		Plan moves of keep quota paths from the nodes with the highest quota (or used)
+		percentage to the ones with the lowest, so the percentages of the nodes get close.
+
+		The percentage of a node is its quota (or used) size of all disks divided by its
+		capacity like get node shows. The keep quota paths of a pod are moved together.
+		Every move goes from the node with the highest percentage to the one with the
+		lowest where it fits and makes both closer, the quota paths go to the not disabled
+		disk with the most free quota, which evens the disks of the node too. Planning
+		stops when the spread of the percentages is at most --tolerance, --maxmove MB would
+		be transferred or no move helps any more.
+
+		Only ready and scheduleable nodes of --selector are in the plan. Pods of
+		--exclude-namespaces are not moved. The plan is printed with the estimated transfer
+		size, the used size of the quota paths, nothing is changed. --filename saves it to
+		a plan file which move -f runs.`)
+
+	rebalance_example = templates.Examples(`
+		# Show a plan which evens the quota percentage of all nodes.
+		kubectl hostpathpv rebalance
+
+		# Even the used percentage of the nodes with label disk=xfs, moving at most 500GB.
+		kubectl hostpathpv rebalance --by=used --selector=disk=xfs --maxmove=512000
+
+		# Save the plan to plan.yaml without moving pods of kube-system.
+		kubectl hostpathpv rebalance --exclude-namespaces=kube-system -f plan.yaml
+		`)
+)
+
+const (
+	rebalanceByQuota = "quota"
+	rebalanceByUsed  = "used"
+)
+
+// rebalanceNode is a node of the rebalance plan, size is its quota or used
+// size after the moves planned so far.
+type rebalanceNode struct {
+	name     string
+	capacity int64
+	size     int64
+	before   int64
+	units    []*rebalanceUnit
+}
+
+func (node *rebalanceNode) percent(size int64) float64 {
+	return float64(size) / float64(node.capacity) * 100.0
+}
+
+// rebalanceUnit is a move of the keep quota paths of a pod, weight is the
+// size it takes from the percentage of its node and used its transfer size.
+type rebalanceUnit struct {
+	move   *plannedMove
+	weight int64
+	used   int64
+	moved  bool
+}
+
+func NewCmdHostPathPVRebalance(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rebalance [flags]",
+		Short:   T("Plan moves of keep quota paths which even the quota of the nodes"),
+		Long:    rebalance_long,
+		Example: rebalance_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunRebalance(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunRebalance err:%v\n", err)
+			}
+		},
+	}
+	cmd.Flags().String("by", rebalanceByQuota, "Percentage to even, one of: quota|used")
+	cmd.Flags().Int("maxmove", 0, "Max MB transferred by all moves of the plan, 0 is no limit")
+	cmd.Flags().Int("tolerance", 5, "Stop when the highest and the lowest percentage of the nodes differ at most this")
+	cmd.Flags().StringSlice("exclude-namespaces", []string{}, "Namespaces whose pods are not moved")
+	cmd.Flags().StringP("selector", "l", "", "Label selector of the nodes to rebalance")
+	cmd.Flags().StringP("filename", "f", "", "File to save the plan to, - means stdout")
+	return cmd
+}
+
+func RunRebalance(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	by := GetFlagString(cmd, "by")
+	if by != rebalanceByQuota && by != rebalanceByUsed {
+		return UsageErrorf(cmd, "--by should be one of: quota|used")
+	}
+	maxMove := int64(GetFlagInt(cmd, "maxmove")) * 1024 * 1024
+	if maxMove < 0 {
+		return UsageErrorf(cmd, "--maxmove should be >= 0")
+	}
+	tolerance := GetFlagInt(cmd, "tolerance")
+	if tolerance < 0 || tolerance > 100 {
+		return UsageErrorf(cmd, "--tolerance should be in 0-100")
+	}
+	excludeNamespaces, err := cmd.Flags().GetStringSlice("exclude-namespaces")
+	if err != nil {
+		return err
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+	filename := GetFlagString(cmd, "filename")
+	planOut := out
+	if filename == "-" {
+		planOut = errOut
+	}
+	moves, err := planRebalance(clientset, by, GetFlagString(cmd, "selector"), FilterEmptyStr(excludeNamespaces),
+		maxMove, float64(tolerance), planOut)
+	if err != nil {
+		return err
+	}
+	if filename != "" && len(moves) > 0 {
+		return writeMovePlanFile(moves, filename, out)
+	}
+	return nil
+}
+
+func planRebalance(clientset *kubernetes.Clientset, by, selector string, excludeNamespaces []string, maxMove int64,
+	tolerance float64, out io.Writer) ([]*plannedMove, error) {
+	nodeList, err := clientset.Core().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes err:%v", err)
+	}
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pvs err:%v", err)
+	}
+	allPods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pods err:%v", err)
+	}
+
+	targets, err := getMoveTargets(nodeList, pvs, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*rebalanceNode, 0, len(targets))
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if _, exist := targets[node.Name]; exist == false {
+			continue
+		}
+		info := getNodeQuotaInfos(node, pvs)
+		if info.diskCapacity <= 0 {
+			continue
+		}
+		rnode := &rebalanceNode{name: node.Name, capacity: info.diskCapacity, size: info.allQuota}
+		if by == rebalanceByUsed {
+			rnode.size = info.diskUsed
+		}
+		rnode.before = rnode.size
+		rnode.units, err = getRebalanceUnits(allPods, pvs, node.Name, by, excludeNamespaces)
+		if err != nil {
+			fmt.Fprintf(out, "Quota paths of node %s are not moved: %v\n", node.Name, err)
+		}
+		nodes = append(nodes, rnode)
+	}
+	if len(nodes) < 2 {
+		return nil, fmt.Errorf("rebalance needs 2 ready and scheduleable nodes with quota disks at least, found %d", len(nodes))
+	}
+
+	moves, moved, err := planRebalanceMoves(nodes, targets, maxMove, tolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Rebalance by %s:\n", by)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	displayer := NewDisplayer("  ", "", "Node", "Capacity", "Before", "After")
+	minBefore, maxBefore, minAfter, maxAfter := 100.0, 0.0, 100.0, 0.0
+	for _, node := range nodes {
+		before, after := node.percent(node.before), node.percent(node.size)
+		displayer.AddLine(node.name, strings.Trim(convertIntToString(node.capacity), " "),
+			strings.Trim(convertIntToString(node.before), " ")+getPercentStr(node.before, node.capacity),
+			strings.Trim(convertIntToString(node.size), " ")+getPercentStr(node.size, node.capacity))
+		if before < minBefore {
+			minBefore = before
+		}
+		if before > maxBefore {
+			maxBefore = before
+		}
+		if after < minAfter {
+			minAfter = after
+		}
+		if after > maxAfter {
+			maxAfter = after
+		}
+	}
+	displayer.Fprint(out, true)
+	if len(moves) == 0 {
+		fmt.Fprintf(out, "\nNo move is needed, spread: %.2f%%\n", maxBefore-minBefore)
+		return moves, nil
+	}
+	fmt.Fprintf(out, "\n")
+	printMovePlan(moves, out)
+	var quota int64
+	for _, move := range moves {
+		quota += move.quota()
+	}
+	fmt.Fprintf(out, "Moves: %d, Quota: %s, Estimated transfer: %s, Spread: %.2f%% -> %.2f%%\n", len(moves),
+		strings.Trim(convertIntToString(quota), " "), strings.Trim(convertIntToString(moved), " "),
+		maxBefore-minBefore, maxAfter-minAfter)
+	return moves, nil
+}
+
+// planRebalanceMoves plans moves between nodes until their percentages differ
+// at most tolerance, it returns the moves and their transfer size.
+func planRebalanceMoves(nodes []*rebalanceNode, targets map[string][]*moveDisk, maxMove int64, tolerance float64) ([]*plannedMove, int64, error) {
+	moves := make([]*plannedMove, 0)
+	var moved int64
+	for {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].percent(nodes[i].size) > nodes[j].percent(nodes[j].size) })
+		spread := nodes[0].percent(nodes[0].size) - nodes[len(nodes)-1].percent(nodes[len(nodes)-1].size)
+		if spread <= tolerance {
+			break
+		}
+		unit, to := pickRebalanceUnit(nodes, targets, maxMove-moved, maxMove > 0)
+		if unit == nil {
+			break
+		}
+		if err := placeMove(unit.move, map[string][]*moveDisk{to.name: targets[to.name]}); err != nil {
+			return nil, 0, err
+		}
+		for i, dir := range unit.move.fromDirs {
+			for _, disk := range targets[unit.move.fromNode] {
+				if disk.path == path.Dir(dir) {
+					disk.free += unit.move.quotas[i]
+				}
+			}
+		}
+		for _, node := range nodes {
+			if node.name == unit.move.fromNode {
+				node.size -= unit.weight
+			}
+		}
+		to.size += unit.weight
+		unit.moved = true
+		moved += unit.used
+		moves = append(moves, unit.move)
+	}
+	return moves, moved, nil
+}
+
+// getRebalanceUnits returns the moves of the keep quota paths of nodeName but
+// the ones of pods of excludeNamespaces.
+func getRebalanceUnits(allPods *v1.PodList, pvs *v1.PersistentVolumeList, nodeName, by string, excludeNamespaces []string) ([]*rebalanceUnit, error) {
+	moves, err := groupMovePaths(getNodeKeepQuotaPaths(pvs, nodeName, ""), allPods, pvs, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]*rebalanceUnit, 0, len(moves))
+moveLoop:
+	for _, move := range moves {
+		for _, pod := range move.pods {
+			if stringsContain(excludeNamespaces, strings.SplitN(pod, "/", 2)[0]) {
+				continue moveLoop
+			}
+		}
+		unit := &rebalanceUnit{move: move, weight: move.quota()}
+		for _, dir := range move.fromDirs {
+			unit.used += GetQuotaPathUsedSize(pvs, nodeName, dir)
+		}
+		if by == rebalanceByUsed {
+			unit.weight = unit.used
+		}
+		if unit.weight > 0 {
+			units = append(units, unit)
+		}
+	}
+	return units, nil
+}
+
+// pickRebalanceUnit returns the unit and the to node of the next move. Nodes
+// are sorted by percentage, the highest node which has a unit that fits on a
+// lower node and leaves both below its percentage is the from node, of its
+// units the one which makes the two percentages closest is picked. A move
+// never makes the two percentages further apart.
+func pickRebalanceUnit(nodes []*rebalanceNode, targets map[string][]*moveDisk, left int64, limited bool) (*rebalanceUnit, *rebalanceNode) {
+	for i, from := range nodes {
+		fromPercent := from.percent(from.size)
+		for j := len(nodes) - 1; j > i; j-- {
+			to := nodes[j]
+			if to.percent(to.size) >= fromPercent {
+				break
+			}
+			var best *rebalanceUnit
+			var bestDiff float64
+			for _, unit := range from.units {
+				if unit.moved || (limited && unit.used > left) {
+					continue
+				}
+				fromAfter, toAfter := from.percent(from.size-unit.weight), to.percent(to.size+unit.weight)
+				diff := fromAfter - toAfter
+				if diff < 0 {
+					diff = -diff
+				}
+				if toAfter >= fromPercent || diff >= fromPercent-to.percent(to.size) || (best != nil && diff >= bestDiff) {
+					continue
+				}
+				trial := make([]*moveDisk, 0, len(targets[to.name]))
+				for _, disk := range targets[to.name] {
+					trial = append(trial, &moveDisk{path: disk.path, free: disk.free})
+				}
+				if placeMove(unit.move, map[string][]*moveDisk{to.name: trial}) != nil {
+					continue
+				}
+				best, bestDiff = unit, diff
+			}
+			if best != nil {
+				return best, to
+			}
+		}
+	}
+	return nil, nil
+}
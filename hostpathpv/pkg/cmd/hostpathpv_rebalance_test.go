@@ -0,0 +1,261 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testRebalanceNode is a node of capacity 1000 with a unit of every weight,
+// the used size of a unit is its weight.
+type testRebalanceNode struct {
+	name  string
+	size  int64
+	units []int64
+	free  int64
+}
+
+func newTestRebalanceNodes(testNodes []testRebalanceNode) ([]*rebalanceNode, map[string][]*moveDisk) {
+	nodes := make([]*rebalanceNode, 0, len(testNodes))
+	targets := make(map[string][]*moveDisk)
+	for _, tn := range testNodes {
+		node := &rebalanceNode{name: tn.name, capacity: 1000, size: tn.size, before: tn.size}
+		for i, weight := range tn.units {
+			move := &plannedMove{
+				pods:     []string{fmt.Sprintf("default/%s-%d", tn.name, i)},
+				fromNode: tn.name,
+				fromDirs: []string{fmt.Sprintf("%s/%s-%d", testDiskPath(1), tn.name, i)},
+				quotas:   []int64{weight},
+			}
+			node.units = append(node.units, &rebalanceUnit{move: move, weight: weight, used: weight})
+		}
+		nodes = append(nodes, node)
+		targets[tn.name] = []*moveDisk{{path: testDiskPath(1), free: tn.free}}
+	}
+	return nodes, targets
+}
+
+func getRebalanceSpread(nodes []*rebalanceNode) float64 {
+	min, max := nodes[0].percent(nodes[0].size), nodes[0].percent(nodes[0].size)
+	for _, node := range nodes {
+		if p := node.percent(node.size); p < min {
+			min = p
+		} else if p > max {
+			max = p
+		}
+	}
+	return max - min
+}
+
+func TestPlanRebalanceMoves(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodes     []testRebalanceNode
+		maxMove   int64
+		tolerance float64
+		// moves are the pods of the planned moves and their to nodes
+		moves []string
+		moved int64
+	}{
+		{
+			name: "the unit which evens the nodes",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 300}},
+				{name: "node2", size: 200, free: 800},
+			},
+			moves: []string{"default/node1-1>node2"},
+			moved: 300,
+		},
+		{
+			name: "highest to lowest node",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 900, units: []int64{400}},
+				{name: "node2", size: 500, units: []int64{100}, free: 500},
+				{name: "node3", size: 100, free: 900},
+			},
+			tolerance: 5,
+			moves:     []string{"default/node1-0>node3"},
+			moved:     400,
+		},
+		{
+			name: "several moves until the tolerance",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 700, units: []int64{100, 100, 100, 100}},
+				{name: "node2", size: 100, free: 900},
+			},
+			tolerance: 10,
+			moves:     []string{"default/node1-0>node2", "default/node1-1>node2", "default/node1-2>node2"},
+			moved:     300,
+		},
+		{
+			name: "within the tolerance",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 550, units: []int64{50}},
+				{name: "node2", size: 500, free: 500},
+			},
+			tolerance: 10,
+			moves:     []string{},
+		},
+		{
+			name: "never widens the spread",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 600, units: []int64{500}},
+				{name: "node2", size: 400, free: 600},
+			},
+			moves: []string{},
+		},
+		{
+			name: "never moves past the lower node",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 600, units: []int64{250, 150}},
+				{name: "node2", size: 400, free: 600},
+			},
+			moves: []string{"default/node1-1>node2"},
+			moved: 150,
+		},
+		{
+			name: "maxmove skips the bigger unit",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 300}},
+				{name: "node2", size: 200, free: 800},
+			},
+			maxMove: 150,
+			moves:   []string{"default/node1-0>node2"},
+			moved:   100,
+		},
+		{
+			name: "maxmove allows no unit",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 300}},
+				{name: "node2", size: 200, free: 800},
+			},
+			maxMove: 50,
+			moves:   []string{},
+		},
+		{
+			name: "a unit must fit on a disk of the to node",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 300}},
+				{name: "node2", size: 200, free: 150},
+			},
+			moves: []string{"default/node1-0>node2"},
+			moved: 100,
+		},
+	}
+	for _, test := range tests {
+		nodes, targets := newTestRebalanceNodes(test.nodes)
+		spreadBefore := getRebalanceSpread(nodes)
+		moves, moved, err := planRebalanceMoves(nodes, targets, test.maxMove, test.tolerance)
+		if err != nil {
+			t.Errorf("%s: err %v", test.name, err)
+			continue
+		}
+		got := make([]string, 0, len(moves))
+		for _, move := range moves {
+			got = append(got, fmt.Sprintf("%s>%s", move.podsStr(), move.toNode))
+		}
+		if reflect.DeepEqual(got, test.moves) == false || moved != test.moved {
+			t.Errorf("%s: moves %v of %d, want %v of %d", test.name, got, moved, test.moves, test.moved)
+		}
+		if test.maxMove > 0 && moved > test.maxMove {
+			t.Errorf("%s: moved %d, more than maxmove %d", test.name, moved, test.maxMove)
+		}
+		if spread := getRebalanceSpread(nodes); spread > spreadBefore {
+			t.Errorf("%s: spread widens from %.2f to %.2f", test.name, spreadBefore, spread)
+		}
+		for name, disks := range targets {
+			if disks[0].free < 0 {
+				t.Errorf("%s: disk of %s has free quota %d", test.name, name, disks[0].free)
+			}
+		}
+	}
+}
+
+func TestPickRebalanceUnit(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []testRebalanceNode
+		left    int64
+		limited bool
+		// unit is the pod of the picked unit and its to node
+		unit string
+	}{
+		{
+			name: "closest percentages",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 250, 300}},
+				{name: "node2", size: 200, free: 800},
+			},
+			unit: "default/node1-2>node2",
+		},
+		{
+			name: "the to node is not above the from node",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 500, units: []int64{50}},
+				{name: "node2", size: 500, free: 500},
+			},
+		},
+		{
+			name: "a higher lower node if the lowest does not fit",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 900, units: []int64{200}},
+				{name: "node2", size: 500, free: 500},
+				{name: "node3", size: 100, free: 100},
+			},
+			unit: "default/node1-0>node2",
+		},
+		{
+			name: "a lower from node if the highest can not move",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 900, units: []int64{900}},
+				{name: "node2", size: 500, units: []int64{200}, free: 500},
+				{name: "node3", size: 100, free: 900},
+			},
+			unit: "default/node2-0>node3",
+		},
+		{
+			name: "the left transfer size",
+			nodes: []testRebalanceNode{
+				{name: "node1", size: 800, units: []int64{100, 300}},
+				{name: "node2", size: 200, free: 800},
+			},
+			left:    200,
+			limited: true,
+			unit:    "default/node1-0>node2",
+		},
+	}
+	for _, test := range tests {
+		nodes, targets := newTestRebalanceNodes(test.nodes)
+		unit, to := pickRebalanceUnit(nodes, targets, test.left, test.limited)
+		got := ""
+		if unit != nil {
+			got = fmt.Sprintf("%s>%s", unit.move.podsStr(), to.name)
+		}
+		if got != test.unit {
+			t.Errorf("%s: picked %q, want %q", test.name, got, test.unit)
+		}
+		// picking is a trial, it takes no free quota
+		for name, disks := range targets {
+			for _, tn := range test.nodes {
+				if tn.name == name && disks[0].free != tn.free {
+					t.Errorf("%s: free quota of %s is %d, want %d", test.name, name, disks[0].free, tn.free)
+				}
+			}
+		}
+	}
+}
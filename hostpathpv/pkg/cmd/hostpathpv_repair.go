@@ -0,0 +1,419 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+)
+
+var (
+	repair_long = templates.LongDesc(`
+		Repair hostpath pv annotations inconsistencies found by check.
+
+		The following anomalies are repaired:
+		  * UnknownNode: the quota paths of a node which does not exist are removed.
+		  * UnknownDisk: a quota path which is not under any quota disk is removed.
+		  * DuplicatePath: a path recorded by more than one pv is kept only by the pv
+		    whose pod is still running, it is skipped when no or more than one such pv is found.
+		  * MalformedCapacity: the capacity annotation is removed so the pv capacity is used.
+
+		The quota paths on a node whose quota disk annotation is missing or malformed
+		(MissingDiskInfo, MalformedDiskInfo) are never removed, the node is reported instead.
+
+		All the rewrites are shown as a diff and applied only after confirmation.`)
+
+	repair_example = templates.Examples(`
+		# Repair all hostpath pvs.
+		kubectl hostpathpv repair
+
+		# Repair the given pvs only.
+		kubectl hostpathpv repair pvname1 pvname2
+
+		# Repair without confirmation.
+		kubectl hostpathpv repair --force=true
+		`)
+)
+
+// pvRepair is the annotations rewrite planned for one pv.
+type pvRepair struct {
+	pv             *v1.PersistentVolume
+	reasons        []string
+	removes        []mountPathRemove
+	dropCapacity   bool
+	oldAnnotations map[string]string
+	newAnnotations map[string]string
+}
+
+type mountPathRemove struct {
+	// nodeName is matched exactly, empty is an item without node name.
+	nodeName string
+	hostPath string // empty means all the quota paths of the node
+	reason   string
+}
+
+func NewCmdHostPathPVRepair(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "repair [PVNAME ...] [flags]",
+		Short:   T("Repair hostpath pv annotations inconsistencies"),
+		Long:    repair_long,
+		Example: repair_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunRepair(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunRepair err:%v\n", err)
+			}
+		},
+	}
+	cmd.Flags().Bool("force", false, "Repair force with no confirmation")
+	return cmd
+}
+
+func RunRepair(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	force := GetFlagBool(cmd, "force")
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+
+	pvs, err := clientset.Core().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pvs err:%v", err)
+	}
+	nodes, err := clientset.Core().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes err:%v", err)
+	}
+	pods, err := clientset.Core().Pods(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods err:%v", err)
+	}
+
+	repairs, skipped := planRepairs(pvs, nodes, pods, args)
+	for _, anomaly := range skipped {
+		fmt.Fprintf(errOut, "skip %s %s/%s %s:%s: %s\n", anomaly.Type, anomaly.ObjectKind,
+			anomaly.ObjectName, anomaly.NodeName, anomaly.Path, anomaly.Message)
+	}
+	if len(repairs) == 0 {
+		fmt.Fprintf(out, "no annotation to repair\n")
+		return nil
+	}
+	printRepairs(repairs, out)
+	if isDryRun(cmd) {
+		return nil
+	}
+	if force != true {
+		fmt.Printf("Are you sure to apply above repairs (y/n):")
+		var ok string
+		fmt.Scanf("%s", &ok)
+		if ok != "y" {
+			return nil
+		}
+	}
+
+	failNum := 0
+	for _, repair := range repairs {
+		if _, err := mutatePV(clientset, repair.pv.Name, repair.apply); err != nil {
+			fmt.Fprintf(errOut, "repair pv %s err:%v\n", repair.pv.Name, err)
+			failNum++
+			continue
+		}
+		fmt.Fprintf(out, "pv %s repair ok\n", repair.pv.Name)
+	}
+	if failNum > 0 {
+		return fmt.Errorf("%d of %d pvs repair fail", failNum, len(repairs))
+	}
+	return nil
+}
+
+// planRepairs turns the repairable anomalies into pv annotations rewrites,
+// the anomalies which can not be repaired automatically are returned as skipped.
+func planRepairs(pvs *v1.PersistentVolumeList, nodes *v1.NodeList, pods *v1.PodList,
+	pvNames []string) (repairs []*pvRepair, skipped []Anomaly) {
+	podUIDs := make(map[string]*v1.Pod)
+	for i := range pods.Items {
+		podUIDs[string(pods.Items[i].UID)] = &pods.Items[i]
+	}
+	pvMap := make(map[string]*v1.PersistentVolume)
+	// holders records which pvs record a node:path and whether their pod is running.
+	holders := make(map[string]map[string]bool)
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		pvMap[pv.Name] = pv
+		if pv.Annotations == nil || pv.Annotations[xfs.PVVolumeHostPathMountNode] == "" {
+			continue
+		}
+		mountList := xfshostpath.HostPathPVMountInfoList{}
+		if err := json.Unmarshal([]byte(pv.Annotations[xfs.PVVolumeHostPathMountNode]), &mountList); err != nil {
+			continue
+		}
+		for _, item := range mountList {
+			for _, mountInfo := range item.MountInfos {
+				id := item.NodeName + ":" + path.Clean(mountInfo.HostPath)
+				if holders[id] == nil {
+					holders[id] = make(map[string]bool)
+				}
+				holders[id][pv.Name] = holders[id][pv.Name] || isMountPodRunning(mountInfo, podUIDs)
+			}
+		}
+	}
+
+	wanted := func(pvName string) bool {
+		if len(pvNames) == 0 {
+			return true
+		}
+		for _, name := range pvNames {
+			if name == pvName {
+				return true
+			}
+		}
+		return false
+	}
+	removes := make(map[string][]mountPathRemove)
+	dropCapacity := make(map[string]string)
+	duplicateDone := make(map[string]bool)
+	for _, anomaly := range checkAnnotations(pvs, nodes, pods) {
+		switch anomaly.Type {
+		case AnomalyUnknownNode:
+			if wanted(anomaly.ObjectName) {
+				reason := fmt.Sprintf("remove all quota paths of unknown node %s", anomaly.NodeName)
+				if anomaly.NodeName == "" {
+					reason = "remove the mount info item without node name"
+				}
+				removes[anomaly.ObjectName] = append(removes[anomaly.ObjectName], mountPathRemove{
+					nodeName: anomaly.NodeName,
+					reason:   reason,
+				})
+			}
+		case AnomalyUnknownDisk:
+			if wanted(anomaly.ObjectName) {
+				removes[anomaly.ObjectName] = append(removes[anomaly.ObjectName], mountPathRemove{
+					nodeName: anomaly.NodeName,
+					hostPath: anomaly.Path,
+					reason:   fmt.Sprintf("remove %s:%s which is not under any quota disk", anomaly.NodeName, anomaly.Path),
+				})
+			}
+		case AnomalyDuplicatePath:
+			id := anomaly.NodeName + ":" + path.Clean(anomaly.Path)
+			if duplicateDone[id] {
+				continue
+			}
+			duplicateDone[id] = true
+			keeper, runningNum := "", 0
+			for pvName, running := range holders[id] {
+				if running {
+					keeper = pvName
+					runningNum++
+				}
+			}
+			if runningNum != 1 {
+				anomaly.Message = fmt.Sprintf("%d pvs have running pods on the path, fix it by delete pv --node --path", runningNum)
+				skipped = append(skipped, anomaly)
+				continue
+			}
+			for pvName := range holders[id] {
+				if pvName != keeper && wanted(pvName) {
+					removes[pvName] = append(removes[pvName], mountPathRemove{
+						nodeName: anomaly.NodeName,
+						hostPath: anomaly.Path,
+						reason:   fmt.Sprintf("remove %s:%s which is used by pv %s", anomaly.NodeName, anomaly.Path, keeper),
+					})
+				}
+			}
+		case AnomalyMalformedCapacity:
+			if wanted(anomaly.ObjectName) {
+				dropCapacity[anomaly.ObjectName] = fmt.Sprintf("remove malformed annotation %s=%q",
+					xfs.PVHostPathCapacityAnn, pvMap[anomaly.ObjectName].Annotations[xfs.PVHostPathCapacityAnn])
+			}
+		case AnomalyMalformedMountInfo:
+			if wanted(anomaly.ObjectName) {
+				skipped = append(skipped, anomaly)
+			}
+		case AnomalyMissingDiskInfo, AnomalyMalformedDiskInfo:
+			skipped = append(skipped, anomaly)
+		}
+	}
+
+	names := make([]string, 0, len(removes)+len(dropCapacity))
+	for name := range removes {
+		names = append(names, name)
+	}
+	for name := range dropCapacity {
+		if _, exist := removes[name]; exist == false {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pv := pvMap[name]
+		repair := &pvRepair{
+			pv:             pv,
+			removes:        removes[name],
+			oldAnnotations: pv.Annotations,
+		}
+		if reason, exist := dropCapacity[name]; exist {
+			repair.dropCapacity = true
+			repair.reasons = append(repair.reasons, reason)
+		}
+		for _, remove := range removes[name] {
+			repair.reasons = append(repair.reasons, remove.reason)
+		}
+		newPV := pv.DeepCopy()
+		if _, err := repair.apply(newPV); err != nil {
+			continue
+		}
+		repair.newAnnotations = newPV.Annotations
+		repairs = append(repairs, repair)
+	}
+	return
+}
+
+// apply applies the repair to pv, it is used both to preview the repair and to
+// re-apply it to the freshly read pv when updating.
+func (repair *pvRepair) apply(pv *v1.PersistentVolume) (bool, error) {
+	changed := false
+	if _, exist := pv.Annotations[xfs.PVHostPathCapacityAnn]; exist && repair.dropCapacity {
+		delete(pv.Annotations, xfs.PVHostPathCapacityAnn)
+		changed = true
+	}
+	if len(repair.removes) == 0 {
+		return changed, nil
+	}
+	mountChanged, err := mutateMountList(pv, func(list xfshostpath.HostPathPVMountInfoList) (xfshostpath.HostPathPVMountInfoList, bool, error) {
+		removed := false
+		for _, remove := range repair.removes {
+			var n int
+			list, n = removeMountPaths(list, remove.nodeName, remove.hostPath)
+			removed = removed || n > 0
+		}
+		return list, removed, nil
+	})
+	return changed || mountChanged, err
+}
+
+// removeMountPaths removes hostPath, or all the quota paths if it is empty, of
+// the items of exactly nodeName. Unlike getDeleteInfo an empty nodeName is not
+// every node but the malformed items without a node name.
+func removeMountPaths(list xfshostpath.HostPathPVMountInfoList, nodeName, hostPath string) (xfshostpath.HostPathPVMountInfoList, int) {
+	newList := make(xfshostpath.HostPathPVMountInfoList, 0, len(list))
+	removed := 0
+	for _, item := range list {
+		if item.NodeName != nodeName {
+			newList = append(newList, item)
+			continue
+		}
+		if hostPath == "" {
+			// the item is removed even without quota paths
+			removed++
+			continue
+		}
+		kept := make(xfshostpath.MountInfoList, 0, len(item.MountInfos))
+		for _, mountInfo := range item.MountInfos {
+			if path.Clean(mountInfo.HostPath) == path.Clean(hostPath) {
+				removed++
+				continue
+			}
+			kept = append(kept, mountInfo)
+		}
+		if len(kept) > 0 {
+			item.MountInfos = kept
+			newList = append(newList, item)
+		}
+	}
+	return newList, removed
+}
+
+func isMountPodRunning(mountInfo xfshostpath.MountInfo, podUIDs map[string]*v1.Pod) bool {
+	if mountInfo.PodInfo == nil || mountInfo.PodInfo.Info == "" {
+		return false
+	}
+	ns, name, uid := getPodInfo(mountInfo.PodInfo.Info)
+	pod, exist := podUIDs[uid]
+	return exist && pod.Namespace == ns && pod.Name == name && pod.DeletionTimestamp == nil
+}
+
+func printRepairs(repairs []*pvRepair, out io.Writer) {
+	for _, repair := range repairs {
+		fmt.Fprintf(out, "pv %s:\n", repair.pv.Name)
+		for _, reason := range repair.reasons {
+			fmt.Fprintf(out, "  * %s\n", reason)
+		}
+		for _, line := range diffAnnotations(repair.oldAnnotations, repair.newAnnotations) {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+}
+
+// diffAnnotations diffs the changed annotations, the mount info annotation is split
+// so that every quota path is one line.
+func diffAnnotations(oldAnn, newAnn map[string]string) []string {
+	keys := make([]string, 0, len(oldAnn)+len(newAnn))
+	for k := range oldAnn {
+		keys = append(keys, k)
+	}
+	for k := range newAnn {
+		if _, exist := oldAnn[k]; exist == false {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	ret := make([]string, 0)
+	for _, k := range keys {
+		oldValue, oldExist := oldAnn[k]
+		newValue, newExist := newAnn[k]
+		if oldExist == newExist && oldValue == newValue {
+			continue
+		}
+		var oldLines, newLines []string
+		if oldExist {
+			oldLines = annotationLines(k, oldValue)
+		}
+		if newExist {
+			newLines = annotationLines(k, newValue)
+		}
+		ret = append(ret, diffLines(oldLines, newLines)...)
+	}
+	return ret
+}
+
+func annotationLines(key, value string) []string {
+	if key == xfs.PVVolumeHostPathMountNode {
+		mountList := xfshostpath.HostPathPVMountInfoList{}
+		if err := json.Unmarshal([]byte(value), &mountList); err == nil {
+			ret := []string{key + ":"}
+			for _, item := range mountList {
+				for _, mountInfo := range item.MountInfos {
+					buf, _ := json.Marshal(mountInfo)
+					ret = append(ret, "    "+item.NodeName+": "+string(buf))
+				}
+			}
+			return ret
+		}
+	}
+	return strings.Split(key+": "+value, "\n")
+}
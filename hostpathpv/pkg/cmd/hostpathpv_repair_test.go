@@ -0,0 +1,89 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	xfshostpath "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath"
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	"k8s.io/api/core/v1"
+)
+
+func TestRemoveMountPaths(t *testing.T) {
+	list := xfshostpath.HostPathPVMountInfoList{
+		{NodeName: "node1", MountInfos: xfshostpath.MountInfoList{{HostPath: "/xfs/disk1/a"}, {HostPath: "/xfs/disk2/b"}}},
+		{NodeName: "", MountInfos: xfshostpath.MountInfoList{{HostPath: "/xfs/disk1/c"}}},
+		{NodeName: "node2", MountInfos: xfshostpath.MountInfoList{{HostPath: "/xfs/disk1/d"}}},
+	}
+	tests := []struct {
+		name     string
+		nodeName string
+		hostPath string
+		nodes    []string
+		removed  int
+	}{
+		{name: "empty node name removes only its item", nodeName: "", nodes: []string{"node1", "node2"}, removed: 1},
+		{name: "all paths of a node", nodeName: "node2", nodes: []string{"node1", ""}, removed: 1},
+		{name: "one path", nodeName: "node1", hostPath: "/xfs/disk2/b/", nodes: []string{"node1", "", "node2"}, removed: 1},
+		{name: "unknown path", nodeName: "node1", hostPath: "/xfs/disk3/x", nodes: []string{"node1", "", "node2"}, removed: 0},
+	}
+	for _, test := range tests {
+		got, removed := removeMountPaths(list, test.nodeName, test.hostPath)
+		nodes := make([]string, 0, len(got))
+		for _, item := range got {
+			nodes = append(nodes, item.NodeName)
+		}
+		if removed != test.removed || reflect.DeepEqual(nodes, test.nodes) == false {
+			t.Errorf("%s: got nodes %v removed %d, want %v removed %d", test.name, nodes, removed, test.nodes, test.removed)
+		}
+	}
+	if len(list[0].MountInfos) != 2 {
+		t.Errorf("the list is changed in place")
+	}
+}
+
+func TestPlanRepairs(t *testing.T) {
+	pvs, nodes := newTestCheckCluster(t)
+	repairs, skipped := planRepairs(pvs, nodes, &v1.PodList{}, nil)
+	got := make([]string, 0)
+	for _, repair := range repairs {
+		for _, reason := range repair.reasons {
+			got = append(got, repair.pv.Name+": "+reason)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"pv1: remove node1:/xfs/disk3/b which is not under any quota disk",
+		"pv5: remove all quota paths of unknown node node9",
+		"pv6: remove malformed annotation " + xfs.PVHostPathCapacityAnn + `="1x"`,
+	}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("got repairs %v, want %v", got, want)
+	}
+	// the paths on the nodes without disk info are kept
+	skippedTypes := make([]string, 0, len(skipped))
+	for _, anomaly := range skipped {
+		skippedTypes = append(skippedTypes, anomaly.Type+" "+anomaly.ObjectName)
+	}
+	sort.Strings(skippedTypes)
+	wantSkipped := []string{"DuplicatePath pv2", "MalformedDiskInfo node3", "MalformedMountInfo pv6", "MissingDiskInfo node2"}
+	if reflect.DeepEqual(skippedTypes, wantSkipped) == false {
+		t.Errorf("got skipped %v, want %v", skippedTypes, wantSkipped)
+	}
+}
@@ -0,0 +1,300 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubectl/util/templates"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	restore_long = templates.LongDesc(`
+		Restore the hostpath annotations of pvs and nodes from a backup file.
+
+		Only the given objects are restored when TYPE or TYPE/NAME is specified, TYPE is
+		pv or node. The annotations rewrite of every object is shown as a diff and applied
+		only after confirmation. An object which is changed after the diff is shown is
+		skipped and reported, restore it again to see the new diff. With --force the
+		restored annotations are applied to the object read again, so that the annotations
+		the csi plugin changes meanwhile are kept.
+
+		The node disk quota info and status annotations are the live state of the disks
+		kept by the csi plugin, they are only restored with --diskstate.`)
+
+	restore_example = templates.Examples(`
+		# Restore all hostpath annotations from state.yaml.
+		kubectl hostpathpv restore -f state.yaml
+
+		# Restore the annotations of all pvs and of node1.
+		kubectl hostpathpv restore -f state.yaml pv node/node1
+
+		# Restore without confirmation.
+		kubectl hostpathpv restore -f state.yaml --force=true
+		`)
+)
+
+// annotationRestore is the annotations rewrite of one object read at preview time,
+// its resourceVersion is the one the rewrite is applied to.
+type annotationRestore struct {
+	kind          string
+	name          string
+	backupVersion string
+	// keys are the restored annotations, backup their values in the backup.
+	keys           []string
+	backup         map[string]string
+	pv             *v1.PersistentVolume
+	node           *v1.Node
+	oldAnnotations map[string]string
+	newAnnotations map[string]string
+	// changedVersion is the resourceVersion of the object if it is skipped as
+	// changed since the preview.
+	changedVersion string
+}
+
+func NewCmdHostPathPVRestore(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore -f FILENAME [TYPE[/NAME] ...] [flags]",
+		Short:   T("Restore hostpath annotations of pvs and nodes from a backup"),
+		Long:    restore_long,
+		Example: restore_example,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunRestore(f, out, errOut, cmd, args)
+			if err != nil {
+				fmt.Fprintf(out, "run RunRestore err:%v\n", err)
+			}
+		},
+	}
+	cmd.Flags().StringP("filename", "f", "", "Backup file to restore from")
+	cmd.Flags().Bool("force", false, "Restore force with no confirmation, also the objects which are changed since the diff is shown")
+	cmd.Flags().Bool("diskstate", false, "Also restore the node disk quota info and status annotations, which describe the live disks")
+	return cmd
+}
+
+func RunRestore(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+	filename := GetFlagString(cmd, "filename")
+	if filename == "" {
+		return UsageErrorf(cmd, "Required --filename")
+	}
+	force := GetFlagBool(cmd, "force")
+	for _, arg := range args {
+		kind := strings.SplitN(arg, "/", 2)[0]
+		if kind != "pv" && kind != "node" {
+			return UsageErrorf(cmd, "%s is not supported, only pv and node can be restored", arg)
+		}
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	backup := HostPathBackup{}
+	if err := yaml.Unmarshal(buf, &backup); err != nil {
+		return fmt.Errorf("parse %s err:%v", filename, err)
+	}
+	if backup.Kind != HostPathBackupKind {
+		return fmt.Errorf("%s is not a hostpath backup file", filename)
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
+
+	nodeKeys := restoreNodeAnnotations
+	if GetFlagBool(cmd, "diskstate") {
+		nodeKeys = backupNodeAnnotations
+	}
+	restores := make([]*annotationRestore, 0)
+	for _, item := range backup.PVs {
+		if restoreSelected(args, "pv", item.Name) == false {
+			continue
+		}
+		pv, err := clientset.Core().PersistentVolumes().Get(item.Name, metav1.GetOptions{})
+		if err != nil {
+			fmt.Fprintf(errOut, "skip pv %s: %v\n", item.Name, err)
+			continue
+		}
+		if restore := newAnnotationRestore("pv", item, pv.Annotations, backupPVAnnotations); restore != nil {
+			restore.pv = pv
+			restores = append(restores, restore)
+		}
+	}
+	for _, item := range backup.Nodes {
+		if restoreSelected(args, "node", item.Name) == false {
+			continue
+		}
+		node, err := clientset.Core().Nodes().Get(item.Name, metav1.GetOptions{})
+		if err != nil {
+			fmt.Fprintf(errOut, "skip node %s: %v\n", item.Name, err)
+			continue
+		}
+		if restore := newAnnotationRestore("node", item, node.Annotations, nodeKeys); restore != nil {
+			restore.node = node
+			restores = append(restores, restore)
+		}
+	}
+	if len(restores) == 0 {
+		fmt.Fprintf(out, "no annotation to restore\n")
+		return nil
+	}
+
+	for _, restore := range restores {
+		curVersion := restore.objectMeta().ResourceVersion
+		if curVersion != restore.backupVersion {
+			fmt.Fprintf(out, "%s %s (changed since backup, resourceVersion %s -> %s):\n",
+				restore.kind, restore.name, restore.backupVersion, curVersion)
+		} else {
+			fmt.Fprintf(out, "%s %s:\n", restore.kind, restore.name)
+		}
+		for _, line := range diffAnnotations(restore.oldAnnotations, restore.newAnnotations) {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	if isDryRun(cmd) {
+		return nil
+	}
+	if force != true {
+		fmt.Printf("Are you sure to restore above annotations (y/n):")
+		var ok string
+		fmt.Scanf("%s", &ok)
+		if ok != "y" {
+			return nil
+		}
+	}
+
+	failNum, skipNum := 0, 0
+	for _, restore := range restores {
+		skipped, err := restore.apply(clientset, force)
+		if err != nil {
+			fmt.Fprintf(errOut, "restore %s %s err:%v\n", restore.kind, restore.name, err)
+			failNum++
+		} else if skipped {
+			fmt.Fprintf(errOut, "skip %s %s: changed since the diff is shown, resourceVersion %s -> %s, restore it again or with --force\n",
+				restore.kind, restore.name, restore.objectMeta().ResourceVersion, restore.changedVersion)
+			skipNum++
+		} else {
+			fmt.Fprintf(out, "%s %s restore ok\n", restore.kind, restore.name)
+		}
+	}
+	if failNum > 0 || skipNum > 0 {
+		return fmt.Errorf("%d of %d objects restore fail, %d skipped", failNum, len(restores), skipNum)
+	}
+	return nil
+}
+
+func restoreSelected(args []string, kind, name string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	for _, arg := range args {
+		if arg == kind || arg == kind+"/"+name {
+			return true
+		}
+	}
+	return false
+}
+
+// newAnnotationRestore returns nil if the tracked annotations are the same as the backup.
+func newAnnotationRestore(kind string, item AnnotationBackup, cur map[string]string, keys []string) *annotationRestore {
+	newAnnotations := make(map[string]string)
+	for k, v := range cur {
+		newAnnotations[k] = v
+	}
+	if restoreAnnotations(newAnnotations, item.Annotations, keys) == false {
+		return nil
+	}
+	return &annotationRestore{
+		kind:           kind,
+		name:           item.Name,
+		backupVersion:  item.ResourceVersion,
+		keys:           keys,
+		backup:         item.Annotations,
+		oldAnnotations: cur,
+		newAnnotations: newAnnotations,
+	}
+}
+
+// restoreAnnotations sets keys of annotations to their values in backup, a key
+// which is not in backup is deleted. It returns whether annotations is changed.
+func restoreAnnotations(annotations, backup map[string]string, keys []string) bool {
+	changed := false
+	for _, key := range keys {
+		curValue, curExist := annotations[key]
+		backupValue, backupExist := backup[key]
+		if curExist == backupExist && curValue == backupValue {
+			continue
+		}
+		changed = true
+		if backupExist {
+			annotations[key] = backupValue
+		} else {
+			delete(annotations, key)
+		}
+	}
+	return changed
+}
+
+func (restore *annotationRestore) objectMeta() *metav1.ObjectMeta {
+	if restore.pv != nil {
+		return &restore.pv.ObjectMeta
+	}
+	return &restore.node.ObjectMeta
+}
+
+// apply restores the annotations of the current object, the other annotations
+// are kept as they are now. The object is updated with the resourceVersion it
+// is read with, so an object changed since the preview is skipped unless force
+// is set, even if it is changed between the read and the update.
+func (restore *annotationRestore) apply(clientset *kubernetes.Clientset, force bool) (bool, error) {
+	var skipped bool
+	mutate := func(meta *metav1.ObjectMeta) bool {
+		var changed bool
+		changed, skipped = restore.applyTo(meta, force)
+		return changed
+	}
+	var err error
+	if restore.pv != nil {
+		_, err = mutatePV(clientset, restore.name, func(pv *v1.PersistentVolume) (bool, error) {
+			return mutate(&pv.ObjectMeta), nil
+		})
+	} else {
+		_, err = mutateNode(clientset, restore.name, func(node *v1.Node) (bool, error) {
+			return mutate(&node.ObjectMeta), nil
+		})
+	}
+	return skipped, err
+}
+
+// applyTo restores the annotations of meta, the current object, and returns
+// whether they are changed. Unless force is set meta is skipped if its
+// resourceVersion is not the one of the preview.
+func (restore *annotationRestore) applyTo(meta *metav1.ObjectMeta, force bool) (changed, skipped bool) {
+	if force == false && meta.ResourceVersion != restore.objectMeta().ResourceVersion {
+		restore.changedVersion = meta.ResourceVersion
+		return false, true
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	return restoreAnnotations(meta.Annotations, restore.backup, restore.keys), false
+}
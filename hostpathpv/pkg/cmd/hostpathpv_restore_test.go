@@ -0,0 +1,112 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	xfs "github.com/Rhealb/csi-plugin/hostpathpv/pkg/hostpath/xfsquotamanager/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewAnnotationRestore(t *testing.T) {
+	item := AnnotationBackup{Name: "pv1", ResourceVersion: "10", Annotations: map[string]string{
+		xfs.PVHostPathMountPolicyAnn: xfs.PVHostPathKeep,
+		xfs.PVHostPathCapacityAnn:    "100",
+	}}
+	tests := []struct {
+		name string
+		cur  map[string]string
+		// want is nil if nothing is restored
+		want map[string]string
+	}{
+		{
+			name: "same as the backup",
+			cur:  map[string]string{xfs.PVHostPathMountPolicyAnn: xfs.PVHostPathKeep, xfs.PVHostPathCapacityAnn: "100", "other": "a"},
+		},
+		{
+			name: "changed and added annotations, the untracked ones are kept",
+			cur: map[string]string{xfs.PVHostPathMountPolicyAnn: xfs.PVHostPathNone, xfs.PVHostPathQuotaForOnePod: "true",
+				"other": "a"},
+			want: map[string]string{xfs.PVHostPathMountPolicyAnn: xfs.PVHostPathKeep, xfs.PVHostPathCapacityAnn: "100",
+				"other": "a"},
+		},
+		{
+			name: "no annotations",
+			want: map[string]string{xfs.PVHostPathMountPolicyAnn: xfs.PVHostPathKeep, xfs.PVHostPathCapacityAnn: "100"},
+		},
+	}
+	for _, test := range tests {
+		restore := newAnnotationRestore("pv", item, test.cur, backupPVAnnotations)
+		if test.want == nil {
+			if restore != nil {
+				t.Errorf("%s: restores %v", test.name, restore.newAnnotations)
+			}
+			continue
+		}
+		if restore == nil {
+			t.Errorf("%s: nothing is restored", test.name)
+			continue
+		}
+		if reflect.DeepEqual(restore.newAnnotations, test.want) == false {
+			t.Errorf("%s: restores %v, want %v", test.name, restore.newAnnotations, test.want)
+		}
+		if reflect.DeepEqual(restore.oldAnnotations, test.cur) == false {
+			t.Errorf("%s: the current annotations are changed to %v", test.name, restore.oldAnnotations)
+		}
+	}
+}
+
+func TestAnnotationRestoreApplyTo(t *testing.T) {
+	item := AnnotationBackup{Name: "pv1", ResourceVersion: "10", Annotations: map[string]string{xfs.PVHostPathCapacityAnn: "100"}}
+	tests := []struct {
+		name    string
+		version string
+		force   bool
+		changed bool
+		skipped bool
+	}{
+		{name: "not changed since the preview", version: "20", changed: true},
+		{name: "changed since the preview", version: "21", skipped: true},
+		{name: "changed since the preview with force", version: "21", force: true, changed: true},
+	}
+	for _, test := range tests {
+		pv := NewTmpHostPathPV("pv1")
+		pv.ResourceVersion = "20"
+		pv.Annotations = map[string]string{xfs.PVHostPathCapacityAnn: "200"}
+		restore := newAnnotationRestore("pv", item, pv.Annotations, backupPVAnnotations)
+		restore.pv = pv
+
+		// the csi plugin rewrites the usage meanwhile
+		cur := metav1.ObjectMeta{Name: "pv1", ResourceVersion: test.version,
+			Annotations: map[string]string{xfs.PVHostPathCapacityAnn: "200", "other": "a"}}
+		changed, skipped := restore.applyTo(&cur, test.force)
+		if changed != test.changed || skipped != test.skipped {
+			t.Errorf("%s: changed %t skipped %t, want %t %t", test.name, changed, skipped, test.changed, test.skipped)
+		}
+		want := map[string]string{xfs.PVHostPathCapacityAnn: "100", "other": "a"}
+		if skipped {
+			want[xfs.PVHostPathCapacityAnn] = "200"
+			if restore.changedVersion != test.version {
+				t.Errorf("%s: changed version %q, want %q", test.name, restore.changedVersion, test.version)
+			}
+		}
+		if reflect.DeepEqual(cur.Annotations, want) == false {
+			t.Errorf("%s: annotations %v, want %v", test.name, cur.Annotations, want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/Rhealb/extender-scheduler/pkg/algorithm"
 
 	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -56,14 +57,14 @@ var (
 		`)
 )
 
-func NewCmdHostPathPVScale(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVScale(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "scale (TYPE/NAME ...) [flags]",
 		Short:   T("Scale up, down or to pv's capacity"),
 		Long:    scale_long,
 		Example: scale_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunScale(client, out, errOut, cmd, args)
+			err := RunScale(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunScale err:%v\n", err)
 			}
@@ -72,7 +73,7 @@ func NewCmdHostPathPVScale(client *kubernetes.Clientset, out io.Writer, errOut i
 	return cmd
 }
 
-func RunScale(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunScale(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to disable. ", scale_valid_resources)
 		usageString := "Required resource not specified."
@@ -81,6 +82,10 @@ func RunScale(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra
 
 	resource := args[0]
 
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "pvs" || resource == "pv":
 		if len(args) == 4 {
@@ -94,7 +99,7 @@ func RunScale(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra
 			if err != nil {
 				return fmt.Errorf("size %s is not valid", sizeStr)
 			}
-			err = scalePV(clientset, pvName, op, int64(size)*1024*1024)
+			err = scalePV(clientset, pvName, op, int64(size)*1024*1024, isDryRun(cmd))
 			if err != nil {
 				fmt.Fprintf(errOut, "scale pv err: %v\n", err)
 			}
@@ -110,7 +115,7 @@ func RunScale(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra
 	return nil
 }
 
-func scalePV(clientset *kubernetes.Clientset, pvName, op string, size int64) error {
+func scalePV(clientset *kubernetes.Clientset, pvName, op string, size int64, dryRun bool) error {
 	pv, errGetPV := clientset.Core().PersistentVolumes().Get(pvName, metav1.GetOptions{})
 	if errGetPV != nil {
 		return fmt.Errorf("get pv err:%v", errGetPV)
@@ -136,8 +141,19 @@ func scalePV(clientset *kubernetes.Clientset, pvName, op string, size int64) err
 		}
 	}
 
+	oldPV := pv.DeepCopy()
 	algorithm.SetHostpathPVCapacity(pv, toSize)
-	_, err := clientset.Core().PersistentVolumes().Update(pv)
+	if dryRun {
+		plan := NewDryRunPlan()
+		plan.addLine("scale pv %s capacity to %s", pvName, strings.Trim(convertIntToString(toSize), " "))
+		plan.UpdatePV(oldPV, pv)
+		plan.Print()
+		return nil
+	}
+	pv, err := mutatePV(clientset, pvName, func(curPV *v1.PersistentVolume) (bool, error) {
+		algorithm.SetHostpathPVCapacity(curPV, toSize)
+		return true, nil
+	})
 	if err != nil {
 		return fmt.Errorf("set pv %s capacity to %s err:%v", pvName, strings.Trim(convertIntToString(toSize), " "), err)
 	}
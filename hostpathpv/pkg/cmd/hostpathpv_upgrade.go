@@ -47,11 +47,26 @@ var (
 	upgrade_long = templates.LongDesc(`
 		Upgrade hostpath pv to CSI hostpathpv.
 
+		The pods using the pvs are deleted at the end so that they are recreated with the
+		CSI hostpath pv. With --scaledown their Deployment or ReplicaSet is scaled to 0
+		replicas instead, and their StatefulSet down to the lowest ordinal of the pods, if
+		the PodDisruptionBudgets allow stopping the pods, and scaled back after the pods
+		are gone, the upgrade waits until the pods are ready again.
+
+		The pods changing the quota path type run in kube-system by default, --podtemplate
+		and the --pod* flags are merged into them like for move.
+
 		` + upgrade_valid_resources)
 
 	upgrade_example = templates.Examples(`
 		# Upgrade quota path.
 		kubectl hostpathpv upgrade pv pvname
+
+		# Upgrade quota path and restart the pods by scaling their workloads down and up.
+		kubectl hostpathpv upgrade pv pvname --scaledown=true
+
+		# Upgrade quota path with the pods of the helper pod template podtemplate.yaml.
+		kubectl hostpathpv upgrade pv pvname --podtemplate=podtemplate.yaml
 		`)
 )
 
@@ -60,14 +75,14 @@ const (
 	csihostpathpv_plugin_name    = "xfshostpathplugin"
 )
 
-func NewCmdHostPathPVUpgrade(client *kubernetes.Clientset, out io.Writer, errOut io.Writer) *cobra.Command {
+func NewCmdHostPathPVUpgrade(f *ConfigFlags, out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "upgrade (TYPE/NAME ...) [flags]",
 		Short:   T("Upgrade hostpath pv"),
 		Long:    upgrade_long,
 		Example: upgrade_example,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunUpgrade(client, out, errOut, cmd, args)
+			err := RunUpgrade(f, out, errOut, cmd, args)
 			if err != nil {
 				fmt.Fprintf(out, "run RunUpgrade err:%v\n", err)
 			}
@@ -76,10 +91,12 @@ func NewCmdHostPathPVUpgrade(client *kubernetes.Clientset, out io.Writer, errOut
 	cmd.Flags().String("upgradeimage", default_upgrade_busyboximage, "Image create to change quota dir type")
 	cmd.Flags().Duration("deleteinterval", 10*time.Second, "Use quota pod deleting interval")
 	cmd.Flags().Bool("force", false, "Upgrade force")
+	addScaleDownFlags(cmd)
+	addHelperPodFlags(cmd)
 	return cmd
 }
 
-func RunUpgrade(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
+func RunUpgrade(f *ConfigFlags, out, errOut io.Writer, cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		fmt.Fprint(errOut, "You must specify the type of resource to get. ", upgrade_valid_resources)
 		usageString := "Required resource not specified."
@@ -90,6 +107,13 @@ func RunUpgrade(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cob
 	upgradeImage := GetFlagString(cmd, "upgradeimage")
 	delInterval := GetFlagDuration(cmd, "deleteinterval")
 	force := GetFlagBool(cmd, "force")
+	if err := setHelperPodTemplate(cmd); err != nil {
+		return UsageErrorf(cmd, "%v", err)
+	}
+	clientset, err := f.ClientSet()
+	if err != nil {
+		return err
+	}
 	switch {
 	case resource == "pv":
 		pvName := ""
@@ -97,7 +121,8 @@ func RunUpgrade(clientset *kubernetes.Clientset, out, errOut io.Writer, cmd *cob
 			pvName = args[1]
 		}
 		if pvName != "" {
-			err := upgradePV(clientset, upgradeImage, strings.Split(pvName, ","), force, delInterval)
+			err := upgradePV(clientset, upgradeImage, strings.Split(pvName, ","), force, delInterval,
+				GetFlagBool(cmd, "scaledown"), GetFlagInt(cmd, "readytimeout"), isDryRun(cmd))
 			if err != nil {
 				fmt.Fprintf(errOut, "\nupgrade pv %s err: %v\n", pvName, err)
 			}
@@ -125,7 +150,8 @@ func getPVsByNames(clientset *kubernetes.Clientset, pvNames []string) ([]*v1.Per
 	return ret, nil
 }
 
-func upgradePV(clientset *kubernetes.Clientset, upgradeImage string, pvNames []string, upgradeForce bool, delInterval time.Duration) error {
+func upgradePV(clientset *kubernetes.Clientset, upgradeImage string, pvNames []string, upgradeForce bool, delInterval time.Duration,
+	scaleDown bool, readyTimeout int, dryRun bool) error {
 	// init clean up work
 	//upgradeSuccess := false
 	cleanDeferFunList = make([]cleanDeferFun, 0, 10)
@@ -144,10 +170,22 @@ func upgradePV(clientset *kubernetes.Clientset, upgradeImage string, pvNames []s
 		return err
 	}
 	var needDeletePods []*v1.Pod
+	var workloads []WorkloadRef
 
 	if dps, deleteNames, err := GetPVsUsingPods(clientset, pvNames); err != nil {
 		return err
 	} else {
+		if scaleDown {
+			if workloads, dps, err = getPodsWorkloads(clientset, dps); err != nil {
+				return err
+			}
+			if err := checkWorkloadsPDB(clientset, workloads); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return printUpgradePVPlan(updatePVs, upgradeImage, dps, workloads)
+		}
 		if upgradeForce == false {
 			fmt.Printf("Are you sure to upgrade pv %v by delete pods %v (y/n):", pvNames, deleteNames)
 			var ans byte
@@ -246,15 +284,69 @@ func upgradePV(clientset *kubernetes.Clientset, upgradeImage string, pvNames []s
 
 	//************************************ step 7 ***********************************/
 	stepPrintf(statueChan, "(Step %d) Start delete using hostpath pv pods:", step)
+	if len(workloads) > 0 {
+		addCleanDeferFun(func() {
+			if err := restoreWorkloads(clientset, workloads); err != nil {
+				fmt.Printf("\nclean : %v\n", err)
+			}
+		})
+		if err := scaleDownWorkloads(clientset, workloads); err != nil {
+			return completeStep(err)
+		}
+	}
 	if errDelete := DeletePods(clientset, "", needDeletePods, delInterval); errDelete != nil {
 		return completeStep(errDelete)
 	}
 	completeStep(nil)
 
+	if len(workloads) > 0 {
+		//************************************ step 8 ***********************************/
+		stepPrintf(statueChan, "(Step %d) Start restore workloads %v and wait their pods ready, timeOut=%ds:", step, workloads, readyTimeout)
+		if err := waitWorkloadsScaledDown(clientset, workloads, readyTimeout); err != nil {
+			return completeStep(err)
+		}
+		if err := restoreWorkloads(clientset, workloads); err != nil {
+			return completeStep(err)
+		}
+		if err := waitWorkloadsReady(clientset, workloads, "", readyTimeout); err != nil {
+			return completeStep(err)
+		}
+		completeStep(nil)
+	}
+
 	fmt.Printf("\nUpgrade hostpath pv %v to csi hostpath pv success\n", pvNames)
 	return nil
 }
 
+func printUpgradePVPlan(updatePVs []*v1.PersistentVolume, upgradeImage string, needDeletePods []*v1.Pod, workloads []WorkloadRef) error {
+	plan := NewDryRunPlan()
+	for _, updatePV := range updatePVs {
+		nodeMountInfos, errInfo := GetPVQuotaPaths(updatePV)
+		if errInfo != nil {
+			return errInfo
+		}
+		for _, pod := range newChangeQuotaPathTypePods(updatePV.Name, upgradeImage, nodeMountInfos) {
+			plan.CreatePod(pod)
+		}
+	}
+	for _, updatePV := range updatePVs {
+		tmpPvName := fmt.Sprintf("%s-csihostpathpv-tmp", GetMd5Hash(updatePV.Name, 10))
+		plan.CreatePV(newCSIHostPathPV(tmpPvName, updatePV, false))
+	}
+	for _, updatePV := range updatePVs {
+		plan.DeletePV(updatePV.Name)
+		plan.CreatePV(newCSIHostPathPV(updatePV.Name, updatePV, true))
+	}
+	plan.ScaleWorkloads(workloads, true)
+	plan.DeletePods(needDeletePods)
+	plan.ScaleWorkloads(workloads, false)
+	for _, updatePV := range updatePVs {
+		plan.DeletePV(fmt.Sprintf("%s-csihostpathpv-tmp", GetMd5Hash(updatePV.Name, 10)))
+	}
+	plan.Print()
+	return nil
+}
+
 func GetMd5Hash(str string, l int) string {
 	has := md5.Sum([]byte(str))
 	md5str1 := fmt.Sprintf("%x", has) //将[]byte转成16进制
@@ -303,8 +395,19 @@ func DeletePv(clientset *kubernetes.Clientset, name string) error {
 		} else {
 			time.Sleep(100 * time.Microsecond)
 		}
-		curPv.Finalizers = nil
-		clientset.Core().PersistentVolumes().Update(curPv)
+		if len(curPv.Finalizers) == 0 {
+			continue
+		}
+		_, err = mutatePV(clientset, name, func(pv *v1.PersistentVolume) (bool, error) {
+			if len(pv.Finalizers) == 0 {
+				return false, nil
+			}
+			pv.Finalizers = nil
+			return true, nil
+		})
+		if err != nil && IsNotFound(err) == false {
+			return fmt.Errorf("remove pv finalizers err:%v", err)
+		}
 	}
 }
 
@@ -356,6 +459,20 @@ func GetPVsUsingPods(clientset *kubernetes.Clientset, pvNames []string) ([]*v1.P
 }
 
 func CreateCSIHostPathPV(clientset *kubernetes.Clientset, pvName string, updatePV *v1.PersistentVolume, copyLable bool) error {
+	pv := newCSIHostPathPV(pvName, updatePV, copyLable)
+	var lastErr error
+	for i := 1; i <= 5; i++ {
+		_, err := clientset.Core().PersistentVolumes().Create(pv)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		time.Sleep(100 * time.Microsecond)
+	}
+	return lastErr
+}
+
+func newCSIHostPathPV(pvName string, updatePV *v1.PersistentVolume, copyLable bool) *v1.PersistentVolume {
 	newAnns := make(map[string]string)
 	newLable := make(map[string]string)
 	if updatePV.Annotations != nil {
@@ -387,19 +504,23 @@ func CreateCSIHostPathPV(clientset *kubernetes.Clientset, pvName string, updateP
 			},
 		},
 	}
-	var lastErr error
-	for i := 1; i <= 5; i++ {
-		_, err := clientset.Core().PersistentVolumes().Create(pv)
-		if err == nil {
-			return nil
+	return pv
+}
+
+func CreatePodsToChangeQuotaPathType(clientset *kubernetes.Clientset, pvName, imageName string, nodeMountInfos map[string][]string) ([]*v1.Pod, error) {
+	pods := newChangeQuotaPathTypePods(pvName, imageName, nodeMountInfos)
+	ret := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		createPod, err := clientset.Core().Pods(pod.Namespace).Create(pod)
+		ret = append(ret, createPod)
+		if err != nil {
+			return ret, fmt.Errorf("create pod %s:%s err:%v", pod.Namespace, pod.Name, err)
 		}
-		lastErr = err
-		time.Sleep(100 * time.Microsecond)
 	}
-	return lastErr
+	return ret, nil
 }
 
-func CreatePodsToChangeQuotaPathType(clientset *kubernetes.Clientset, pvName, imageName string, nodeMountInfos map[string][]string) ([]*v1.Pod, error) {
+func newChangeQuotaPathTypePods(pvName, imageName string, nodeMountInfos map[string][]string) []*v1.Pod {
 	ret := make([]*v1.Pod, 0, len(nodeMountInfos))
 	timeout := int64(100)
 
@@ -430,7 +551,7 @@ func CreatePodsToChangeQuotaPathType(clientset *kubernetes.Clientset, pvName, im
 		pod := &v1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      fmt.Sprintf("change-%s-%s-quotapath-tmppod", nodeName, pvName),
-				Namespace: metav1.NamespaceSystem,
+				Namespace: helperPodNamespace(),
 			},
 			Spec: v1.PodSpec{
 				NodeName:              nodeName,
@@ -453,13 +574,9 @@ func CreatePodsToChangeQuotaPathType(clientset *kubernetes.Clientset, pvName, im
 				},
 			},
 		}
-		createPod, err := clientset.Core().Pods(metav1.NamespaceSystem).Create(pod)
-		ret = append(ret, createPod)
-		if err != nil {
-			return ret, fmt.Errorf("create pod %s:%s err:%v", pod.Namespace, pod.Name, err)
-		}
+		ret = append(ret, applyHelperPodTemplate(pod))
 	}
-	return ret, nil
+	return ret
 }
 
 func GetPVQuotaPaths(pv *v1.PersistentVolume) (map[string][]string, error) {
@@ -0,0 +1,331 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// After the copy a manifest pod is run on both nodes. It writes one line for
+// every directory and file under the moved quota paths to a file, a file line
+// has its size and md5 sum, and is ready when the manifest is complete. The
+// manifest is read back by exec, not from the pod log which is rotated. The two
+// manifests are compared with each other and with the usage recorded in the pv
+// annotation before the pv mount paths are changed.
+
+const (
+	manifestDone     = "manifest done"
+	manifestPath     = "/tmp/manifest"
+	manifestDoneFile = "/tmp/manifest.done"
+	// quota usage is counted in blocks, so the file bytes of a quota path may
+	// be less than its used size by up to one block of every file and dir.
+	manifestBlockSize = 4096
+	// at most so many differences are printed.
+	manifestMaxDiffs = 20
+)
+
+type manifestFile struct {
+	size int64
+	sum  string
+}
+
+// dirManifest is the content of one quota path, keyed by relative path.
+type dirManifest struct {
+	dirs  []string
+	files map[string]manifestFile
+}
+
+func (m *dirManifest) fileBytes() int64 {
+	var ret int64
+	for _, f := range m.files {
+		ret += f.size
+	}
+	return ret
+}
+
+func getMoveVerifyPodName(nodeName string, dirs []string) string {
+	return fmt.Sprintf("move-%s-tmp-pod-verify-%s", nodeName, getHashStr(dirs, 5))
+}
+
+// getMoveVerifyToDirs returns the paths fromDirs are copied to.
+func getMoveVerifyToDirs(fromDirs, toDirs []string) []string {
+	ret := make([]string, 0, len(fromDirs))
+	for i, fromDir := range fromDirs {
+		ret = append(ret, path.Join(toDirs[i], path.Base(fromDir)))
+	}
+	return ret
+}
+
+func getManifestScript(dirNum int) string {
+	cmd := ""
+	for i := 0; i < dirNum; i++ {
+		cmd += fmt.Sprintf("cd /verify-%d || exit 1; ", i)
+		cmd += fmt.Sprintf("find . -type d | while IFS= read -r f; do echo \"D %d $f\"; done; ", i)
+		cmd += fmt.Sprintf("find . -type f | while IFS= read -r f; do "+
+			"echo \"F %d $(stat -c %%s \"$f\") $(md5sum < \"$f\" | cut -d' ' -f1) $f\"; done; ", i)
+	}
+	cmd += "echo \"" + manifestDone + "\""
+	// the pod sleeps until the manifest is read
+	return fmt.Sprintf("{ %s; } > %s || exit 1; touch %s; %s", cmd, manifestPath, manifestDoneFile, execSleepCmd)
+}
+
+func newTmpPodVerify(nodeName, podName string, dirs []string, image string, memlimit int, alwayspullmoveimage bool) *v1.Pod {
+	volumes := make([]v1.Volume, 0, len(dirs))
+	volumeMounts := make([]v1.VolumeMount, 0, len(dirs))
+	for i, dir := range dirs {
+		volumes = append(volumes, v1.Volume{
+			Name: fmt.Sprintf("verify-%d", i),
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: path.Clean(dir),
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      fmt.Sprintf("verify-%d", i),
+			MountPath: fmt.Sprintf("/verify-%d", i),
+			ReadOnly:  true,
+		})
+	}
+	imagePolicy := v1.PullIfNotPresent
+	if alwayspullmoveimage {
+		imagePolicy = v1.PullAlways
+	}
+	return applyHelperPodTemplate(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: helperPodNamespace(),
+		},
+		Spec: v1.PodSpec{
+			NodeName:      nodeName,
+			RestartPolicy: v1.RestartPolicyNever,
+			Volumes:       volumes,
+			Containers: []v1.Container{
+				{
+					Name:            "verify",
+					Image:           image,
+					ImagePullPolicy: imagePolicy,
+					Command:         []string{"/bin/sh"},
+					Args:            []string{"-c", getManifestScript(len(dirs))},
+					VolumeMounts:    volumeMounts,
+					ReadinessProbe: &v1.Probe{
+						Handler: v1.Handler{
+							Exec: &v1.ExecAction{Command: []string{"test", "-f", manifestDoneFile}},
+						},
+						PeriodSeconds: 2,
+					},
+					Resources: v1.ResourceRequirements{
+						Limits:   v1.ResourceList{"cpu": resource.MustParse("0m"), "memory": resource.MustParse(fmt.Sprintf("%dMi", memlimit))},
+						Requests: v1.ResourceList{"cpu": resource.MustParse("0m"), "memory": resource.MustParse("0Mi")},
+					},
+				},
+			},
+		},
+	})
+}
+
+// waitManifestPod waits until the manifest of pod is complete.
+func waitManifestPod(clientset *kubernetes.Clientset, pod *v1.Pod, timeOut int) error {
+	for i := 0; i < timeOut; i++ {
+		curPod, err := clientset.Core().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		switch {
+		case curPod.Status.Phase == v1.PodFailed || curPod.Status.Phase == v1.PodSucceeded:
+			return fmt.Errorf("pod:%s quit before its manifest is complete", pod.Name)
+		case isPodReady(curPod):
+			return nil
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return fmt.Errorf("wait pod manifest timeout")
+}
+
+// getDirManifests runs a manifest pod on nodeName and returns the manifest of
+// every dir, the pod is deleted when it is read.
+func getDirManifests(clientset *kubernetes.Clientset, config *rest.Config, nodeName, podName string, dirs []string, image string,
+	memlimit int, alwayspullmoveimage bool, timeOut int) ([]*dirManifest, error) {
+	pod := newTmpPodVerify(nodeName, podName, dirs, image, memlimit, alwayspullmoveimage)
+	WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
+	if _, err := clientset.Core().Pods(pod.Namespace).Create(pod); err != nil {
+		return nil, fmt.Errorf("create pod %s err:%v", podName, err)
+	}
+	defer WaitPodsDeleted(clientset, nodeName, []*v1.Pod{pod}, true)
+	if err := waitManifestPod(clientset, pod, timeOut); err != nil {
+		return nil, fmt.Errorf("wait pod %s err:%v", podName, err)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(execInPod(clientset, config, pod, "cat "+manifestPath, nil, writer))
+	}()
+	defer reader.Close()
+
+	manifests := make([]*dirManifest, len(dirs))
+	for i := range manifests {
+		manifests[i] = &dirManifest{dirs: make([]string, 0), files: make(map[string]manifestFile)}
+	}
+	done := false
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == manifestDone {
+			done = true
+			break
+		}
+		if err := addManifestLine(manifests, line); err != nil {
+			return nil, fmt.Errorf("pod %s %v", podName, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read pod %s manifest err:%v", podName, err)
+	}
+	if done == false {
+		return nil, fmt.Errorf("pod %s manifest is not complete", podName)
+	}
+	return manifests, nil
+}
+
+func addManifestLine(manifests []*dirManifest, line string) error {
+	strs := strings.SplitN(line, " ", 3)
+	if len(strs) != 3 {
+		return fmt.Errorf("bad manifest line %q", line)
+	}
+	index, err := strconv.Atoi(strs[1])
+	if err != nil || index < 0 || index >= len(manifests) {
+		return fmt.Errorf("bad manifest line %q", line)
+	}
+	switch strs[0] {
+	case "D":
+		manifests[index].dirs = append(manifests[index].dirs, path.Clean(strs[2]))
+	case "F":
+		fileStrs := strings.SplitN(strs[2], " ", 3)
+		if len(fileStrs) != 3 {
+			return fmt.Errorf("bad manifest line %q", line)
+		}
+		size, err := strconv.ParseInt(fileStrs[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad manifest line %q", line)
+		}
+		manifests[index].files[path.Clean(fileStrs[2])] = manifestFile{size: size, sum: fileStrs[1]}
+	default:
+		return fmt.Errorf("bad manifest line %q", line)
+	}
+	return nil
+}
+
+// compareManifests returns the differences of the copy to of from.
+func compareManifests(fromDir, toDir string, from, to *dirManifest) []string {
+	ret := make([]string, 0)
+	if len(from.files) != len(to.files) || len(from.dirs) != len(to.dirs) {
+		ret = append(ret, fmt.Sprintf("%s has %d files %d dirs, %s has %d files %d dirs",
+			fromDir, len(from.files), len(from.dirs), toDir, len(to.files), len(to.dirs)))
+	}
+	names := make([]string, 0, len(from.files))
+	for name := range from.files {
+		names = append(names, name)
+	}
+	for name := range to.files {
+		if _, exist := from.files[name]; exist == false {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fromFile, fromExist := from.files[name]
+		toFile, toExist := to.files[name]
+		switch {
+		case toExist == false:
+			ret = append(ret, fmt.Sprintf("%s is missing", path.Join(toDir, name)))
+		case fromExist == false:
+			ret = append(ret, fmt.Sprintf("%s is not in %s", path.Join(toDir, name), fromDir))
+		case fromFile.size != toFile.size:
+			ret = append(ret, fmt.Sprintf("%s size %d, %s size %d", path.Join(fromDir, name), fromFile.size, path.Join(toDir, name), toFile.size))
+		case fromFile.sum != toFile.sum:
+			ret = append(ret, fmt.Sprintf("%s md5 %s, %s md5 %s", path.Join(fromDir, name), fromFile.sum, path.Join(toDir, name), toFile.sum))
+		}
+	}
+	return ret
+}
+
+// compareManifestUsage returns the differences of m to the usage of quota path
+// dir in the pv annotation, zero values are not reported by the csi plugin.
+func compareManifestUsage(pvs *v1.PersistentVolumeList, nodeName, dir string, m *dirManifest) []string {
+	ret := make([]string, 0)
+	info := getQuotaPathMountInfo(pvs, nodeName, dir)
+	if info == nil {
+		return ret
+	}
+	if info.VolumeCurrentFileNum > 0 && info.VolumeCurrentFileNum != int64(len(m.files)+len(m.dirs)) &&
+		info.VolumeCurrentFileNum != int64(len(m.files)) {
+		ret = append(ret, fmt.Sprintf("%s:%s records %d files, %d files %d dirs are copied",
+			nodeName, dir, info.VolumeCurrentFileNum, len(m.files), len(m.dirs)))
+	}
+	bytes := m.fileBytes()
+	slack := int64(len(m.files)+len(m.dirs)) * manifestBlockSize
+	if info.VolumeCurrentSize > 0 && (bytes > info.VolumeCurrentSize+slack || bytes+slack < info.VolumeCurrentSize) {
+		ret = append(ret, fmt.Sprintf("%s:%s records %d bytes used, %d bytes are copied",
+			nodeName, dir, info.VolumeCurrentSize, bytes))
+	}
+	return ret
+}
+
+// verifyMove compares the quota paths of op on the from node with their copy on
+// the to node and returns an error listing the differences.
+func verifyMove(clientset *kubernetes.Clientset, config *rest.Config, pvs *v1.PersistentVolumeList, op *MoveOperation) error {
+	toPaths := getMoveVerifyToDirs(op.FromDirs, op.ToDirs)
+	fromManifests, err := getDirManifests(clientset, config, op.FromNode, getMoveVerifyPodName(op.FromNode, op.FromDirs), op.FromDirs,
+		op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage, op.MoveTimeout)
+	if err != nil {
+		return err
+	}
+	toManifests, err := getDirManifests(clientset, config, op.ToNode, getMoveVerifyPodName(op.ToNode, toPaths), toPaths,
+		op.MoveImage, op.MovePodMemLimit, op.AlwaysPullMoveImage, op.MoveTimeout)
+	if err != nil {
+		return err
+	}
+	diffs := make([]string, 0)
+	for i, fromDir := range op.FromDirs {
+		diffs = append(diffs, compareManifests(fromDir, toPaths[i], fromManifests[i], toManifests[i])...)
+		diffs = append(diffs, compareManifestUsage(pvs, op.FromNode, fromDir, toManifests[i])...)
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("copied data is different from %s:", op.FromNode)
+	for i, diff := range diffs {
+		if i == manifestMaxDiffs {
+			msg += fmt.Sprintf("\n  ... and %d more", len(diffs)-manifestMaxDiffs)
+			break
+		}
+		msg += "\n  " + diff
+	}
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,350 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Pods which are deleted are recreated by their controller at once, maybe on
+// the node they were deleted from. With --scaledown the Deployment or
+// ReplicaSet of every pod is scaled to 0 instead, and its StatefulSet down to
+// the lowest ordinal of the pods so that the pods before it keep running. They
+// are scaled back to their replicas when the pv mount path is changed.
+
+const (
+	workloadStatefulSet = "StatefulSet"
+	workloadDeployment  = "Deployment"
+	workloadReplicaSet  = "ReplicaSet"
+)
+
+// WorkloadRef is a workload scaled down to stop its pods.
+type WorkloadRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	// ScaledTo is the replicas it is scaled down to, the lowest ordinal of the
+	// pods for a StatefulSet and 0 else.
+	ScaledTo int32 `json:"scaledTo,omitempty"`
+	// Pods is the number of its pods which use the quota paths.
+	Pods int `json:"pods"`
+}
+
+func (ref WorkloadRef) String() string {
+	return fmt.Sprintf("%s %s/%s", ref.Kind, ref.Namespace, ref.Name)
+}
+
+// isStopped returns whether pod of ref is stopped when ref is scaled down.
+func (ref WorkloadRef) isStopped(pod *v1.Pod) bool {
+	if ref.Kind != workloadStatefulSet {
+		return true
+	}
+	ordinal, ok := getStatefulSetPodOrdinal(ref.Name, pod.Name)
+	return ok == false || ordinal >= ref.ScaledTo
+}
+
+// getStatefulSetPodOrdinal returns the ordinal of pod podName of StatefulSet
+// setName, false if podName is not SETNAME-ORDINAL.
+func getStatefulSetPodOrdinal(setName, podName string) (int32, bool) {
+	prefix := setName + "-"
+	if strings.HasPrefix(podName, prefix) == false {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(podName[len(prefix):], 10, 32)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
+
+// getPodsWorkloads returns the workloads of pods with their current
+// replicas, and the pods which are not of a workload and only deleted.
+func getPodsWorkloads(clientset *kubernetes.Clientset, pods []*v1.Pod) ([]WorkloadRef, []*v1.Pod, error) {
+	refs := make([]WorkloadRef, 0)
+	others := make([]*v1.Pod, 0)
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil {
+			others = append(others, pod)
+			continue
+		}
+		ref := WorkloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}
+		switch owner.Kind {
+		case workloadStatefulSet:
+			// a pod which is not SETNAME-ORDINAL stops the whole StatefulSet
+			ref.ScaledTo, _ = getStatefulSetPodOrdinal(owner.Name, pod.Name)
+		case workloadReplicaSet:
+			rs, err := clientset.AppsV1().ReplicaSets(pod.Namespace).Get(owner.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil, fmt.Errorf("get replicaset %s/%s of pod %s err:%v", pod.Namespace, owner.Name, pod.Name, err)
+			}
+			if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil && rsOwner.Kind == workloadDeployment {
+				ref.Kind, ref.Name = workloadDeployment, rsOwner.Name
+			}
+		default:
+			return nil, nil, fmt.Errorf("pod %s/%s is of %s %s which can not be scaled down", pod.Namespace, pod.Name, owner.Kind, owner.Name)
+		}
+		found := false
+		for i := range refs {
+			if refs[i].Kind == ref.Kind && refs[i].Namespace == ref.Namespace && refs[i].Name == ref.Name {
+				refs[i].Pods++
+				if ref.ScaledTo < refs[i].ScaledTo {
+					refs[i].ScaledTo = ref.ScaledTo
+				}
+				found = true
+			}
+		}
+		if found == false {
+			replicas, _, _, err := getWorkload(clientset, ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			ref.Replicas, ref.Pods = replicas, 1
+			if ref.ScaledTo > replicas {
+				ref.ScaledTo = replicas
+			}
+			refs = append(refs, ref)
+		}
+	}
+	return refs, others, nil
+}
+
+// getWorkload returns the replicas, the ready replicas and the pod selector
+// of ref.
+func getWorkload(clientset *kubernetes.Clientset, ref WorkloadRef) (int32, int32, labels.Selector, error) {
+	var replicas *int32
+	var ready int32
+	var selector *metav1.LabelSelector
+	switch ref.Kind {
+	case workloadStatefulSet:
+		sts, err := clientset.AppsV1().StatefulSets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("get %s err:%v", ref, err)
+		}
+		replicas, ready, selector = sts.Spec.Replicas, sts.Status.ReadyReplicas, sts.Spec.Selector
+	case workloadDeployment:
+		deploy, err := clientset.AppsV1().Deployments(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("get %s err:%v", ref, err)
+		}
+		replicas, ready, selector = deploy.Spec.Replicas, deploy.Status.ReadyReplicas, deploy.Spec.Selector
+	case workloadReplicaSet:
+		rs, err := clientset.AppsV1().ReplicaSets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("get %s err:%v", ref, err)
+		}
+		replicas, ready, selector = rs.Spec.Replicas, rs.Status.ReadyReplicas, rs.Spec.Selector
+	default:
+		return 0, 0, nil, fmt.Errorf("%s is not supported", ref)
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("selector of %s err:%v", ref, err)
+	}
+	if replicas == nil {
+		return 1, ready, s, nil
+	}
+	return *replicas, ready, s, nil
+}
+
+// scaleWorkload sets the replicas of ref.
+func scaleWorkload(clientset *kubernetes.Clientset, ref WorkloadRef, replicas int32) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		switch ref.Kind {
+		case workloadStatefulSet:
+			sts, err := clientset.AppsV1().StatefulSets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			sts.Spec.Replicas = &replicas
+			_, err = clientset.AppsV1().StatefulSets(ref.Namespace).Update(sts)
+			return err
+		case workloadDeployment:
+			deploy, err := clientset.AppsV1().Deployments(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			deploy.Spec.Replicas = &replicas
+			_, err = clientset.AppsV1().Deployments(ref.Namespace).Update(deploy)
+			return err
+		case workloadReplicaSet:
+			rs, err := clientset.AppsV1().ReplicaSets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			rs.Spec.Replicas = &replicas
+			_, err = clientset.AppsV1().ReplicaSets(ref.Namespace).Update(rs)
+			return err
+		}
+		return fmt.Errorf("%s is not supported", ref)
+	})
+}
+
+// checkWorkloadsPDB fails if the pods stopped by scaling refs down are more
+// than a PodDisruptionBudget allows.
+func checkWorkloadsPDB(clientset *kubernetes.Clientset, refs []WorkloadRef) error {
+	for _, ref := range refs {
+		_, _, selector, err := getWorkload(clientset, ref)
+		if err != nil {
+			return err
+		}
+		pods, err := clientset.Core().Pods(ref.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return fmt.Errorf("list pods of %s err:%v", ref, err)
+		}
+		pdbs, err := clientset.PolicyV1beta1().PodDisruptionBudgets(ref.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("list poddisruptionbudgets of %s err:%v", ref.Namespace, err)
+		}
+		for _, pdb := range pdbs.Items {
+			pdbSelector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil || pdbSelector.Empty() {
+				continue
+			}
+			var stopped int32
+			for _, pod := range pods.Items {
+				if pod.DeletionTimestamp == nil && ref.isStopped(&pod) && pdbSelector.Matches(labels.Set(pod.Labels)) {
+					stopped++
+				}
+			}
+			if stopped > pdb.Status.PodDisruptionsAllowed {
+				return fmt.Errorf("scale down %s stops %d pods of poddisruptionbudget %s/%s which allows %d", ref, stopped,
+					pdb.Namespace, pdb.Name, pdb.Status.PodDisruptionsAllowed)
+			}
+		}
+	}
+	return nil
+}
+
+// scaleDownWorkloads scales refs down to their ScaledTo after checking their
+// PodDisruptionBudgets.
+func scaleDownWorkloads(clientset *kubernetes.Clientset, refs []WorkloadRef) error {
+	if err := checkWorkloadsPDB(clientset, refs); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := scaleWorkload(clientset, ref, ref.ScaledTo); err != nil {
+			return fmt.Errorf("scale down %s err:%v", ref, err)
+		}
+	}
+	return nil
+}
+
+// restoreWorkloads scales refs back to their recorded replicas.
+func restoreWorkloads(clientset *kubernetes.Clientset, refs []WorkloadRef) error {
+	for _, ref := range refs {
+		if err := scaleWorkload(clientset, ref, ref.Replicas); err != nil {
+			return fmt.Errorf("scale %s to %d err:%v", ref, ref.Replicas, err)
+		}
+	}
+	return nil
+}
+
+// waitWorkloadsReady waits until all replicas of refs are ready and, if
+// nodeName is not empty, as many ready pods of every workload as it had using
+// the quota paths run on nodeName.
+func waitWorkloadsReady(clientset *kubernetes.Clientset, refs []WorkloadRef, nodeName string, timeout int) error {
+	for i := 0; ; i++ {
+		notReady := ""
+		for _, ref := range refs {
+			_, ready, selector, err := getWorkload(clientset, ref)
+			if err != nil {
+				return err
+			}
+			if ready < ref.Replicas {
+				notReady = fmt.Sprintf("%s has %d of %d replicas ready", ref, ready, ref.Replicas)
+				break
+			}
+			if nodeName == "" {
+				continue
+			}
+			pods, err := clientset.Core().Pods(ref.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return fmt.Errorf("list pods of %s err:%v", ref, err)
+			}
+			var onNode int
+			for i := range pods.Items {
+				if pods.Items[i].Spec.NodeName == nodeName && isPodReady(&pods.Items[i]) {
+					onNode++
+				}
+			}
+			if onNode < ref.Pods {
+				notReady = fmt.Sprintf("%s has %d of %d pods ready on %s", ref, onNode, ref.Pods, nodeName)
+				break
+			}
+		}
+		if notReady == "" {
+			return nil
+		}
+		if i >= timeout {
+			return fmt.Errorf("timeout, %s", notReady)
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// waitWorkloadsScaledDown waits until the pods of refs stopped by scaling them
+// down are deleted.
+func waitWorkloadsScaledDown(clientset *kubernetes.Clientset, refs []WorkloadRef, timeout int) error {
+	for _, ref := range refs {
+		_, _, selector, err := getWorkload(clientset, ref)
+		if err != nil {
+			return err
+		}
+		for i := 0; ; i++ {
+			pods, err := clientset.Core().Pods(ref.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return fmt.Errorf("list pods of %s err:%v", ref, err)
+			}
+			var stopping int
+			for i := range pods.Items {
+				if ref.isStopped(&pods.Items[i]) {
+					stopping++
+				}
+			}
+			if stopping == 0 {
+				break
+			}
+			if i >= timeout {
+				return fmt.Errorf("timeout, %d stopped pods of %s are not deleted", stopping, ref)
+			}
+			time.Sleep(1 * time.Second)
+		}
+	}
+	return nil
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
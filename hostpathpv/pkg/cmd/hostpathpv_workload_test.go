@@ -0,0 +1,70 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkloadRefIsStopped(t *testing.T) {
+	sts := WorkloadRef{Kind: workloadStatefulSet, Namespace: "default", Name: "web", Replicas: 4, ScaledTo: 2}
+	deploy := WorkloadRef{Kind: workloadDeployment, Namespace: "default", Name: "web", Replicas: 4}
+	tests := []struct {
+		ref     WorkloadRef
+		pod     string
+		stopped bool
+	}{
+		{ref: sts, pod: "web-0"},
+		{ref: sts, pod: "web-1"},
+		{ref: sts, pod: "web-2", stopped: true},
+		{ref: sts, pod: "web-3", stopped: true},
+		// not a pod of the StatefulSet name, it is stopped to be safe
+		{ref: sts, pod: "web-x", stopped: true},
+		{ref: sts, pod: "db-0", stopped: true},
+		{ref: deploy, pod: "web-5d8f7c9b4-x2kqp", stopped: true},
+	}
+	for _, test := range tests {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: test.pod}}
+		if stopped := test.ref.isStopped(pod); stopped != test.stopped {
+			t.Errorf("%s pod %s: stopped %t, want %t", test.ref, test.pod, stopped, test.stopped)
+		}
+	}
+}
+
+func TestGetStatefulSetPodOrdinal(t *testing.T) {
+	tests := []struct {
+		set     string
+		pod     string
+		ordinal int32
+		ok      bool
+	}{
+		{set: "web", pod: "web-0", ordinal: 0, ok: true},
+		{set: "web", pod: "web-12", ordinal: 12, ok: true},
+		{set: "web-db", pod: "web-db-3", ordinal: 3, ok: true},
+		{set: "web", pod: "web-db-3"},
+		{set: "web", pod: "web--1"},
+		{set: "web", pod: "webs-1"},
+	}
+	for _, test := range tests {
+		ordinal, ok := getStatefulSetPodOrdinal(test.set, test.pod)
+		if ordinal != test.ordinal || ok != test.ok {
+			t.Errorf("%s of %s: got %d %t, want %d %t", test.pod, test.set, ordinal, ok, test.ordinal, test.ok)
+		}
+	}
+}
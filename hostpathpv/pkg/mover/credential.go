@@ -0,0 +1,114 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"time"
+)
+
+// Every move has its own credential, a self signed certificate which both the
+// sender and the receiver present and only accept from the peer. It is kept in
+// a secret which lives as long as the move pods.
+
+const (
+	CredentialCertFile = "tls.crt"
+	CredentialKeyFile  = "tls.key"
+	// ServerName is the name in the credential certificate.
+	ServerName = "hostpathpv-mover"
+)
+
+// NewCredential returns the pem encoded certificate and key of a new credential
+// which is valid for validFor.
+func NewCredential(validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: ServerName},
+		DNSNames:              []string{ServerName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+// LoadTLSConfig returns the mutual tls config of the credential in dir.
+func LoadTLSConfig(dir string, server bool) (*tls.Config, error) {
+	certPEM, err := ioutil.ReadFile(path.Join(dir, CredentialCertFile))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(path.Join(dir, CredentialKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	return NewTLSConfig(certPEM, keyPEM, server)
+}
+
+func NewTLSConfig(certPEM, keyPEM []byte, server bool) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load credential err:%v", err)
+	}
+	pool := x509.NewCertPool()
+	if pool.AppendCertsFromPEM(certPEM) == false {
+		return nil, fmt.Errorf("credential has no certificate")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if server {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		config.RootCAs = pool
+		config.ServerName = ServerName
+	}
+	return config, nil
+}
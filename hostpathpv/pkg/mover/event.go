@@ -0,0 +1,62 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The receiver prints one json Event per line, progress every second and a
+// done or error event at the end.
+
+const (
+	EventProgress = "progress"
+	EventDone     = "done"
+	EventError    = "error"
+)
+
+type Event struct {
+	Event string `json:"event"`
+	// Files are done, Bytes also has the received part of the files being
+	// received. The Total ones are of the trees started so far.
+	Files      int64 `json:"files"`
+	Bytes      int64 `json:"bytes"`
+	TotalFiles int64 `json:"totalFiles"`
+	TotalBytes int64 `json:"totalBytes"`
+	// Transferred is the bytes of changed files, unchanged files are counted
+	// in Bytes only.
+	Transferred int64 `json:"transferred"`
+	// Rate is the bytes per second since the last progress event.
+	Rate    int64  `json:"rate"`
+	Message string `json:"message,omitempty"`
+}
+
+type eventWriter struct {
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func (w *eventWriter) write(e Event) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.out.Write(append(buf, '\n'))
+}
@@ -0,0 +1,321 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startSender serves root on a local port and returns a receiver of it.
+func startSender(t *testing.T, root string, compress bool) (*Receiver, *bytes.Buffer, func()) {
+	cert, key, err := NewCredential(time.Hour)
+	if err != nil {
+		t.Fatalf("new credential err:%v", err)
+	}
+	serverTLS, err := NewTLSConfig(cert, key, true)
+	if err != nil {
+		t.Fatalf("server tls err:%v", err)
+	}
+	clientTLS, err := NewTLSConfig(cert, key, false)
+	if err != nil {
+		t.Fatalf("client tls err:%v", err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	s := &Sender{Root: root, TLS: serverTLS}
+	go s.Serve(l)
+	out := &bytes.Buffer{}
+	r := &Receiver{Server: l.Addr().String(), TLS: clientTLS, Compress: compress, Out: out}
+	return r, out, func() { l.Close() }
+}
+
+func writeFile(t *testing.T, p string, data []byte, modTime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lastEvent returns the last event the receiver printed.
+func lastEvent(t *testing.T, out *bytes.Buffer) Event {
+	e := Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("event %q err:%v", scanner.Text(), err)
+		}
+	}
+	return e
+}
+
+// checkSame fails if dst is not the same tree as src.
+func checkSame(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		dp := filepath.Join(dst, rel)
+		dinfo, err := os.Lstat(dp)
+		if err != nil {
+			t.Errorf("%s is not copied: %v", rel, err)
+			return nil
+		}
+		if info.Mode() != dinfo.Mode() {
+			t.Errorf("%s mode is %v, want %v", rel, dinfo.Mode(), info.Mode())
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			want, _ := os.Readlink(p)
+			got, _ := os.Readlink(dp)
+			if want != got {
+				t.Errorf("%s links to %s, want %s", rel, got, want)
+			}
+		case info.Mode().IsRegular():
+			want, _ := ioutil.ReadFile(p)
+			got, _ := ioutil.ReadFile(dp)
+			if bytes.Equal(want, got) == false {
+				t.Errorf("%s content differs", rel)
+			}
+			if info.ModTime().Equal(dinfo.ModTime()) == false {
+				t.Errorf("%s mod time is %v, want %v", rel, dinfo.ModTime(), info.ModTime())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestTree(t *testing.T, src string) {
+	modTime := time.Unix(1500000000, 0)
+	writeFile(t, filepath.Join(src, "data", "a.txt"), []byte("hello"), modTime)
+	writeFile(t, filepath.Join(src, "data", "sub", "b.txt"), bytes.Repeat([]byte("b"), 3*chunkSize+10), modTime)
+	// a sparse file with a hole in the middle and at the end
+	sparse := make([]byte, 4*chunkSize)
+	copy(sparse, "head")
+	copy(sparse[2*chunkSize:], "middle")
+	writeFile(t, filepath.Join(src, "data", "sparse"), sparse, modTime)
+	if err := os.Symlink("a.txt", filepath.Join(src, "data", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "data", "a.txt"), filepath.Join(src, "data", "sub", "hard")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceiveFullCopy(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		src, err := ioutil.TempDir("", "mover-src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(src)
+		dst, err := ioutil.TempDir("", "mover-dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+		newTestTree(t, src)
+
+		r, out, stop := startSender(t, src, compress)
+		err = r.Run([]Tree{{Remote: "/data", Local: filepath.Join(dst, "data")}})
+		stop()
+		if err != nil {
+			t.Fatalf("compress %v: run err:%v", compress, err)
+		}
+		checkSame(t, filepath.Join(src, "data"), filepath.Join(dst, "data"))
+
+		a, _ := os.Stat(filepath.Join(dst, "data", "a.txt"))
+		hard, _ := os.Stat(filepath.Join(dst, "data", "sub", "hard"))
+		if os.SameFile(a, hard) == false {
+			t.Errorf("compress %v: hardlink is not kept", compress)
+		}
+		if st, ok := hard.Sys().(*syscall.Stat_t); ok && st.Nlink != 2 {
+			t.Errorf("compress %v: hardlink has %d links, want 2", compress, st.Nlink)
+		}
+
+		e := lastEvent(t, out)
+		if e.Event != EventDone {
+			t.Fatalf("compress %v: last event is %q, want %q", compress, e.Event, EventDone)
+		}
+		// a.txt, b.txt, sparse and the hardlink
+		if e.Files != 4 || e.TotalFiles != 4 {
+			t.Errorf("compress %v: files %d of %d, want 4 of 4", compress, e.Files, e.TotalFiles)
+		}
+		if e.Bytes != e.TotalBytes {
+			t.Errorf("compress %v: bytes %d of %d", compress, e.Bytes, e.TotalBytes)
+		}
+	}
+}
+
+func TestReceiveIncremental(t *testing.T) {
+	src, err := ioutil.TempDir("", "mover-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "mover-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	newTestTree(t, src)
+	trees := []Tree{{Remote: "/data", Local: filepath.Join(dst, "data")}}
+
+	r, _, stop := startSender(t, src, false)
+	defer stop()
+	if err := r.Run(trees); err != nil {
+		t.Fatalf("first run err:%v", err)
+	}
+
+	modTime := time.Unix(1600000000, 0)
+	writeFile(t, filepath.Join(src, "data", "sub", "b.txt"), []byte("changed"), modTime)
+	writeFile(t, filepath.Join(src, "data", "new.txt"), []byte("new file"), modTime)
+	if err := os.Remove(filepath.Join(src, "data", "sparse")); err != nil {
+		t.Fatal(err)
+	}
+	// a file only the receiver has is removed
+	writeFile(t, filepath.Join(dst, "data", "extra"), []byte("extra"), modTime)
+
+	r2 := &Receiver{Server: r.Server, TLS: r.TLS, Out: &bytes.Buffer{}}
+	if err := r2.Run(trees); err != nil {
+		t.Fatalf("second run err:%v", err)
+	}
+	checkSame(t, filepath.Join(src, "data"), filepath.Join(dst, "data"))
+	for _, name := range []string{"sparse", "extra"} {
+		if _, err := os.Lstat(filepath.Join(dst, "data", name)); os.IsNotExist(err) == false {
+			t.Errorf("%s is not removed: %v", name, err)
+		}
+	}
+
+	e := lastEvent(t, r2.Out.(*bytes.Buffer))
+	if want := int64(len("changed") + len("new file")); e.Transferred != want {
+		t.Errorf("transferred %d, want only the changed %d", e.Transferred, want)
+	}
+}
+
+func TestReceiveSenderError(t *testing.T) {
+	src, err := ioutil.TempDir("", "mover-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "mover-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	for _, compress := range []bool{false, true} {
+		r, out, stop := startSender(t, src, compress)
+		err = r.Run([]Tree{{Remote: "/missing", Local: filepath.Join(dst, "missing")}})
+		stop()
+		if err == nil {
+			t.Fatalf("compress %v: run of a missing tree is ok", compress)
+		}
+		if strings.Contains(err.Error(), "sender:") == false || strings.Contains(err.Error(), "missing") == false {
+			t.Errorf("compress %v: err %q is not the error of the sender", compress, err)
+		}
+		if e := lastEvent(t, out); e.Event == EventDone {
+			t.Errorf("compress %v: done event after an error", compress)
+		}
+	}
+}
+
+// removeWriter removes the file remove once the stream carries marker.
+type removeWriter struct {
+	bytes.Buffer
+	marker []byte
+	remove string
+}
+
+func (w *removeWriter) Write(p []byte) (int, error) {
+	if w.remove != "" && bytes.Contains(p, w.marker) {
+		os.Remove(w.remove)
+		w.remove = ""
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestSendVanishedFile(t *testing.T) {
+	src, err := ioutil.TempDir("", "mover-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	modTime := time.Unix(1500000000, 0)
+	writeFile(t, filepath.Join(src, "data", "a"), []byte("content of a"), modTime)
+	writeFile(t, filepath.Join(src, "data", "b"), []byte("content of b"), modTime)
+
+	// b is listed by the walk and removed while a is sent
+	w := &removeWriter{marker: []byte("content of a"), remove: filepath.Join(src, "data", "b")}
+	next := nextSummary
+	if err := (&Sender{Root: src}).send(gob.NewEncoder(w), Request{Path: "/data"}, &next); err != nil {
+		t.Fatalf("send err:%v", err)
+	}
+	if w.remove != "" {
+		t.Fatalf("b is not removed during the send")
+	}
+
+	dec := gob.NewDecoder(&w.Buffer)
+	summary := Summary{}
+	if err := dec.Decode(&summary); err != nil || summary.Files != 2 {
+		t.Fatalf("summary %+v err:%v, want 2 files", summary, err)
+	}
+	paths := make([]string, 0)
+	for {
+		entry := Entry{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("decode entry err:%v", err)
+		}
+		if entry.Kind == KindEnd {
+			break
+		}
+		paths = append(paths, entry.Path)
+		if entry.Kind != KindFile || entry.Unchanged {
+			continue
+		}
+		for chunk := (Chunk{}); chunk.Last == false; {
+			chunk = Chunk{}
+			if err := dec.Decode(&chunk); err != nil || chunk.Err != "" {
+				t.Fatalf("decode chunk %+v err:%v", chunk, err)
+			}
+		}
+	}
+	if strings.Join(paths, ",") != "/,/a" {
+		t.Errorf("sent %v, want the vanished file skipped", paths)
+	}
+}
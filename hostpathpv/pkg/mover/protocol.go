@@ -0,0 +1,83 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+// A transfer is one connection per directory tree. The receiver sends a
+// Request with what it already has, the sender answers with a Summary and
+// then one Entry for every file, directory and link of the tree, followed by
+// the Chunks of every changed regular file, and an Entry of KindEnd. All
+// messages are gob encoded, after the Request they are compressed if asked.
+//
+// An error of the sender is sent in the Err of the message the receiver waits
+// for next, a Summary, an Entry of KindError or a Chunk, and ends the transfer.
+
+const (
+	KindDir = iota + 1
+	KindFile
+	KindSymlink
+	KindHardlink
+	KindEnd
+	KindError
+)
+
+// chunkSize is the max data of a Chunk, a chunk of only zero bytes is sent as
+// a hole so that sparse files stay sparse.
+const chunkSize = 64 * 1024
+
+// Stamp is what decides whether a regular file is changed.
+type Stamp struct {
+	Size    int64
+	ModTime int64
+	Mode    uint32
+}
+
+type Request struct {
+	// Path is the tree to send, relative to the sender root.
+	Path     string
+	Compress bool
+	// Have is the stamp of every regular file the receiver has, keyed by
+	// the path of the Entry.
+	Have map[string]Stamp
+}
+
+type Summary struct {
+	Files int64
+	Bytes int64
+	Err   string
+}
+
+type Entry struct {
+	Kind int
+	// Path is relative to the tree with a leading "/", the tree itself is "/".
+	Path    string
+	Mode    uint32
+	Uid     int
+	Gid     int
+	ModTime int64
+	Size    int64
+	// Link is the target of a symlink or the first path of a hardlink.
+	Link string
+	// Unchanged files are not followed by chunks.
+	Unchanged bool
+	Err       string
+}
+
+type Chunk struct {
+	Data []byte
+	Hole int64
+	Last bool
+	Err  string
+}
@@ -0,0 +1,366 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+import (
+	"bufio"
+	"compress/flate"
+	"crypto/tls"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tree is a remote tree of the sender and the local dir it is copied to. The
+// local dir is made the same as the remote tree, files which are not in the
+// remote tree are deleted.
+type Tree struct {
+	Remote string
+	Local  string
+}
+
+// ParseTree parses a tree argument REMOTE=LOCAL.
+func ParseTree(arg string) (Tree, error) {
+	strs := strings.SplitN(arg, "=", 2)
+	if len(strs) != 2 || strs[0] == "" || strs[1] == "" {
+		return Tree{}, fmt.Errorf("tree %s should be REMOTE=LOCAL", arg)
+	}
+	return Tree{Remote: strs[0], Local: path.Clean(strs[1])}, nil
+}
+
+// Receiver copies trees from the sender at Server and prints the progress
+// and done events to Out, the error event is left to the caller.
+type Receiver struct {
+	Server string
+	TLS    *tls.Config
+	// Parallel is the max trees copied at the same time, 0 is all.
+	Parallel int
+	Compress bool
+	Out      io.Writer
+
+	files       int64
+	bytes       int64
+	totalFiles  int64
+	totalBytes  int64
+	transferred int64
+}
+
+func (r *Receiver) event(kind string) Event {
+	return Event{
+		Event:       kind,
+		Files:       atomic.LoadInt64(&r.files),
+		Bytes:       atomic.LoadInt64(&r.bytes),
+		TotalFiles:  atomic.LoadInt64(&r.totalFiles),
+		TotalBytes:  atomic.LoadInt64(&r.totalBytes),
+		Transferred: atomic.LoadInt64(&r.transferred),
+	}
+}
+
+func (r *Receiver) Run(trees []Tree) error {
+	events := &eventWriter{out: r.Out}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var last int64
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e := r.event(EventProgress)
+				e.Rate = e.Bytes - last
+				last = e.Bytes
+				events.write(e)
+			}
+		}
+	}()
+
+	parallel := r.Parallel
+	if parallel <= 0 || parallel > len(trees) {
+		parallel = len(trees)
+	}
+	sem := make(chan struct{}, parallel)
+	errs := make([]error, len(trees))
+	var wg sync.WaitGroup
+	for i := range trees {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := r.receive(trees[i]); err != nil {
+				errs[i] = fmt.Errorf("%s: %v", trees[i].Remote, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-stopped
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	events.write(r.event(EventDone))
+	return nil
+}
+
+func (r *Receiver) receive(tree Tree) error {
+	have, err := localStamps(tree.Local)
+	if err != nil {
+		return err
+	}
+	conn, err := tls.Dial("tcp", r.Server, r.TLS)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := gob.NewEncoder(conn).Encode(Request{Path: tree.Remote, Compress: r.Compress, Have: have}); err != nil {
+		return err
+	}
+	var reader io.Reader = bufio.NewReaderSize(conn, chunkSize)
+	if r.Compress {
+		reader = flate.NewReader(reader)
+	}
+	dec := gob.NewDecoder(reader)
+	summary := Summary{}
+	if err := dec.Decode(&summary); err != nil {
+		return err
+	}
+	if summary.Err != "" {
+		return fmt.Errorf("sender: %s", summary.Err)
+	}
+	atomic.AddInt64(&r.totalFiles, summary.Files)
+	atomic.AddInt64(&r.totalBytes, summary.Bytes)
+
+	seen := make(map[string]bool)
+	dirs := make([]Entry, 0)
+	for {
+		entry := Entry{}
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		if entry.Kind == KindEnd {
+			break
+		} else if entry.Kind == KindError {
+			return fmt.Errorf("sender: %s", entry.Err)
+		}
+		rel := path.Clean("/" + filepath.ToSlash(entry.Path))
+		seen[rel] = true
+		dst := filepath.Join(tree.Local, rel)
+		switch entry.Kind {
+		case KindDir:
+			if err := prepare(dst, true); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dst, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, entry)
+		case KindSymlink:
+			if err := prepare(dst, false); err != nil {
+				return err
+			}
+			if err := os.Symlink(entry.Link, dst); err != nil {
+				return err
+			}
+			if err := os.Lchown(dst, entry.Uid, entry.Gid); err != nil {
+				return err
+			}
+		case KindHardlink:
+			if err := prepare(dst, false); err != nil {
+				return err
+			}
+			if err := os.Link(filepath.Join(tree.Local, path.Clean("/"+entry.Link)), dst); err != nil {
+				return err
+			}
+			r.fileDone(entry.Size)
+		case KindFile:
+			// the received bytes are counted while the file is received
+			var received int64
+			if entry.Unchanged == false {
+				n, err := r.receiveFile(dec, dst, entry)
+				if err != nil {
+					return err
+				}
+				received = n
+			}
+			r.fileDone(entry.Size - received)
+		default:
+			return fmt.Errorf("unknown entry kind %d of %s", entry.Kind, entry.Path)
+		}
+	}
+
+	if err := removeUnseen(tree.Local, seen); err != nil {
+		return err
+	}
+	// the files are written, so the dir times can be set from the deepest dir
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setMeta(filepath.Join(tree.Local, dirs[i].Path), dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) fileDone(size int64) {
+	atomic.AddInt64(&r.files, 1)
+	atomic.AddInt64(&r.bytes, size)
+}
+
+// receiveFile writes the chunks of entry to a tmp file and renames it to dst.
+// It returns the bytes it added to the received bytes.
+func (r *Receiver) receiveFile(dec *gob.Decoder, dst string, entry Entry) (int64, error) {
+	tmp := dst + ".hostpathpv-mover.tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	var written int64
+	for {
+		chunk := Chunk{}
+		if err := dec.Decode(&chunk); err != nil {
+			f.Close()
+			return written, err
+		}
+		if chunk.Err != "" {
+			f.Close()
+			return written, fmt.Errorf("sender: %s", chunk.Err)
+		}
+		if chunk.Last {
+			break
+		}
+		if chunk.Hole > 0 {
+			if _, err := f.Seek(chunk.Hole, io.SeekCurrent); err != nil {
+				f.Close()
+				return written, err
+			}
+			written += chunk.Hole
+			atomic.AddInt64(&r.bytes, chunk.Hole)
+			continue
+		}
+		if _, err := f.Write(chunk.Data); err != nil {
+			f.Close()
+			return written, err
+		}
+		written += int64(len(chunk.Data))
+		// the bytes grow while a big file is received, so that its progress
+		// is seen, the rest of the size is counted when it is done
+		atomic.AddInt64(&r.bytes, int64(len(chunk.Data)))
+		atomic.AddInt64(&r.transferred, int64(len(chunk.Data)))
+	}
+	// a trailing hole is not written
+	if err := f.Truncate(written); err != nil {
+		f.Close()
+		return written, err
+	}
+	if err := f.Close(); err != nil {
+		return written, err
+	}
+	if err := setMeta(tmp, entry); err != nil {
+		return written, err
+	}
+	if err := prepare(dst, false); err != nil {
+		return written, err
+	}
+	return written, os.Rename(tmp, dst)
+}
+
+// prepare removes what is at dst if it is in the way of a new dir or file.
+func prepare(dst string, dir bool) error {
+	info, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if dir && info.IsDir() {
+		return nil
+	}
+	return os.RemoveAll(dst)
+}
+
+func setMeta(p string, entry Entry) error {
+	mode := os.FileMode(entry.Mode)
+	if err := os.Lchown(p, entry.Uid, entry.Gid); err != nil {
+		return err
+	}
+	if err := os.Chmod(p, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	t := time.Unix(0, entry.ModTime)
+	return os.Chtimes(p, t, t)
+}
+
+// localStamps returns the stamps of the regular files under dir.
+func localStamps(dir string) (map[string]Stamp, error) {
+	ret := make(map[string]Stamp)
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return ret, nil
+	}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			ret[path.Clean("/"+filepath.ToSlash(rel))] = Stamp{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Mode: uint32(info.Mode())}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// removeUnseen removes everything under dir which is not in the remote tree.
+func removeUnseen(dir string, seen map[string]bool) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if seen[path.Clean("/"+filepath.ToSlash(rel))] {
+			return nil
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
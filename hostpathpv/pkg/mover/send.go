@@ -0,0 +1,273 @@
+/*Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mover
+
+import (
+	"bufio"
+	"compress/flate"
+	"crypto/tls"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Sender serves the trees under Root to the receivers with the credential.
+type Sender struct {
+	Root string
+	TLS  *tls.Config
+	// BWLimit is the bytes per second of all connections, 0 is no limit.
+	BWLimit int64
+
+	limiter *rate.Limiter
+}
+
+// The message a sender sends next, an error is sent as it.
+const (
+	nextSummary = iota
+	nextEntry
+	nextChunk
+)
+
+func (s *Sender) ListenAndServe(addr string) error {
+	l, err := tls.Listen("tcp", addr, s.TLS)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the receivers which connect to l until it is closed, l should
+// be a tls listener.
+func (s *Sender) Serve(l net.Listener) error {
+	if s.BWLimit > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(s.BWLimit), chunkSize)
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := s.serve(conn); err != nil {
+				log.Printf("serve %s err:%v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *Sender) serve(conn net.Conn) error {
+	defer conn.Close()
+	req := Request{}
+	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
+		return fmt.Errorf("read request err:%v", err)
+	}
+	buf := bufio.NewWriterSize(conn, chunkSize)
+	var w io.Writer = buf
+	var zw *flate.Writer
+	if req.Compress {
+		zw, _ = flate.NewWriter(buf, flate.BestSpeed)
+		w = zw
+	}
+	enc := gob.NewEncoder(w)
+	next := nextSummary
+	err := s.send(enc, req, &next)
+	if err != nil {
+		switch next {
+		case nextSummary:
+			enc.Encode(Summary{Err: err.Error()})
+		case nextEntry:
+			enc.Encode(Entry{Kind: KindError, Err: err.Error()})
+		case nextChunk:
+			enc.Encode(Chunk{Err: err.Error()})
+		}
+	}
+	if zw != nil {
+		zw.Close()
+	}
+	buf.Flush()
+	return err
+}
+
+func (s *Sender) treePath(p string) (string, error) {
+	tree := path.Join(s.Root, path.Clean("/"+p))
+	if _, err := os.Lstat(tree); err != nil {
+		return "", err
+	}
+	return tree, nil
+}
+
+// send sends the tree of req, next is kept at the message it sends next.
+func (s *Sender) send(enc *gob.Encoder, req Request, next *int) error {
+	tree, err := s.treePath(req.Path)
+	if err != nil {
+		return err
+	}
+	summary := Summary{}
+	err = filepath.Walk(tree, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return skipVanished(err)
+		}
+		if info.Mode().IsRegular() {
+			summary.Files++
+			summary.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(summary); err != nil {
+		return err
+	}
+	*next = nextEntry
+
+	links := make(map[[2]uint64]string)
+	err = filepath.Walk(tree, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return skipVanished(err)
+		}
+		rel, err := filepath.Rel(tree, p)
+		if err != nil {
+			return err
+		}
+		rel = path.Clean("/" + filepath.ToSlash(rel))
+		entry := Entry{
+			Path:    rel,
+			Mode:    uint32(info.Mode()),
+			ModTime: info.ModTime().UnixNano(),
+			Size:    info.Size(),
+		}
+		st, _ := info.Sys().(*syscall.Stat_t)
+		if st != nil {
+			entry.Uid, entry.Gid = int(st.Uid), int(st.Gid)
+		}
+		switch {
+		case info.IsDir():
+			entry.Kind = KindDir
+			return enc.Encode(entry)
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Kind = KindSymlink
+			if entry.Link, err = os.Readlink(p); err != nil {
+				return skipVanished(err)
+			}
+			return enc.Encode(entry)
+		case info.Mode().IsRegular():
+		default:
+			// devices, sockets and pipes are not moved
+			return nil
+		}
+		key := [2]uint64{}
+		linked := st != nil && st.Nlink > 1
+		if linked {
+			key = [2]uint64{uint64(st.Dev), uint64(st.Ino)}
+			if first, exist := links[key]; exist {
+				entry.Kind = KindHardlink
+				entry.Link = first
+				return enc.Encode(entry)
+			}
+		}
+		entry.Kind = KindFile
+		var f *os.File
+		if have, exist := req.Have[rel]; exist && have == (Stamp{Size: entry.Size, ModTime: entry.ModTime, Mode: entry.Mode}) {
+			entry.Unchanged = true
+		} else {
+			// the file is opened before its entry is sent, a file removed
+			// since the walk listed it is skipped as a whole
+			if f, err = os.Open(p); err != nil {
+				return skipVanished(err)
+			}
+			defer f.Close()
+		}
+		if linked {
+			links[key] = rel
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		if entry.Unchanged {
+			return nil
+		}
+		*next = nextChunk
+		if err := s.sendFile(enc, f); err != nil {
+			return err
+		}
+		*next = nextEntry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Encode(Entry{Kind: KindEnd})
+}
+
+func (s *Sender) sendFile(enc *gob.Encoder, f *os.File) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := Chunk{}
+			if isZero(buf[:n]) {
+				chunk.Hole = int64(n)
+			} else {
+				chunk.Data = buf[:n]
+				s.wait(n)
+			}
+			if err := enc.Encode(chunk); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return enc.Encode(Chunk{Last: true})
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// skipVanished returns nil for the error of a file which is removed while the
+// tree is sent, the file is not sent then, as rsync does with live data.
+func skipVanished(err error) error {
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *Sender) wait(n int) {
+	if s.limiter == nil {
+		return
+	}
+	time.Sleep(s.limiter.ReserveN(time.Now(), n).Delay())
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}